@@ -0,0 +1,7 @@
+// Package orderpb содержит protobuf-сообщения и gRPC-сервис OrderService.
+// Код в *.pb.go генерируется из orders.proto:
+//
+//	go generate ./api/orderpb
+package orderpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative orders.proto
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// === Журнал аудита ===
+// Действия администратора над персональными данными записываются в таблицу
+// audit_log в той же транзакции, что и сами изменения: нет записи — не было
+// и изменений.
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type auditEntry struct {
+	ID         int64          `json:"id"`
+	At         time.Time      `json:"at"`
+	Actor      string         `json:"actor"` // роль, см. auth.go
+	RemoteAddr string         `json:"remote_addr"`
+	Action     string         `json:"action"`
+	Subject    string         `json:"subject"`
+	Details    map[string]any `json:"details"`
+}
+
+// writeAudit добавляет запись в журнал и возвращает её id.
+func writeAudit(tx *sql.Tx, r *http.Request, action, subject string, details any) (int64, error) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = tx.QueryRow(`
+		INSERT INTO audit_log (actor, remote_addr, action, subject, details)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		string(requestRole(r)), r.RemoteAddr, action, subject, string(data)).Scan(&id)
+	return id, err
+}
+
+// === HTTP: GET /admin/audit ===
+// Последние записи, новые сначала; action и subject — точный фильтр.
+func listAuditHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultAuditLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			http.Error(w, "limit должен быть от 1 до "+strconv.Itoa(maxAuditLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rows, err := db.Query(`
+		SELECT id, at, actor, remote_addr, action, subject, details
+		FROM audit_log
+		WHERE ($1 = '' OR action = $1) AND ($2 = '' OR subject = $2)
+		ORDER BY id DESC LIMIT $3`, q.Get("action"), q.Get("subject"), limit)
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []auditEntry{}
+	for rows.Next() {
+		var e auditEntry
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.RemoteAddr, &e.Action, &e.Subject, &details); err != nil {
+			http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.Unmarshal(details, &e.Details); err != nil {
+			http.Error(w, "Ошибка разбора записи аудита: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
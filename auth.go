@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// === Доступ администратора ===
+
+// adminToken задаётся переменной окружения ADMIN_TOKEN. Если она пуста,
+// административные возможности отключены.
+var adminToken = os.Getenv("ADMIN_TOKEN")
+
+// requestToken достаёт токен из заголовка Authorization: Bearer. Cookie
+// здесь не читается: браузер шлёт её и с чужих страниц, а защиты от CSRF у
+// POST и DELETE нет.
+func requestToken(r *http.Request) string {
+	if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+// === Роли ===
+// Роль определяет, что видно в ответах: anonymous и support получают
+// контакты получателя замаскированными (см. pii.go), manager и admin —
+// целиком. Выгрузка доступна любой роли, кроме anonymous, административные
+// методы — только admin.
+
+type role string
+
+const (
+	roleAnonymous role = "anonymous"
+	roleSupport   role = "support"
+	roleManager   role = "manager"
+	roleAdmin     role = "admin"
+)
+
+// roleTokens — токены ролей. Пустой токен роль отключает.
+var roleTokens = []struct {
+	role  role
+	token string
+}{
+	{roleAdmin, adminToken},
+	{roleManager, os.Getenv("MANAGER_TOKEN")},
+	{roleSupport, os.Getenv("SUPPORT_TOKEN")},
+}
+
+func tokenRole(token string) role {
+	for _, rt := range roleTokens {
+		if rt.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(rt.token)) == 1 {
+			return rt.role
+		}
+	}
+	return roleAnonymous
+}
+
+func requestRole(r *http.Request) role {
+	return tokenRole(requestToken(r))
+}
+
+// seesPII сообщает, видит ли роль контакты получателя без маски.
+func (ro role) seesPII() bool {
+	return ro == roleManager || ro == roleAdmin
+}
+
+// isStaff сообщает, что роль задана токеном: support, manager или admin.
+func (ro role) isStaff() bool {
+	return ro != roleAnonymous
+}
+
+func isAdmin(r *http.Request) bool {
+	return requestRole(r) == roleAdmin
+}
+
+// streamRole — роль подписчика GET /events. EventSource в браузере не умеет
+// слать заголовки, поэтому только здесь токен принимается и из cookie
+// admin_token: поток ничего не меняет, а прочитать его со стороннего сайта
+// не даст same-origin policy.
+func streamRole(r *http.Request) role {
+	if r.Header.Get("Authorization") == "" {
+		if c, err := r.Cookie("admin_token"); err == nil {
+			return tokenRole(c.Value)
+		}
+	}
+	return requestRole(r)
+}
+
+// requireAdmin пропускает запрос дальше только с токеном администратора.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			http.Error(w, "Нужен токен администратора (ADMIN_TOKEN)", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireStaff пропускает запрос дальше с токеном любой роли.
+func requireStaff(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requestRole(r).isStaff() {
+			http.Error(w, "Нужен токен роли support, manager или admin", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
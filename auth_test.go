@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminCookieOnlyForEvents(t *testing.T) {
+	cookie := &http.Cookie{Name: "admin_token", Value: testAdminToken}
+
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.AddCookie(cookie)
+	if ro := streamRole(req); ro != roleAdmin {
+		t.Errorf("поток с cookie: роль %s", ro)
+	}
+	if ro := requestRole(req); ro != roleAnonymous {
+		t.Errorf("cookie принята вне потока: роль %s", ro)
+	}
+	req.Header.Set("Authorization", "Bearer "+testManagerToken)
+	if ro := streamRole(req); ro != roleManager {
+		t.Errorf("заголовок не важнее cookie: роль %s", ro)
+	}
+
+	srv := newTestServer(t)
+	for _, path := range []string{"/admin/keys/rotate", "/admin/shards/rebalance", "/admin/customers/c1/erase"} {
+		req, err := http.NewRequest("POST", srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(cookie)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("POST %s с cookie: статус %d", path, resp.StatusCode)
+		}
+	}
+}
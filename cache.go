@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// === Кэш заказов: доступ и статистика ===
+
+var (
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+
+	// Версия каждого заказа в кэше (orders.version) и недавно удалённых:
+	// изменение с версией не новее известной — устаревшее и отбрасывается
+	// (см. coherence.go). Защищены cacheMutex.
+	cacheVersions   = make(map[string]int64)
+	cacheTombstones = make(map[string]tombstone)
+
+	// Пока идёт перезагрузка кэша, изменения записываются ещё и сюда, чтобы
+	// не потерять их при подмене карты.
+	cacheJournal map[string]journalEntry
+	cacheReload  sync.Mutex
+
+	cacheLoadedAt     time.Time
+	cacheLoadDuration time.Duration
+)
+
+func cacheGet(uid string) (Order, bool) {
+	cacheMutex.RLock()
+	order, ok := orderCache[uid]
+	cacheMutex.RUnlock()
+
+	if ok {
+		cacheHits.Add(1)
+	} else {
+		cacheMisses.Add(1)
+	}
+	return order, ok
+}
+
+type tombstone struct {
+	version int64
+	at      time.Time
+}
+
+type journalEntry struct {
+	order   *Order // nil — заказ удалён
+	version int64
+}
+
+// cacheVersionLocked — версия заказа в кэше или его удаления; 0 — неизвестна.
+func cacheVersionLocked(uid string) int64 {
+	if v, ok := cacheVersions[uid]; ok {
+		return v
+	}
+	return cacheTombstones[uid].version
+}
+
+// cachePut кладёт заказ версии version в кэш, если эта версия новее
+// известной. version 0 — версия неизвестна: заказ кладётся, только если
+// о нём ещё ничего не известно.
+func cachePut(order Order, version int64) bool {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	uid := order.OrderUID
+	cur := cacheVersionLocked(uid)
+	if _, cached := orderCache[uid]; version <= cur && (version != 0 || cur != 0 || cached) {
+		return false
+	}
+	orderCache[uid] = order
+	cacheVersions[uid] = version
+	delete(cacheTombstones, uid)
+	if cacheJournal != nil {
+		cacheJournal[uid] = journalEntry{&order, version}
+	}
+	return true
+}
+
+// cacheDelete убирает заказ, удалённый с версией version; более новую
+// версию заказа (например, записанную заново) не трогает. version 0 —
+// убрать в любом случае.
+func cacheDelete(uid string, version int64) bool {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	if version != 0 && version <= cacheVersionLocked(uid) {
+		return false
+	}
+	delete(orderCache, uid)
+	delete(cacheVersions, uid)
+	if version != 0 {
+		cacheTombstones[uid] = tombstone{version, time.Now()}
+	}
+	if cacheJournal != nil {
+		cacheJournal[uid] = journalEntry{nil, version}
+	}
+	return true
+}
+
+// cachePruneTombstones забывает удаления старше before: устаревшие
+// изменения к этому времени уже дошли.
+func cachePruneTombstones(before time.Time) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	for uid, t := range cacheTombstones {
+		if t.at.Before(before) {
+			delete(cacheTombstones, uid)
+		}
+	}
+}
+
+// cacheEvictBefore убирает из кэша заказы, созданные раньше cutoff, и
+// возвращает их число.
+func cacheEvictBefore(cutoff time.Time) int {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	n := 0
+	for uid, o := range orderCache {
+		if o.DateCreated.Before(cutoff) {
+			delete(orderCache, uid)
+			delete(cacheVersions, uid)
+			if cacheJournal != nil {
+				cacheJournal[uid] = journalEntry{}
+			}
+			n++
+		}
+	}
+	return n
+}
+
+// replaceCache подменяет кэш картой, прочитанной из БД, и накладывает на
+// неё изменения, сделанные за время чтения, если они не старше прочитанного.
+func replaceCache(fresh map[string]Order, versions map[string]int64, took time.Duration) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	for uid, e := range cacheJournal {
+		if v, ok := versions[uid]; ok && e.version != 0 && e.version < v {
+			continue
+		}
+		if e.order == nil {
+			delete(fresh, uid)
+			delete(versions, uid)
+		} else {
+			fresh[uid] = *e.order
+			versions[uid] = e.version
+		}
+	}
+	orderCache = fresh
+	cacheVersions = versions
+	cacheJournal = nil
+	cacheLoadedAt = time.Now()
+	cacheLoadDuration = took
+}
+
+type cacheStats struct {
+	Instance       string    `json:"instance"` // у каждого экземпляра сервиса свой кэш
+	Orders         int       `json:"orders"`
+	Items          int       `json:"items"`
+	Hits           int64     `json:"hits"`
+	Misses         int64     `json:"misses"`
+	LoadedAt       time.Time `json:"loaded_at"`
+	LoadDurationMs int64     `json:"load_duration_ms"`
+}
+
+func currentCacheStats() cacheStats {
+	cacheMutex.RLock()
+	defer cacheMutex.RUnlock()
+	s := cacheStats{
+		Instance:       instanceID,
+		Orders:         len(orderCache),
+		Hits:           cacheHits.Load(),
+		Misses:         cacheMisses.Load(),
+		LoadedAt:       cacheLoadedAt,
+		LoadDurationMs: cacheLoadDuration.Milliseconds(),
+	}
+	for _, o := range orderCache {
+		s.Items += len(o.Items)
+	}
+	return s
+}
+
+// === HTTP: GET /admin/cache, POST /admin/cache/reload ===
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentCacheStats())
+}
+
+func cacheReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if err := loadCacheFromDB(); err != nil {
+		http.Error(w, "Ошибка загрузки кэша из БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cacheStatsHandler(w, r)
+}
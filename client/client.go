@@ -0,0 +1,484 @@
+// Package client — типизированный Go-клиент HTTP API сервиса заказов.
+//
+//	c, err := client.New("http://localhost:8080")
+//	order, err := c.GetOrder(ctx, "b563feb7b2b84b6test")
+//	if errors.Is(err, client.ErrNotFound) { ... }
+//
+// Идемпотентные запросы повторяются при сетевых ошибках, 429 и 5xx
+// с экспоненциальной задержкой.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxErrorBody = 4 << 10
+
+// Client обращается к одному экземпляру сервиса. Безопасен для
+// одновременного использования из нескольких горутин.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option настраивает Client.
+type Option func(*Client)
+
+// WithHTTPClient задаёт свой http.Client (таймауты, транспорт, прокси).
+// Для Watch таймаут клиента должен быть нулевым.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithToken передаёт токен администратора в заголовке Authorization.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithRetries задаёт число повторов и границы экспоненциальной задержки.
+func WithRetries(n int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries, c.minBackoff, c.maxBackoff = n, minBackoff, maxBackoff
+	}
+}
+
+// New создаёт клиента для сервиса по адресу вида http://host:8080.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("client: некорректный адрес: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("client: адрес должен начинаться с http:// или https://")
+	}
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		maxRetries: 3,
+		minBackoff: 200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// GetOrder возвращает заказ целиком. Если заказа нет — ошибка,
+// для которой errors.Is(err, ErrNotFound).
+func (c *Client) GetOrder(ctx context.Context, uid string) (*Order, error) {
+	var order Order
+	if err := c.getJSON(ctx, "/order/"+url.PathEscape(uid), nil, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// ListOrders возвращает страницу списка заказов.
+func (c *Client) ListOrders(ctx context.Context, opts ListOptions) (*OrderList, error) {
+	var list OrderList
+	if err := c.getJSON(ctx, "/orders", opts.values(), &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Search ищет подстроку в order_uid, трек-номере и customer_id, а с токеном
+// manager или admin — и в контактах получателя; остальные параметры — как
+// у ListOrders.
+func (c *Client) Search(ctx context.Context, query string, opts ListOptions) (*OrderList, error) {
+	opts.Query = query
+	return c.ListOrders(ctx, opts)
+}
+
+// Stats возвращает статистику продаж. group — разрез (day, week, month,
+// delivery_service, provider, bank, region, brand) или "" для итогов.
+func (c *Client) Stats(ctx context.Context, group string, f Filter) (*StatsReport, error) {
+	path := "/stats/summary"
+	if group != "" {
+		path = "/stats/" + url.PathEscape(group)
+	}
+	var rep StatsReport
+	if err := c.getJSON(ctx, path, f.values(), &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// CreateOrder отправляет заказ в POST /orders (нужен WithToken). Сервис
+// принимает его так же, как сообщение из NATS; отклонённый заказ — ошибка
+// *ValidationError, заказ с уже сохранённым order_uid — *APIError с кодом
+// 409 (ничего не записано). Запрос не повторяется.
+func (c *Client) CreateOrder(ctx context.Context, order *Order) (*OrderSummary, error) {
+	body, err := json.Marshal(order)
+	if err != nil {
+		return nil, err
+	}
+	return c.CreateOrderRaw(ctx, body)
+}
+
+// CreateOrderRaw — то же, что CreateOrder, но с готовым телом запроса:
+// так можно отправить и заведомо некорректный JSON.
+func (c *Client) CreateOrderRaw(ctx context.Context, body []byte) (*OrderSummary, error) {
+	var s OrderSummary
+	if err := c.send(ctx, http.MethodPost, "/orders", nil, body, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DeleteOrder удаляет заказ из БД и кэша (нужен WithToken).
+func (c *Client) DeleteOrder(ctx context.Context, uid string) error {
+	return c.send(ctx, http.MethodDelete, "/order/"+url.PathEscape(uid), nil, nil, nil)
+}
+
+// CacheStats возвращает состояние кэша заказов (нужен WithToken).
+func (c *Client) CacheStats(ctx context.Context) (*CacheStats, error) {
+	var s CacheStats
+	if err := c.getJSON(ctx, "/admin/cache", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ReloadCache перечитывает кэш сервиса из БД (нужен WithToken).
+func (c *Client) ReloadCache(ctx context.Context) (*CacheStats, error) {
+	var s CacheStats
+	if err := c.send(ctx, http.MethodPost, "/admin/cache/reload", nil, nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DeadLetters возвращает страницу очереди недоставленных сообщений, новые
+// сначала. all — вместе с уже переотправленными (нужен WithToken).
+func (c *Client) DeadLetters(ctx context.Context, page, limit int, all bool) (*DeadLetterList, error) {
+	q := url.Values{}
+	if page > 0 {
+		q.Set("page", strconv.Itoa(page))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if all {
+		q.Set("all", "1")
+	}
+	var list DeadLetterList
+	if err := c.getJSON(ctx, "/admin/dlq", q, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ResubmitDeadLetter повторно принимает сообщение из очереди. Непустой
+// payload заменяет сохранённое тело, например исправленным заказом.
+func (c *Client) ResubmitDeadLetter(ctx context.Context, id int64, payload []byte) (*OrderSummary, error) {
+	var s OrderSummary
+	path := "/admin/dlq/" + strconv.FormatInt(id, 10) + "/resubmit"
+	if err := c.send(ctx, http.MethodPost, path, nil, payload, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ImportOrders загружает заказы массовым импортом (нужен WithToken). body —
+// NDJSON или JSON-массив заказов. Повторная отправка безопасна: известные
+// order_uid сервис пропускает.
+func (c *Client) ImportOrders(ctx context.Context, body []byte, opts ImportOptions) (*ImportReport, error) {
+	q := url.Values{}
+	if opts.Batch > 0 {
+		q.Set("batch", strconv.Itoa(opts.Batch))
+	}
+	if opts.SkipCache {
+		q.Set("cache", "0")
+	}
+	var rep ImportReport
+	if err := c.send(ctx, http.MethodPost, "/admin/import", q, body, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// LoadRates загружает курсы валют (нужен WithToken): XML ЦБ
+// (XML_daily.asp) или CSV с колонками date, currency, nominal, value.
+// Курс на уже известную дату заменяется.
+func (c *Client) LoadRates(ctx context.Context, body []byte) (*RatesLoadReport, error) {
+	var rep RatesLoadReport
+	if err := c.send(ctx, http.MethodPost, "/admin/rates", nil, body, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// Rates возвращает курсы, действующие на дату; нулевая дата — сегодня.
+func (c *Client) Rates(ctx context.Context, date time.Time) (*RateList, error) {
+	q := url.Values{}
+	if !date.IsZero() {
+		q.Set("date", date.Format("2006-01-02"))
+	}
+	var list RateList
+	if err := c.getJSON(ctx, "/rates", q, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// KeyStatus возвращает состояние шифрования контактов (нужен WithToken).
+func (c *Client) KeyStatus(ctx context.Context) (*KeyStatus, error) {
+	var st KeyStatus
+	if err := c.getJSON(ctx, "/admin/keys", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// RotateKeys перешифровывает контакты активным ключом (нужен WithToken).
+// Прерванную ротацию можно запустить снова.
+func (c *Client) RotateKeys(ctx context.Context) (*KeyRotationReport, error) {
+	var rep KeyRotationReport
+	if err := c.send(ctx, http.MethodPost, "/admin/keys/rotate", nil, nil, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// EraseCustomer стирает контакты получателя во всех заказах покупателя
+// (нужен WithToken). reason — основание для журнала аудита; при dryRun
+// ничего не меняется, а в отчёте — заказы, которые были бы затронуты.
+func (c *Client) EraseCustomer(ctx context.Context, customerID, reason string, dryRun bool) (*ErasureReport, error) {
+	q := url.Values{}
+	if reason != "" {
+		q.Set("reason", reason)
+	}
+	if dryRun {
+		q.Set("dry_run", "1")
+	}
+	var rep ErasureReport
+	path := "/admin/customers/" + url.PathEscape(customerID) + "/erase"
+	if err := c.send(ctx, http.MethodPost, path, q, nil, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// AuditLog возвращает последние записи журнала аудита (нужен WithToken).
+// Пустые action и subject — без фильтра.
+func (c *Client) AuditLog(ctx context.Context, action, subject string, limit int) ([]AuditEntry, error) {
+	q := url.Values{}
+	if action != "" {
+		q.Set("action", action)
+	}
+	if subject != "" {
+		q.Set("subject", subject)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var entries []AuditEntry
+	if err := c.getJSON(ctx, "/admin/audit", q, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// RunArchive переносит в архив заказы старше срока хранения, не дожидаясь
+// расписания (нужен WithToken).
+func (c *Client) RunArchive(ctx context.Context) (*ArchiveReport, error) {
+	var rep ArchiveReport
+	if err := c.send(ctx, http.MethodPost, "/admin/archive/run", nil, nil, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// OutboxStats возвращает состояние очереди событий для NATS (нужен WithToken).
+func (c *Client) OutboxStats(ctx context.Context) (*OutboxStats, error) {
+	var s OutboxStats
+	if err := c.getJSON(ctx, "/admin/outbox", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Shards возвращает шарды хранилища заказов, первым — основную БД (нужен
+// WithToken).
+func (c *Client) Shards(ctx context.Context) ([]ShardInfo, error) {
+	var shards []ShardInfo
+	if err := c.getJSON(ctx, "/admin/shards", nil, &shards); err != nil {
+		return nil, err
+	}
+	return shards, nil
+}
+
+// RebalanceShards переносит заказы в шарды по текущей карте (нужен
+// WithToken). Если перенос уже идёт на другом экземпляре — *APIError с
+// кодом 409.
+func (c *Client) RebalanceShards(ctx context.Context) (*RebalanceReport, error) {
+	var rep RebalanceReport
+	if err := c.send(ctx, http.MethodPost, "/admin/shards/rebalance", nil, nil, &rep); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// send выполняет изменяющий запрос без повторов. out == nil — тело ответа
+// не нужно.
+func (c *Client) send(ctx context.Context, method, path string, q url.Values, body []byte, out any) error {
+	req, err := c.newRequest(ctx, method, path, q, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	_, err = c.doJSON(req, out)
+	return err
+}
+
+func (f Filter) values() url.Values {
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	set("q", f.Query)
+	set("customer_id", f.CustomerID)
+	set("delivery_service", f.DeliveryService)
+	set("currency", f.Currency)
+	set("report_currency", f.ReportCurrency)
+	if !f.From.IsZero() {
+		set("date_from", f.From.Format(time.RFC3339Nano))
+	}
+	if !f.To.IsZero() {
+		set("date_to", f.To.Format(time.RFC3339Nano))
+	}
+	return q
+}
+
+func (o ListOptions) values() url.Values {
+	q := o.Filter.values()
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	if o.Asc {
+		q.Set("order", "asc")
+	}
+	if o.Page > 0 {
+		q.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	return q
+}
+
+// url склеивает адрес сервиса с уже экранированным путём.
+func (c *Client) url(path string, q url.Values) string {
+	u := c.baseURL.String() + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, q url.Values, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path, q), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// getJSON выполняет GET с повторами и декодирует ответ в out.
+func (c *Client) getJSON(ctx context.Context, path string, q url.Values, out any) error {
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if err := c.sleep(ctx, attempt); err != nil {
+				return lastErr
+			}
+		}
+
+		req, err := c.newRequest(ctx, http.MethodGet, path, q, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		retry, err := c.doJSON(req, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt >= c.maxRetries || ctx.Err() != nil {
+			return lastErr
+		}
+	}
+}
+
+// doJSON выполняет один запрос и сообщает, имеет ли смысл повторить его.
+func (c *Client) doJSON(req *http.Request, out any) (retry bool, err error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return retryable(resp.StatusCode), newAPIError(resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return false, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("client: некорректный JSON в ответе: %w", err)
+	}
+	return false, nil
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// backoff — экспоненциальная задержка с «полным джиттером».
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.minBackoff << (attempt - 1)
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(d)) + 1)
+}
+
+func (c *Client) sleep(ctx context.Context, attempt int) error {
+	t := time.NewTimer(c.backoff(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
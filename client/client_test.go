@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Поведение клиента на ответах, которые от настоящего сервиса получить
+// трудно: временные 5xx, зависший запрос, оборванный поток. Те же методы
+// против настоящих обработчиков сервиса — в client_sdk_test.go в корне.
+
+// stubServer отвечает handler и считает запросы.
+func stubServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, n int64)) (*Client, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, calls.Add(1))
+	}))
+	t.Cleanup(srv.Close)
+	c, err := New(srv.URL, WithRetries(3, time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, &calls
+}
+
+func TestRetriesServerErrors(t *testing.T) {
+	c, calls := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int64) {
+		if n < 3 {
+			http.Error(w, "БД недоступна", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"order_uid": "b563feb7b2b84b6test"}`)
+	})
+	order, err := c.GetOrder(context.Background(), "b563feb7b2b84b6test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.OrderUID != "b563feb7b2b84b6test" || calls.Load() != 3 {
+		t.Errorf("заказ %q после %d запросов", order.OrderUID, calls.Load())
+	}
+}
+
+func TestRetriesGiveUp(t *testing.T) {
+	c, calls := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int64) {
+		http.Error(w, "Ошибка БД", http.StatusInternalServerError)
+	})
+	_, err := c.ListOrders(context.Background(), ListOptions{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError || apiErr.Message != "Ошибка БД" {
+		t.Fatalf("ошибка %v", err)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("запросов %d, ожидалось 1 + 3 повтора", calls.Load())
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	cases := []struct {
+		status     int
+		notFound   bool
+		validation bool
+	}{
+		{http.StatusNotFound, true, false},
+		{http.StatusBadRequest, false, true},
+		{http.StatusUnprocessableEntity, false, true},
+		{http.StatusForbidden, false, false},
+	}
+	for _, tc := range cases {
+		c, calls := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int64) {
+			http.Error(w, http.StatusText(tc.status), tc.status)
+		})
+		_, err := c.GetOrder(context.Background(), "x")
+
+		var apiErr *APIError
+		var valErr *ValidationError
+		switch {
+		case !errors.As(err, &apiErr) || apiErr.StatusCode != tc.status:
+			t.Errorf("%d: ошибка %v", tc.status, err)
+		case errors.Is(err, ErrNotFound) != tc.notFound:
+			t.Errorf("%d: errors.Is(ErrNotFound) = %v", tc.status, !tc.notFound)
+		case errors.As(err, &valErr) != tc.validation:
+			t.Errorf("%d: errors.As(*ValidationError) = %v", tc.status, !tc.validation)
+		case calls.Load() != 1:
+			t.Errorf("%d: ответ повторён %d раз", tc.status, calls.Load()-1)
+		}
+	}
+}
+
+func TestSendDoesNotRetry(t *testing.T) {
+	c, calls := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int64) {
+		http.Error(w, "Ошибка сохранения заказа", http.StatusInternalServerError)
+	})
+	if _, err := c.CreateOrderRaw(context.Background(), []byte(`{}`)); err == nil {
+		t.Fatal("ошибка не возвращена")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("POST повторён: %d запросов", calls.Load())
+	}
+}
+
+func TestContextCancelsRequest(t *testing.T) {
+	c, _ := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int64) {
+		<-r.Context().Done()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Stats(ctx, "month", Filter{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ошибка %v, ожидалась context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("запрос прерван через %s", d)
+	}
+}
+
+func TestContextCancelsBackoff(t *testing.T) {
+	c, calls := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int64) {
+		http.Error(w, "перегружен", http.StatusServiceUnavailable)
+	})
+	WithRetries(3, time.Minute, time.Hour)(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.Search(ctx, "test", ListOptions{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("ошибка %v, ожидалась последняя ошибка сервиса", err)
+	}
+	if d := time.Since(start); d > 2*time.Second || calls.Load() != 1 {
+		t.Errorf("ожидание повтора не прервано: %s, запросов %d", d, calls.Load())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c, err := New("http://localhost", WithRetries(10, 100*time.Millisecond, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for attempt := 1; attempt <= 10; attempt++ {
+		limit := min(100*time.Millisecond<<(attempt-1), time.Second)
+		for range 100 {
+			if d := c.backoff(attempt); d <= 0 || d > limit {
+				t.Fatalf("попытка %d: задержка %s вне (0, %s]", attempt, d, limit)
+			}
+		}
+	}
+}
+
+func TestWatchResumesAfterDisconnect(t *testing.T) {
+	c, calls := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int64) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch n {
+		case 1:
+			// Первое соединение обрывается после события 41
+			fmt.Fprint(w, "retry: 3000\n\n: ping\n\nid: 41\nevent: order\ndata: {\"order_uid\": \"a\", \"amount\": 10, \"currency\": \"RUB\"}\n\n")
+		default:
+			if got := r.Header.Get("Last-Event-ID"); got != "41" {
+				http.Error(w, "Last-Event-ID "+got, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, "id: 42\nevent: rejected\ndata: {\"order_uid\": \"b\", \"reason\": \"невалидный JSON\"}\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	})
+
+	var got []Event
+	err := c.Watch(context.Background(), 0, func(ev Event) error {
+		got = append(got, ev)
+		if len(got) == 2 {
+			return ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 || got[0].ID != 41 || got[0].Order == nil || got[0].Order.OrderUID != "a" ||
+		got[0].Order.Amount.Decimal() != "10.00" || got[1].ID != 42 || got[1].Rejection == nil {
+		t.Errorf("события %+v после %d соединений", got, calls.Load())
+	}
+}
+
+func TestWatchStopsOnClientError(t *testing.T) {
+	c, calls := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int64) {
+		http.Error(w, "некорректный Last-Event-ID", http.StatusBadRequest)
+	})
+	err := c.Watch(context.Background(), 7, func(Event) error { return nil })
+	var valErr *ValidationError
+	if !errors.As(err, &valErr) || calls.Load() != 1 {
+		t.Errorf("ошибка %v после %d запросов", err, calls.Load())
+	}
+}
+
+func TestWatchHandlerError(t *testing.T) {
+	c, _ := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int64) {
+		fmt.Fprint(w, "id: 1\nevent: order\ndata: {\"order_uid\": \"a\"}\n\n")
+	})
+	stop := errors.New("хватит")
+	if err := c.Watch(context.Background(), 0, func(Event) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("ошибка %v, ожидалась ошибка обработчика", err)
+	}
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNotFound возвращается (через errors.Is) на ответ 404.
+var ErrNotFound = errors.New("client: не найдено")
+
+// APIError — неуспешный ответ сервиса. Message содержит текст ошибки,
+// который сервис отдаёт в теле ответа.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("client: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// ValidationError — сервис отклонил запрос как некорректный (400 или 422).
+type ValidationError struct {
+	APIError
+}
+
+func (e *ValidationError) Unwrap() error { return &e.APIError }
+
+func newAPIError(status int, body string) error {
+	base := APIError{StatusCode: status, Message: body}
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return &ValidationError{base}
+	}
+	return &base
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ExportOptions — параметры выгрузки GET /export. Пустые Format и Layout
+// означают умолчания сервиса: csv, строка на заказ.
+type ExportOptions struct {
+	Filter
+	Format string // csv, ndjson, xlsx
+	Layout string // order — строка на заказ, item — строка на товар
+	Sort   string
+	Asc    bool
+}
+
+// Export запрашивает выгрузку заказов и возвращает тело ответа как есть;
+// вызывающий читает его до конца и закрывает. Ответ идёт потоком, поэтому
+// запрос не повторяется: оборванная выгрузка возвращает ошибку при чтении.
+// Нужен токен роли support, manager или admin.
+func (c *Client) Export(ctx context.Context, opts ExportOptions) (io.ReadCloser, error) {
+	q := opts.Filter.values()
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	set("format", opts.Format)
+	set("layout", opts.Layout)
+	set("sort", opts.Sort)
+	if opts.Asc {
+		q.Set("order", "asc")
+	}
+
+	return c.stream(ctx, "/export", q)
+}
+
+// ArchiveMonth скачивает заказы из архива за месяц (нужен WithToken) —
+// NDJSON в gzip; вызывающий читает тело до конца и закрывает. Поток,
+// оборванный на стороне сервиса, даёт ошибку распаковки.
+func (c *Client) ArchiveMonth(ctx context.Context, month time.Time) (io.ReadCloser, error) {
+	return c.stream(ctx, "/admin/archive/"+month.Format("2006-01"), nil)
+}
+
+// stream выполняет GET без повторов и возвращает тело успешного ответа.
+func (c *Client) stream(ctx context.Context, path string, q url.Values) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, q, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, newAPIError(resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,324 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+
+	"order-service-demo/model"
+)
+
+// Модели заказа — те же типы, что использует сервис.
+type (
+	Order    = model.Order
+	Delivery = model.Delivery
+	Payment  = model.Payment
+	Item     = model.Item
+	Money    = model.Money
+)
+
+// OrderSummary — строка списка заказов (GET /orders).
+type OrderSummary struct {
+	OrderUID        string    `json:"order_uid"`
+	TrackNumber     string    `json:"track_number"`
+	DateCreated     time.Time `json:"date_created"`
+	CustomerID      string    `json:"customer_id"`
+	DeliveryService string    `json:"delivery_service"`
+	ItemCount       int       `json:"item_count"`
+	Amount          Money     `json:"amount"`
+	Currency        string    `json:"currency"`
+}
+
+// UnmarshalJSON переводит сумму в валюту строки.
+func (s *OrderSummary) UnmarshalJSON(data []byte) error {
+	type plain OrderSummary
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+	s.Amount.SetCurrency(s.Currency)
+	return nil
+}
+
+// OrderList — страница списка заказов.
+type OrderList struct {
+	Orders []OrderSummary `json:"orders"`
+	Total  int            `json:"total"`
+	Page   int            `json:"page"`
+	Limit  int            `json:"limit"`
+}
+
+// StatsRow — показатели продаж для одного значения разреза.
+type StatsRow struct {
+	Key         string  `json:"key"`
+	Orders      int     `json:"orders"`
+	Revenue     float64 `json:"revenue"` // в единицах валюты
+	AvgBasket   float64 `json:"avg_basket"`
+	Items       int     `json:"items"`
+	Unconverted int     `json:"unconverted,omitempty"` // заказы без курса на дату оплаты, в Revenue не вошли
+}
+
+// StatsReport — ответ GET /stats/summary и GET /stats/{group}.
+type StatsReport struct {
+	GroupBy  string     `json:"group_by,omitempty"`
+	Currency string     `json:"currency,omitempty"` // валюта Revenue: Filter.ReportCurrency, по умолчанию RUB
+	From     *time.Time `json:"from,omitempty"`
+	To       *time.Time `json:"to,omitempty"`
+	Rows     []StatsRow `json:"rows,omitempty"`
+	Total    StatsRow   `json:"total"`
+}
+
+// Rejection — отказ в приёме заказа (событие rejected, только для админов).
+type Rejection struct {
+	OrderUID string    `json:"order_uid,omitempty"`
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+}
+
+// Event — событие из потока GET /events. Заполнено одно из полей Order
+// или Rejection в зависимости от Type.
+type Event struct {
+	ID        uint64
+	Type      string
+	Order     *OrderSummary
+	Rejection *Rejection
+}
+
+// Filter — фильтры, общие для списка, поиска и статистики.
+type Filter struct {
+	Query           string
+	CustomerID      string
+	DeliveryService string
+	Currency        string
+	From            time.Time
+	To              time.Time
+
+	// ReportCurrency — для Stats и Export: пересчитать суммы в эту валюту
+	// по курсу ЦБ на дату оплаты.
+	ReportCurrency string
+}
+
+// ListOptions — параметры страницы списка. Нулевые значения означают
+// умолчания сервиса: первая страница, 20 строк, по дате создания от новых.
+// Листать можно первые 10 000 заказов (Page×Limit), дальше сервис отвечает
+// ValidationError — весь список отдаёт выгрузка.
+type ListOptions struct {
+	Filter
+	Sort  string // date_created, customer_id, delivery_service, item_count, amount (внутри валюты), currency
+	Asc   bool
+	Page  int
+	Limit int
+}
+
+// CacheStats — состояние кэша заказов (GET /admin/cache).
+type CacheStats struct {
+	Instance       string    `json:"instance"` // экземпляр сервиса, ответивший на запрос
+	Orders         int       `json:"orders"`
+	Items          int       `json:"items"`
+	Hits           int64     `json:"hits"`
+	Misses         int64     `json:"misses"`
+	LoadedAt       time.Time `json:"loaded_at"`
+	LoadDurationMs int64     `json:"load_duration_ms"`
+}
+
+// DeadLetter — сообщение из NATS, которое сервис не смог принять.
+type DeadLetter struct {
+	ID            int64      `json:"id"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	Source        string     `json:"source"`
+	OrderUID      string     `json:"order_uid,omitempty"`
+	Reason        string     `json:"reason"`
+	Payload       string     `json:"payload"`
+	PayloadError  string     `json:"payload_error,omitempty"` // тело не удалось расшифровать
+	Attempts      int        `json:"attempts"`
+	ResubmittedAt *time.Time `json:"resubmitted_at,omitempty"`
+}
+
+// DeadLetterList — страница очереди недоставленных сообщений.
+type DeadLetterList struct {
+	Items []DeadLetter `json:"items"`
+	Total int          `json:"total"`
+	Page  int          `json:"page"`
+	Limit int          `json:"limit"`
+}
+
+// ImportOptions — параметры массового импорта. Нулевые значения означают
+// умолчания сервиса: пачки по 500 заказов, заказы сразу попадают в кэш.
+type ImportOptions struct {
+	Batch     int  // заказов в одной транзакции
+	SkipCache bool // не добавлять в кэш; заказы видны после ReloadCache
+}
+
+// ImportResult — заказ, который не был сохранён при импорте.
+type ImportResult struct {
+	Record   int    `json:"record"` // номер заказа в запросе, с 1
+	OrderUID string `json:"order_uid,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// ImportReport — итог POST /admin/import.
+type ImportReport struct {
+	Records    int            `json:"records"`
+	Imported   int            `json:"imported"`
+	Skipped    []ImportResult `json:"skipped"` // order_uid уже был в БД
+	Failed     []ImportResult `json:"failed"`
+	Cached     bool           `json:"cached"`
+	Error      string         `json:"error,omitempty"`
+	DurationMs int64          `json:"duration_ms"`
+}
+
+// ExchangeRate — курс ЦБ: Value рублей за Nominal единиц валюты.
+type ExchangeRate struct {
+	Date     string      `json:"date"` // YYYY-MM-DD
+	Currency string      `json:"currency"`
+	Nominal  int         `json:"nominal"`
+	Value    json.Number `json:"value"`
+}
+
+// RateList — курсы, действующие на дату (GET /rates).
+type RateList struct {
+	Date  string         `json:"date"`
+	Base  string         `json:"base"`
+	Rates []ExchangeRate `json:"rates"`
+}
+
+// RatesLoadReport — итог POST /admin/rates.
+type RatesLoadReport struct {
+	Loaded     int      `json:"loaded"`
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Currencies []string `json:"currencies"`
+	Skipped    []string `json:"skipped,omitempty"` // валюты, которых сервис не знает (например, XDR)
+}
+
+// KeyStatus — состояние шифрования контактов (GET /admin/keys). Rows —
+// строк deliveries по версии ключа, "plain" — открытым текстом; Archive и
+// DeadLetters — то же для архива заказов и тел сообщений DLQ.
+type KeyStatus struct {
+	Enabled       bool           `json:"enabled"`
+	ActiveVersion int            `json:"active_version,omitempty"`
+	Versions      []int          `json:"versions,omitempty"`
+	Rows          map[string]int `json:"rows"`
+	Archive       map[string]int `json:"archive"`
+	DeadLetters   map[string]int `json:"dead_letters"`
+}
+
+// KeyRotationReport — итог POST /admin/keys/rotate.
+type KeyRotationReport struct {
+	ActiveVersion int      `json:"active_version"`
+	Rotated       int      `json:"rotated"`
+	Failed        []string `json:"failed"`
+	DurationMs    int64    `json:"duration_ms"`
+}
+
+// ErasureReport — итог POST /admin/customers/{customer_id}/erase.
+type ErasureReport struct {
+	CustomerID    string     `json:"customer_id"`
+	DryRun        bool       `json:"dry_run"`
+	Orders        []string   `json:"orders"`
+	AlreadyErased int        `json:"already_erased"`
+	Archived      int        `json:"archived"`
+	DeadLetters   int        `json:"dead_letters"`
+	AuditID       int64      `json:"audit_id,omitempty"`
+	ErasedAt      *time.Time `json:"erased_at,omitempty"`
+}
+
+// AuditEntry — запись журнала аудита (GET /admin/audit).
+type AuditEntry struct {
+	ID         int64          `json:"id"`
+	At         time.Time      `json:"at"`
+	Actor      string         `json:"actor"`
+	RemoteAddr string         `json:"remote_addr"`
+	Action     string         `json:"action"`
+	Subject    string         `json:"subject"`
+	Details    map[string]any `json:"details"`
+}
+
+// ArchiveReport — итог POST /admin/archive/run.
+type ArchiveReport struct {
+	Cutoff     time.Time `json:"cutoff"`
+	Archived   int       `json:"archived"`
+	Busy       bool      `json:"busy,omitempty"` // архивацию в этот момент выполнял другой экземпляр
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// OutboxStats — состояние очереди событий order.* (GET /admin/outbox).
+type OutboxStats struct {
+	Pending       int        `json:"pending"`
+	OldestPending *time.Time `json:"oldest_pending,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	Published24h  int        `json:"published_24h"`
+}
+
+// ShardInfo — шард из GET /admin/shards. Misplaced — заказы, которым по
+// текущей карте место в другом шарде; их переносит RebalanceShards.
+type ShardInfo struct {
+	Name      string `json:"name"`
+	Orders    int    `json:"orders"`
+	Archived  int    `json:"archived"`
+	Misplaced int    `json:"misplaced"`
+}
+
+// RebalanceReport — итог POST /admin/shards/rebalance.
+type RebalanceReport struct {
+	Moved         int      `json:"moved"`
+	MovedArchived int      `json:"moved_archived"`
+	Failed        []string `json:"failed"`
+	DurationMs    int64    `json:"duration_ms"`
+}
+
+// OutboxEvent — событие о заказе, которое сервис публикует в NATS Streaming
+// в канал, совпадающий с Type: order.saved, order.updated, order.deleted.
+// Доставка — не меньше одного раза; повторы отбрасываются по ID.
+type OutboxEvent struct {
+	ID              int64           `json:"id"`
+	Type            string          `json:"type"`
+	OrderUID        string          `json:"order_uid"`
+	Entry           string          `json:"entry,omitempty"`
+	DeliveryService string          `json:"delivery_service,omitempty"`
+	OccurredAt      time.Time       `json:"occurred_at"`
+	Data            json.RawMessage `json:"data,omitempty"` // order.saved — OrderSummary, order.updated — {"reason": ...}
+}
+
+// Webhook — подписка на события о заказах (/admin/webhooks). Пустой
+// фильтр означает любые значения.
+type Webhook struct {
+	ID                  int64      `json:"id"`
+	URL                 string     `json:"url"`
+	Events              []string   `json:"events"`
+	Entries             []string   `json:"entries"`
+	DeliveryServices    []string   `json:"delivery_services"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	Secret              string     `json:"secret,omitempty"` // только в ответе CreateWebhook
+}
+
+// WebhookRequest — новая подписка.
+type WebhookRequest struct {
+	URL              string   `json:"url"`
+	Events           []string `json:"events,omitempty"` // order.saved, order.updated, order.deleted
+	Entries          []string `json:"entries,omitempty"`
+	DeliveryServices []string `json:"delivery_services,omitempty"`
+}
+
+// WebhookDelivery — запись журнала доставок подписки.
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	EventID       int64      `json:"event_id"`
+	EventType     string     `json:"event_type"`
+	OrderUID      string     `json:"order_uid"`
+	Status        string     `json:"status"` // pending, delivered, failed
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatus    int        `json:"last_status,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookTestResult — ответ получателя на событие ping.
+type WebhookTestResult struct {
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
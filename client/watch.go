@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrStop может вернуть обработчик Watch, чтобы завершить подписку без ошибки.
+var ErrStop = errors.New("client: подписка остановлена")
+
+// Watch подписывается на поток GET /events и вызывает fn для каждого
+// события по порядку. После обрыва соединения клиент переподключается
+// с Last-Event-ID и получает пропущенные события из буфера сервиса.
+//
+// Watch блокируется до отмены ctx (возвращает ctx.Err()), до ErrStop от fn
+// (возвращает nil), до другой ошибки fn или до ответа сервиса, который нет
+// смысла повторять (например, 400).
+func (c *Client) Watch(ctx context.Context, lastEventID uint64, fn func(Event) error) error {
+	attempt := 0
+	for {
+		connected, err := c.watchOnce(ctx, &lastEventID, fn)
+		switch {
+		case errors.Is(err, ErrStop):
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil && !isRetryableWatchErr(err):
+			return err
+		}
+
+		if connected {
+			attempt = 0
+		}
+		attempt++
+		if err := c.sleep(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+type handlerError struct{ err error }
+
+func (e handlerError) Error() string { return e.err.Error() }
+func (e handlerError) Unwrap() error { return e.err }
+
+func isRetryableWatchErr(err error) bool {
+	var he handlerError
+	if errors.As(err, &he) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return retryable(apiErr.StatusCode)
+	}
+	return true
+}
+
+// watchOnce держит одно соединение. connected сообщает, что сервер принял
+// подписку, — после этого счётчик задержек сбрасывается.
+func (c *Client) watchOnce(ctx context.Context, lastEventID *uint64, fn func(Event) error) (connected bool, err error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/events", nil, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastEventID > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(*lastEventID, 10))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return false, newAPIError(resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	r := bufio.NewReader(resp.Body)
+	var id, typ string
+	var data strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return true, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			// Пустая строка завершает событие
+			if typ != "" && data.Len() > 0 {
+				ev, err := parseEvent(id, typ, data.String())
+				if err != nil {
+					return true, err
+				}
+				if err := fn(ev); err != nil {
+					return true, handlerError{err}
+				}
+				*lastEventID = ev.ID
+			}
+			id, typ = "", ""
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			typ = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+}
+
+func parseEvent(id, typ, data string) (Event, error) {
+	ev := Event{Type: typ}
+	if id != "" {
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return ev, fmt.Errorf("client: некорректный id события %q", id)
+		}
+		ev.ID = n
+	}
+
+	var err error
+	switch typ {
+	case "order":
+		ev.Order = new(OrderSummary)
+		err = json.Unmarshal([]byte(data), ev.Order)
+	case "rejected":
+		ev.Rejection = new(Rejection)
+		err = json.Unmarshal([]byte(data), ev.Rejection)
+	}
+	if err != nil {
+		return ev, fmt.Errorf("client: некорректное событие %s: %w", typ, err)
+	}
+	return ev, nil
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// CreateWebhook подписывает URL на события о заказах (нужен WithToken).
+// Секрет для проверки подписи есть только в этом ответе.
+func (c *Client) CreateWebhook(ctx context.Context, req WebhookRequest) (*Webhook, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var h Webhook
+	if err := c.send(ctx, http.MethodPost, "/admin/webhooks", nil, body, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Webhooks возвращает все подписки, без секретов (нужен WithToken).
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	var hooks []Webhook
+	if err := c.getJSON(ctx, "/admin/webhooks", nil, &hooks); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook удаляет подписку вместе с журналом доставок (нужен WithToken).
+func (c *Client) DeleteWebhook(ctx context.Context, id int64) error {
+	return c.send(ctx, http.MethodDelete, webhookPath(id), nil, nil, nil)
+}
+
+// EnableWebhook включает подписку, выключенную после неудачных доставок
+// (нужен WithToken).
+func (c *Client) EnableWebhook(ctx context.Context, id int64) error {
+	return c.send(ctx, http.MethodPost, webhookPath(id)+"/enable", nil, nil, nil)
+}
+
+// TestWebhook отправляет подписке событие ping и возвращает ответ
+// получателя (нужен WithToken). Недоставленный ping — не ошибка вызова:
+// причина в WebhookTestResult.Error.
+func (c *Client) TestWebhook(ctx context.Context, id int64) (*WebhookTestResult, error) {
+	var res WebhookTestResult
+	if err := c.send(ctx, http.MethodPost, webhookPath(id)+"/test", nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// WebhookDeliveries возвращает журнал доставок подписки, новые сначала;
+// status — pending, delivered, failed или пусто (нужен WithToken).
+func (c *Client) WebhookDeliveries(ctx context.Context, id int64, status string, limit int) ([]WebhookDelivery, error) {
+	q := url.Values{}
+	if status != "" {
+		q.Set("status", status)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var list []WebhookDelivery
+	if err := c.getJSON(ctx, webhookPath(id)+"/deliveries", q, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func webhookPath(id int64) string {
+	return "/admin/webhooks/" + strconv.FormatInt(id, 10)
+}
+
+// ErrBadSignature — запрос не от сервиса или подписан другим секретом.
+var ErrBadSignature = errors.New("client: неверная подпись webhook")
+
+// VerifyWebhook проверяет подпись запроса, пришедшего на webhook: body —
+// уже прочитанное тело. Запрос старше tolerance (по X-Webhook-Timestamp)
+// отклоняется, чтобы перехваченный запрос нельзя было повторить; 0 — не
+// проверять время.
+func VerifyWebhook(secret string, r *http.Request, body []byte, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if tolerance > 0 {
+		if d := time.Since(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+			return ErrBadSignature
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	mac.Write(body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(r.Header.Get("X-Webhook-Signature"))) {
+		return ErrBadSignature
+	}
+	return nil
+}
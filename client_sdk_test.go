@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"order-service-demo/client"
+)
+
+// === Клиент (пакет client) против настоящих обработчиков ===
+// Повторы, отмена и разбор потока на искусственных ответах проверяются в
+// client/client_test.go; здесь — что клиент и сервис понимают друг друга.
+
+// newTestClient поднимает сервис и клиента к нему; requests считает запросы
+// к сервису.
+func newTestClient(t *testing.T, opts ...client.Option) (*client.Client, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	r := newRouter()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		r.ServeHTTP(w, req)
+	}))
+	t.Cleanup(srv.Close)
+	opts = append([]client.Option{client.WithRetries(2, time.Millisecond, 5*time.Millisecond)}, opts...)
+	c, err := client.New(srv.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, &requests
+}
+
+func TestClientGetOrder(t *testing.T) {
+	resetCache(t)
+	order := loadFixture(t, "basic")
+	cachePut(order, 1)
+	ctx := context.Background()
+
+	anon, _ := newTestClient(t)
+	got, err := anon.GetOrder(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.OrderUID != order.OrderUID || got.Payment.Amount != order.Payment.Amount || len(got.Items) != len(order.Items) {
+		t.Errorf("заказ %+v", got)
+	}
+	if got.Delivery.Phone == order.Delivery.Phone {
+		t.Errorf("без токена телефон не замаскирован: %q", got.Delivery.Phone)
+	}
+
+	manager, _ := newTestClient(t, client.WithToken(testManagerToken))
+	if got, err = manager.GetOrder(ctx, order.OrderUID); err != nil {
+		t.Fatal(err)
+	}
+	if got.Delivery != order.Delivery {
+		t.Errorf("manager получил контакты %+v", got.Delivery)
+	}
+}
+
+func TestClientNotFound(t *testing.T) {
+	needDB(t)
+	c, requests := newTestClient(t)
+	_, err := c.GetOrder(context.Background(), "unknown")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("ошибка %v, ожидалась client.ErrNotFound", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("404 повторён: %d запросов", requests.Load())
+	}
+}
+
+func TestClientValidationErrors(t *testing.T) {
+	ctx := context.Background()
+	c, requests := newTestClient(t, client.WithToken(testAdminToken))
+	bad := loadFixture(t, "basic")
+	bad.Items = nil
+
+	calls := map[string]func() error{
+		"Stats с неизвестным разрезом": func() error {
+			_, err := c.Stats(ctx, "colour", client.Filter{})
+			return err
+		},
+		"ListOrders с неизвестной сортировкой": func() error {
+			_, err := c.ListOrders(ctx, client.ListOptions{Sort: "colour"})
+			return err
+		},
+		"Stats с неизвестной валютой отчёта": func() error {
+			_, err := c.Stats(ctx, "", client.Filter{ReportCurrency: "XYZ"})
+			return err
+		},
+		"CreateOrderRaw с невалидным JSON": func() error {
+			_, err := c.CreateOrderRaw(ctx, []byte(`{"order_uid":`))
+			return err
+		},
+		"CreateOrder без товаров": func() error {
+			_, err := c.CreateOrder(ctx, &bad)
+			return err
+		},
+	}
+	for name, call := range calls {
+		requests.Store(0)
+		err := call()
+		var valErr *client.ValidationError
+		if !errors.As(err, &valErr) || valErr.Message == "" {
+			t.Errorf("%s: ошибка %v, ожидалась *client.ValidationError", name, err)
+		}
+		if requests.Load() != 1 {
+			t.Errorf("%s: %d запросов", name, requests.Load())
+		}
+	}
+}
+
+// TestClientCreateOrderTwice: повторная отправка того же order_uid ничего не
+// записывает, и клиент это видит по 409.
+func TestClientCreateOrderTwice(t *testing.T) {
+	needDB(t)
+	ctx := context.Background()
+	c, requests := newTestClient(t, client.WithToken(testAdminToken))
+	order := loadFixture(t, "basic")
+	if _, err := c.CreateOrder(ctx, &order); err != nil {
+		t.Fatal(err)
+	}
+
+	requests.Store(0)
+	changed := order
+	changed.CustomerID = "other"
+	_, err := c.CreateOrder(ctx, &changed)
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Fatalf("повтор: ошибка %v, ожидался 409", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("409 повторён: %d запросов", requests.Load())
+	}
+	if got, err := getOrderFromDB(order.OrderUID); err != nil || got.CustomerID != order.CustomerID {
+		t.Errorf("заказ перезаписан: %q, %v", got.CustomerID, err)
+	}
+}
+
+func TestClientRetriesServiceErrors(t *testing.T) {
+	brokenDB(t)
+	c, requests := newTestClient(t)
+	_, err := c.ListOrders(context.Background(), client.ListOptions{})
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("ошибка %v, ожидалась 500", err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("запросов %d, ожидалось 1 + 2 повтора", requests.Load())
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	events.mu.Lock()
+	after := events.nextID
+	events.mu.Unlock()
+
+	first, second := loadFixture(t, "basic"), loadFixture(t, "clothes")
+	events.orderSaved(first)
+	events.orderRejected("", "невалидный JSON") // только для админов
+	events.orderSaved(second)
+
+	c, _ := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got []client.Event
+	err := c.Watch(ctx, after, func(ev client.Event) error {
+		got = append(got, ev)
+		if len(got) == 2 {
+			return client.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []Order{first, second} {
+		ev := got[i]
+		if ev.Type != "order" || ev.Order == nil || ev.Order.OrderUID != want.OrderUID ||
+			ev.Order.Amount != want.Payment.Amount || ev.Order.ItemCount != len(want.Items) {
+			t.Errorf("событие %d: %+v", i, ev)
+		}
+	}
+	if got[1].ID <= got[0].ID {
+		t.Errorf("id событий не растут: %d, %d", got[0].ID, got[1].ID)
+	}
+}
+
+func TestClientWatchCancel(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Watch(ctx, 0, func(client.Event) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ошибка %v, ожидалась context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("подписка завершилась через %s", d)
+	}
+}
+
+func TestClientListSearchStats(t *testing.T) {
+	needDB(t)
+	orders := saveFixtures(t, "basic", "clothes", "kids")
+	ctx := context.Background()
+	anon, _ := newTestClient(t)
+	manager, _ := newTestClient(t, client.WithToken(testManagerToken))
+
+	list, err := anon.ListOrders(ctx, client.ListOptions{Sort: "amount", Asc: true, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != len(orders) || len(list.Orders) != 2 || list.Orders[0].Amount.Float() > list.Orders[1].Amount.Float() {
+		t.Errorf("список %+v", list)
+	}
+
+	found, err := anon.Search(ctx, orders[0].TrackNumber, client.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Total != 1 || found.Orders[0].OrderUID != orders[0].OrderUID {
+		t.Errorf("поиск по трек-номеру: %+v", found)
+	}
+
+	// По контактам ищут только роли, которые видят их без маски
+	email := orders[0].Delivery.Email
+	if found, err = anon.Search(ctx, email, client.ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if found.Total != 0 {
+		t.Errorf("без токена поиск по email нашёл %d заказов", found.Total)
+	}
+	if found, err = manager.Search(ctx, email, client.ListOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if found.Total != 1 || found.Orders[0].OrderUID != orders[0].OrderUID {
+		t.Errorf("manager: поиск по email: %+v", found)
+	}
+
+	rep, err := anon.Stats(ctx, "", client.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Total.Orders != len(orders) || rep.Currency != "RUB" {
+		t.Errorf("итоги: заказов %d, валюта %q", rep.Total.Orders, rep.Currency)
+	}
+	byService, err := anon.Stats(ctx, "delivery_service", client.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, row := range byService.Rows {
+		n += row.Orders
+	}
+	if n != len(orders) {
+		t.Errorf("по службам доставки %d заказов из %d", n, len(orders))
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"order-service-demo/client"
+)
+
+// === Команды администратора: кэш и очередь недоставленных сообщений ===
+
+func runCacheStats(args []string) error {
+	return cacheCommand("cache-stats", args, (*client.Client).CacheStats)
+}
+
+func runCacheReload(args []string) error {
+	return cacheCommand("cache-reload", args, (*client.Client).ReloadCache)
+}
+
+func cacheCommand(name string, args []string, call func(*client.Client, context.Context) (*client.CacheStats, error)) error {
+	var api apiOptions
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	api.register(fs)
+	fs.Usage = usageFor(fs, name+" [флаги]")
+	fs.Parse(args)
+
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	s, err := call(c, context.Background())
+	if err != nil {
+		return err
+	}
+
+	return api.print(s, func(w *tabwriter.Writer) {
+		hitRate := 0.0
+		if total := s.Hits + s.Misses; total > 0 {
+			hitRate = float64(s.Hits) / float64(total) * 100
+		}
+		if s.Instance != "" {
+			fmt.Fprintf(w, "экземпляр\t%s\n", s.Instance)
+		}
+		fmt.Fprintf(w, "заказов в кэше\t%d\n", s.Orders)
+		fmt.Fprintf(w, "товаров\t%d\n", s.Items)
+		fmt.Fprintf(w, "попадания / промахи\t%d / %d (%.1f%%)\n", s.Hits, s.Misses, hitRate)
+		fmt.Fprintf(w, "загружен из БД\t%s за %d мс\n", s.LoadedAt.Local().Format(timeLayout), s.LoadDurationMs)
+	})
+}
+
+func runOutbox(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("outbox", flag.ExitOnError)
+	api.register(fs)
+	fs.Usage = usageFor(fs, "outbox [флаги]")
+	fs.Parse(args)
+
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	s, err := c.OutboxStats(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return api.print(s, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "ждут публикации\t%d\n", s.Pending)
+		if s.OldestPending != nil {
+			fmt.Fprintf(w, "самое старое\t%s\n", s.OldestPending.Local().Format(timeLayout))
+		}
+		if s.LastError != "" {
+			fmt.Fprintf(w, "ошибка публикации\t%s\n", s.LastError)
+		}
+		fmt.Fprintf(w, "опубликовано за сутки\t%d\n", s.Published24h)
+	})
+}
+
+func runDLQ(args []string) error {
+	if len(args) == 0 {
+		return errors.New("использование: orderctl dlq list|resubmit ...")
+	}
+	switch args[0] {
+	case "list":
+		return runDLQList(args[1:])
+	case "resubmit":
+		return runDLQResubmit(args[1:])
+	}
+	return fmt.Errorf("неизвестная команда dlq %q: нужна list или resubmit", args[0])
+}
+
+func runDLQList(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("dlq list", flag.ExitOnError)
+	api.register(fs)
+	all := fs.Bool("all", false, "вместе с уже переотправленными")
+	page := fs.Int("page", 1, "страница")
+	limit := fs.Int("limit", 50, "строк на странице")
+	fs.Usage = usageFor(fs, "dlq list [флаги]")
+	fs.Parse(args)
+
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	list, err := c.DeadLetters(context.Background(), *page, *limit, *all)
+	if err != nil {
+		return err
+	}
+
+	return api.print(list, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tПОЛУЧЕНО\tИСТОЧНИК\tORDER_UID\tПОПЫТОК\tПРИЧИНА")
+		for _, d := range list.Items {
+			reason := d.Reason
+			if d.ResubmittedAt != nil {
+				reason = "переотправлено " + d.ResubmittedAt.Local().Format(timeLayout)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n", d.ID, d.ReceivedAt.Local().Format(timeLayout),
+				d.Source, orDash(d.OrderUID), d.Attempts, truncate(reason, 80))
+		}
+		fmt.Fprintf(w, "\nВсего: %d\n", list.Total)
+	})
+}
+
+func runDLQResubmit(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("dlq resubmit", flag.ExitOnError)
+	api.register(fs)
+	file := fs.String("file", "", "исправленный заказ (JSON) вместо сохранённого сообщения")
+	fs.Usage = usageFor(fs, "dlq resubmit [флаги] ID ...")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("не указаны id сообщений")
+	}
+	if *file != "" && fs.NArg() > 1 {
+		return errors.New("-file можно указать только для одного сообщения")
+	}
+
+	var payload []byte
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		payload = data
+	}
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("некорректный id %q", arg)
+		}
+		s, err := c.ResubmitDeadLetter(context.Background(), id, payload)
+		if err != nil {
+			failed++
+			fmt.Printf("✗ %d: %v\n", id, err)
+			continue
+		}
+		fmt.Printf("✓ %d: заказ %s принят\n", id, s.OrderUID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("не принято сообщений: %d", failed)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// runErase стирает контакты получателя в заказах покупателя. Без -y сначала
+// показывает затронутые заказы (dry run) и спрашивает подтверждение.
+func runErase(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("erase", flag.ExitOnError)
+	api.register(fs)
+	reason := fs.String("reason", "", "основание удаления, например номер обращения (обязательно)")
+	dryRun := fs.Bool("dry-run", false, "только показать затронутые заказы")
+	yes := fs.Bool("y", false, "не спрашивать подтверждение")
+	fs.Usage = usageFor(fs, "erase [флаги] CUSTOMER_ID")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("нужен один customer_id")
+	}
+	if *reason == "" && !*dryRun {
+		return errors.New("-reason: укажите основание удаления")
+	}
+	customerID := fs.Arg(0)
+
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if *dryRun || !*yes {
+		rep, err := c.EraseCustomer(ctx, customerID, *reason, true)
+		if err != nil {
+			return err
+		}
+		if *dryRun {
+			return printErasure(&api, rep)
+		}
+		if !confirm(fmt.Sprintf("Стереть контакты покупателя %s в %d заказах?", customerID, len(rep.Orders))) {
+			return errors.New("отменено")
+		}
+	}
+	rep, err := c.EraseCustomer(ctx, customerID, *reason, false)
+	if err != nil {
+		return err
+	}
+	return printErasure(&api, rep)
+}
+
+func printErasure(api *apiOptions, rep *client.ErasureReport) error {
+	return api.print(rep, func(w *tabwriter.Writer) {
+		verb := "стёрты"
+		if rep.DryRun {
+			verb = "будут стёрты"
+		}
+		fmt.Fprintf(w, "Покупатель %s: контакты %s в %d заказах\n", rep.CustomerID, verb, len(rep.Orders))
+		for _, uid := range rep.Orders {
+			fmt.Fprintf(w, "  %s\n", uid)
+		}
+		if rep.Archived > 0 {
+			fmt.Fprintf(w, "из них в архиве\t%d\n", rep.Archived)
+		}
+		if rep.AlreadyErased > 0 {
+			fmt.Fprintf(w, "обезличены раньше\t%d\n", rep.AlreadyErased)
+		}
+		fmt.Fprintf(w, "сообщений DLQ\t%d\n", rep.DeadLetters)
+		if rep.AuditID > 0 {
+			fmt.Fprintf(w, "запись аудита\t#%d\n", rep.AuditID)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+
+	"order-service-demo/client"
+)
+
+// === Конфигурация: адреса и токены по профилям ===
+//
+// ~/.config/orderctl/config.yaml (или -config, ORDERCTL_CONFIG):
+//
+//	current: local
+//	profiles:
+//	  local:
+//	    url: http://localhost:8080
+//	    token: secret
+//	    nats: nats://localhost:4223
+//	    cluster: test-cluster
+//	  stage:
+//	    url: https://orders.stage.example.com
+//
+// Значения берутся в порядке: флаг, переменная окружения, профиль, умолчание.
+
+type profile struct {
+	URL     string `yaml:"url"`
+	Token   string `yaml:"token"`
+	NATS    string `yaml:"nats"`
+	Cluster string `yaml:"cluster"`
+	Subject string `yaml:"subject"`
+}
+
+type configFile struct {
+	Current  string             `yaml:"current"`
+	Profiles map[string]profile `yaml:"profiles"`
+}
+
+type configOptions struct {
+	path    string
+	profile string
+}
+
+func (o *configOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.path, "config", os.Getenv("ORDERCTL_CONFIG"), "файл конфигурации (по умолчанию ~/.config/orderctl/config.yaml)")
+	fs.StringVar(&o.profile, "profile", os.Getenv("ORDERCTL_PROFILE"), "профиль из файла конфигурации")
+}
+
+// load читает выбранный профиль. Отсутствие файла по умолчанию — не ошибка.
+func (o *configOptions) load() (profile, error) {
+	path, explicit := o.path, o.path != ""
+	if !explicit {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return profile{}, nil
+		}
+		path = filepath.Join(dir, "orderctl", "config.yaml")
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		if o.profile != "" {
+			return profile{}, fmt.Errorf("профиль %q не найден: нет файла %s", o.profile, path)
+		}
+		return profile{}, nil
+	}
+	if err != nil {
+		return profile{}, err
+	}
+
+	var cfg configFile
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return profile{}, fmt.Errorf("%s: %w", path, err)
+	}
+	name := o.profile
+	if name == "" {
+		name = cfg.Current
+	}
+	if name == "" {
+		name = "default"
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok && (o.profile != "" || cfg.Current != "") {
+		return profile{}, fmt.Errorf("%s: нет профиля %q", path, name)
+	}
+	return p, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// apiOptions — профиль, адрес HTTP API, токен и формат вывода.
+type apiOptions struct {
+	config configOptions
+	url    string
+	token  string
+	output string
+}
+
+func (o *apiOptions) register(fs *flag.FlagSet) {
+	o.config.register(fs)
+	fs.StringVar(&o.url, "url", "", "адрес HTTP API (ORDERCTL_URL, по умолчанию http://localhost:8080)")
+	fs.StringVar(&o.token, "token", "", "токен администратора (ADMIN_TOKEN)")
+	fs.StringVar(&o.output, "o", "table", "формат вывода: table, json или yaml")
+}
+
+func (o *apiOptions) client() (*client.Client, error) {
+	switch o.output {
+	case "table", "json", "yaml":
+	default:
+		return nil, fmt.Errorf("неизвестный формат вывода %q", o.output)
+	}
+	p, err := o.config.load()
+	if err != nil {
+		return nil, err
+	}
+	url := firstNonEmpty(o.url, os.Getenv("ORDERCTL_URL"), p.URL, "http://localhost:8080")
+	token := firstNonEmpty(o.token, os.Getenv("ADMIN_TOKEN"), p.Token)
+	return client.New(url, client.WithToken(token))
+}
+
+// print выводит v в выбранном формате; table рисует таблицу для формата table.
+func (o *apiOptions) print(v any, table func(w *tabwriter.Writer)) error {
+	switch o.output {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Printf("%s\n", data)
+		return err
+	case "yaml":
+		data, err := toYAML(v)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// toYAML кодирует v через JSON, чтобы YAML использовал те же имена полей
+// и тот же порядок, что и API.
+func toYAML(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// blockStyle снимает с узлов стиль JSON ({...}, "..."): кавычки останутся
+// только там, где без них значение прочиталось бы иначе.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
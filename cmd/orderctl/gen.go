@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runGen печатает сгенерированные заказы в NDJSON, например для
+// orderctl gen -n 1000 | orderctl publish -force -
+func runGen(args []string) error {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	n := fs.Int("n", 10, "сколько заказов сгенерировать")
+	invalid := fs.Float64("invalid", 0, "доля заведомо некорректных заказов, 0..1")
+	seed := fs.Uint64("seed", 0, "seed генератора; 0 — случайный")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: orderctl gen [флаги] > orders.ndjson")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *n <= 0 {
+		return errors.New("-n должно быть больше нуля")
+	}
+	if *invalid < 0 || *invalid > 1 {
+		return errors.New("-invalid должно быть от 0 до 1")
+	}
+	if *seed == 0 {
+		*seed = uint64(time.Now().UnixNano())
+	}
+
+	g := newOrderGenerator(*seed, *invalid)
+	w := bufio.NewWriter(os.Stdout)
+	for range *n {
+		w.Write(g.next().Raw)
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
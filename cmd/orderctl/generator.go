@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"order-service-demo/model"
+)
+
+// === Генератор правдоподобных заказов ===
+
+type person struct {
+	first, last string
+}
+
+var (
+	maleFirst   = []string{"Александр", "Дмитрий", "Максим", "Сергей", "Андрей", "Алексей", "Артём", "Илья", "Кирилл", "Михаил", "Никита", "Иван", "Егор", "Роман", "Павел"}
+	femaleFirst = []string{"Анна", "Мария", "Елена", "Ольга", "Наталья", "Татьяна", "Екатерина", "Юлия", "Дарья", "Ирина", "Светлана", "Полина", "Алина", "Ксения", "Виктория"}
+	// Фамилии в мужской форме; женская получается окончанием -а.
+	lastNames = []string{"Иванов", "Смирнов", "Кузнецов", "Попов", "Васильев", "Петров", "Соколов", "Михайлов", "Новиков", "Фёдоров", "Морозов", "Волков", "Алексеев", "Лебедев", "Семёнов", "Егоров", "Павлов", "Козлов", "Степанов", "Николаев"}
+)
+
+type city struct {
+	name, region, zip string // zip — первые три цифры индекса
+}
+
+var cities = []city{
+	{"Москва", "Москва", "101"},
+	{"Санкт-Петербург", "Санкт-Петербург", "190"},
+	{"Новосибирск", "Новосибирская область", "630"},
+	{"Екатеринбург", "Свердловская область", "620"},
+	{"Казань", "Республика Татарстан", "420"},
+	{"Нижний Новгород", "Нижегородская область", "603"},
+	{"Челябинск", "Челябинская область", "454"},
+	{"Самара", "Самарская область", "443"},
+	{"Уфа", "Республика Башкортостан", "450"},
+	{"Ростов-на-Дону", "Ростовская область", "344"},
+	{"Краснодар", "Краснодарский край", "350"},
+	{"Омск", "Омская область", "644"},
+	{"Воронеж", "Воронежская область", "394"},
+	{"Пермь", "Пермский край", "614"},
+	{"Красноярск", "Красноярский край", "660"},
+	{"Владивосток", "Приморский край", "690"},
+	{"Калининград", "Калининградская область", "236"},
+	{"Тюмень", "Тюменская область", "625"},
+}
+
+var streets = []string{"ул. Ленина", "ул. Советская", "ул. Мира", "ул. Гагарина", "ул. Пушкина", "ул. Садовая", "ул. Лесная", "ул. Молодёжная", "пр-т Победы", "пр-т Мира", "ул. Кирова", "ул. Набережная", "ул. Центральная", "ул. Школьная"}
+
+type product struct {
+	brand, name string
+	sizes       []string
+	price       [2]int // диапазон цены в рублях
+}
+
+var products = []product{
+	{"Vivienne Sabo", "Тушь для ресниц", []string{"0"}, [2]int{300, 700}},
+	{"L'Oreal Paris", "Шампунь для волос", []string{"250 мл", "400 мл"}, [2]int{350, 900}},
+	{"Levi's", "Джинсы 501", []string{"28", "30", "32", "34", "36"}, [2]int{4500, 9000}},
+	{"Zara", "Футболка базовая", []string{"XS", "S", "M", "L", "XL"}, [2]int{900, 2500}},
+	{"Nike", "Кроссовки Air Max", []string{"39", "40", "41", "42", "43", "44"}, [2]int{7000, 16000}},
+	{"Adidas", "Худи с капюшоном", []string{"S", "M", "L", "XL"}, [2]int{3500, 8000}},
+	{"LEGO", "Конструктор City", []string{"0"}, [2]int{1500, 12000}},
+	{"Hasbro", "Настольная игра Монополия", []string{"0"}, [2]int{1800, 3500}},
+	{"Tiger Family", "Рюкзак школьный", []string{"0"}, [2]int{4000, 9000}},
+	{"Samsung", "Наушники Galaxy Buds", []string{"0"}, [2]int{6000, 14000}},
+	{"Xiaomi", "Фитнес-браслет", []string{"0"}, [2]int{2500, 5000}},
+	{"Tefal", "Сковорода 26 см", []string{"26"}, [2]int{2000, 5500}},
+	{"IKEA", "Плед флисовый", []string{"130x170"}, [2]int{600, 1500}},
+	{"Lipton", "Чай чёрный 100 пак.", []string{"0"}, [2]int{250, 450}},
+	{"Gloria Jeans", "Платье трикотажное", []string{"XS", "S", "M", "L"}, [2]int{1300, 3000}},
+}
+
+var (
+	deliveryServices = []string{"meest", "cdek", "boxberry", "pochta", "dpd", "wb"}
+	banks            = []string{"сбербанк", "т-банк", "альфа-банк", "втб", "газпромбанк", "райффайзенбанк"}
+	providers        = []string{"wbpay", "wbpay", "wbpay", "sbp", "card"}
+	emailDomains     = []string{"mail.ru", "yandex.ru", "gmail.com", "bk.ru", "inbox.ru"}
+	itemStatuses     = []int{202, 202, 202, 200, 201}
+)
+
+// generatedOrder — сгенерированный заказ и тело сообщения. Для заведомо
+// некорректных заказов Valid == false, а Defect объясняет, что испорчено.
+type generatedOrder struct {
+	Order  model.Order
+	Raw    []byte
+	Valid  bool
+	Defect string
+}
+
+type orderGenerator struct {
+	rnd         *rand.Rand
+	invalidRate float64
+	now         func() time.Time
+}
+
+// newOrderGenerator создаёт генератор. При одинаковом seed (и одинаковом
+// времени) последовательность заказов повторяется.
+func newOrderGenerator(seed uint64, invalidRate float64) *orderGenerator {
+	return &orderGenerator{
+		rnd:         rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)),
+		invalidRate: invalidRate,
+		now:         time.Now,
+	}
+}
+
+func (g *orderGenerator) pick(list []string) string {
+	return list[g.rnd.IntN(len(list))]
+}
+
+func (g *orderGenerator) between(lo, hi int) int {
+	return lo + g.rnd.IntN(hi-lo+1)
+}
+
+func (g *orderGenerator) hex(n int) string {
+	b := make([]byte, (n+1)/2)
+	for i := range b {
+		b[i] = byte(g.rnd.UintN(256))
+	}
+	return hex.EncodeToString(b)[:n]
+}
+
+func (g *orderGenerator) upper(n int) string {
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[g.rnd.IntN(len(letters))]
+	}
+	return string(b)
+}
+
+func (g *orderGenerator) person() person {
+	last := lastNames[g.rnd.IntN(len(lastNames))]
+	if g.rnd.IntN(2) == 0 {
+		return person{g.pick(maleFirst), last}
+	}
+	return person{g.pick(femaleFirst), last + "а"}
+}
+
+// phone выдаёт мобильный номер в одном из распространённых написаний.
+func (g *orderGenerator) phone() string {
+	code := g.between(900, 999)
+	a, b, c := g.between(0, 999), g.between(0, 99), g.between(0, 99)
+	switch g.rnd.IntN(3) {
+	case 0:
+		return fmt.Sprintf("+7 (%d) %03d-%02d-%02d", code, a, b, c)
+	case 1:
+		return fmt.Sprintf("+7%d%03d%02d%02d", code, a, b, c)
+	default:
+		return fmt.Sprintf("8 %d %03d-%02d-%02d", code, a, b, c)
+	}
+}
+
+func (g *orderGenerator) email(p person) string {
+	local := translit(p.first)[:1] + "." + translit(p.last)
+	if g.rnd.IntN(2) == 0 {
+		local += fmt.Sprint(g.between(1970, 2008))
+	}
+	return local + "@" + g.pick(emailDomains)
+}
+
+// next возвращает очередной заказ; с вероятностью invalidRate — испорченный.
+func (g *orderGenerator) next() generatedOrder {
+	order := g.validOrder()
+	if g.invalidRate > 0 && g.rnd.Float64() < g.invalidRate {
+		return g.spoil(order)
+	}
+	raw, _ := json.Marshal(order)
+	return generatedOrder{Order: order, Raw: raw, Valid: true}
+}
+
+func (g *orderGenerator) validOrder() model.Order {
+	uid := g.hex(16) + "test"
+	track := "WBIL" + g.upper(10)
+	p := g.person()
+	c := cities[g.rnd.IntN(len(cities))]
+	created := g.now().UTC().Add(-time.Duration(g.rnd.IntN(3600)) * time.Second).Truncate(time.Second)
+
+	order := model.Order{
+		OrderUID:    uid,
+		TrackNumber: track,
+		Entry:       "WBIL",
+		Delivery: model.Delivery{
+			Name:    p.first + " " + p.last,
+			Phone:   g.phone(),
+			Zip:     fmt.Sprintf("%s%03d", c.zip, g.between(0, 999)),
+			City:    c.name,
+			Address: fmt.Sprintf("%s, д. %d, кв. %d", g.pick(streets), g.between(1, 150), g.between(1, 300)),
+			Region:  c.region,
+			Email:   g.email(p),
+		},
+		Locale:          "ru",
+		CustomerID:      fmt.Sprintf("cust%05d", g.between(1, 5000)), // постоянные покупатели повторяются
+		DeliveryService: g.pick(deliveryServices),
+		Shardkey:        fmt.Sprint(g.between(0, 9)),
+		SmID:            g.between(1, 100),
+		DateCreated:     created,
+		OofShard:        fmt.Sprint(g.between(1, 2)),
+	}
+
+	// Суммы согласованы и считаются в копейках: total_price = price с учётом
+	// скидки, goods_total — сумма total_price, amount = goods_total + доставка + сбор.
+	var goods int64
+	for range g.between(1, 5) {
+		pr := products[g.rnd.IntN(len(products))]
+		price := int64(g.between(pr.price[0], pr.price[1])) * 100
+		sale := []int{0, 0, 10, 15, 20, 30, 50}[g.rnd.IntN(7)]
+		total := price * int64(100-sale) / 100
+		goods += total
+		order.Items = append(order.Items, model.Item{
+			ChrtID:      int64(g.between(1000000, 9999999)),
+			TrackNumber: track,
+			Price:       model.FromMinor(price, "RUB"),
+			Rid:         g.hex(20) + "test",
+			Name:        pr.name,
+			Sale:        sale,
+			Size:        pr.sizes[g.rnd.IntN(len(pr.sizes))],
+			TotalPrice:  model.FromMinor(total, "RUB"),
+			NmID:        int64(g.between(1000000, 9999999)),
+			Brand:       pr.brand,
+			Status:      itemStatuses[g.rnd.IntN(len(itemStatuses))],
+		})
+	}
+
+	var deliveryCost int64
+	if goods < 3000_00 {
+		deliveryCost = []int64{0, 99_00, 199_00, 299_00}[g.rnd.IntN(4)]
+	}
+	order.Payment = model.Payment{
+		Transaction:  uid,
+		Currency:     "RUB",
+		Provider:     g.pick(providers),
+		Amount:       model.FromMinor(goods+deliveryCost, "RUB"),
+		PaymentDt:    created.Unix(),
+		Bank:         g.pick(banks),
+		DeliveryCost: model.FromMinor(deliveryCost, "RUB"),
+		GoodsTotal:   model.FromMinor(goods, "RUB"),
+		CustomFee:    model.FromMinor(0, "RUB"),
+	}
+	return order
+}
+
+// spoil портит заказ так, чтобы сервис его отклонил.
+func (g *orderGenerator) spoil(order model.Order) generatedOrder {
+	gen := generatedOrder{Order: order}
+	switch g.rnd.IntN(7) {
+	case 0:
+		gen.Order.OrderUID = ""
+		gen.Defect = "нет order_uid"
+	case 1:
+		gen.Order.OrderUID = strings.Repeat(order.OrderUID, 6)
+		gen.Defect = "слишком длинный order_uid"
+	case 2:
+		gen.Order.Delivery.Name = ""
+		gen.Defect = "нет имени получателя"
+	case 3:
+		gen.Order.Items = nil
+		gen.Defect = "нет товаров"
+	case 4:
+		gen.Order.Payment.Amount.Minor = -gen.Order.Payment.Amount.Minor
+		gen.Defect = "отрицательная сумма"
+	case 5:
+		// Суммы остаются в рублях, а код валюты — устаревший, не из ISO 4217
+		gen.Order.Payment.Currency = "RUR"
+		gen.Defect = "неизвестная валюта"
+	default:
+		raw, _ := json.Marshal(order)
+		gen.Raw = raw[:len(raw)/2]
+		gen.Defect = "обрезанный JSON"
+		return gen
+	}
+	gen.Raw, _ = json.Marshal(gen.Order)
+	return gen
+}
+
+var translitTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+func translit(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if t, ok := translitTable[r]; ok {
+			b.WriteString(t)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"order-service-demo/client"
+)
+
+// === import: массовая загрузка заказов из архивов ===
+// Файлы читаются по порциям (-chunk заказов на запрос) и отправляются в
+// POST /admin/import. После каждой порции в -checkpoint записывается,
+// сколько заказов каждого файла уже обработано; повторный запуск с тем же
+// файлом продолжает с этого места. Сервис пропускает известные order_uid,
+// так что порция, отправленная дважды, ничего не задвоит.
+
+type importOptions struct {
+	api        apiOptions
+	batch      int
+	chunk      int
+	noCache    bool
+	reportPath string
+	checkpoint string
+}
+
+// importCheckpoint — состояние импорта между запусками.
+type importCheckpoint struct {
+	Files     map[string]*checkpointFile `json:"files"`
+	Imported  int                        `json:"imported"`
+	Skipped   int                        `json:"skipped"`
+	Failed    int                        `json:"failed"`
+	UpdatedAt time.Time                  `json:"updated_at"`
+}
+
+type checkpointFile struct {
+	Records int  `json:"records"` // обработано заказов с начала файла
+	Done    bool `json:"done"`
+}
+
+func loadCheckpoint(path string) (*importCheckpoint, bool, error) {
+	cp := &importCheckpoint{Files: map[string]*checkpointFile{}}
+	if path == "" {
+		return cp, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, false, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if cp.Files == nil {
+		cp.Files = map[string]*checkpointFile{}
+	}
+	return cp, true, nil
+}
+
+// save пишет checkpoint через временный файл, чтобы обрыв не оставил
+// его недописанным.
+func (cp *importCheckpoint) save(path string) error {
+	if path == "" {
+		return nil
+	}
+	cp.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func samePath(a, b string) bool {
+	if a == "-" || b == "" {
+		return false
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// importLine — строка отчёта -report (NDJSON).
+type importLine struct {
+	Source   string `json:"source"`
+	OrderUID string `json:"order_uid,omitempty"`
+	Status   string `json:"status"` // imported, skipped, failed
+	Reason   string `json:"reason,omitempty"`
+}
+
+func runImport(args []string) error {
+	var o importOptions
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	o.api.register(fs)
+	fs.IntVar(&o.batch, "batch", 500, "заказов в одной транзакции на сервере")
+	fs.IntVar(&o.chunk, "chunk", 5000, "заказов в одном запросе")
+	fs.BoolVar(&o.noCache, "no-cache", false, "не добавлять заказы в кэш сервиса (потом orderctl cache-reload)")
+	fs.StringVar(&o.reportPath, "report", "", "файл отчёта NDJSON: строка на каждый заказ со статусом")
+	fs.StringVar(&o.checkpoint, "checkpoint", "", "файл checkpoint; если он есть, импорт продолжается с него")
+	fs.Usage = usageFor(fs, "import [флаги] ФАЙЛ|КАТАЛОГ|- ...")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("не указаны файлы с заказами")
+	}
+	if o.chunk < 1 {
+		return errors.New("-chunk должен быть больше нуля")
+	}
+
+	files, err := expandPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	// checkpoint и отчёт могут лежать в том же каталоге, что и архивы
+	files = slices.DeleteFunc(files, func(f string) bool {
+		return samePath(f, o.checkpoint) || samePath(f, o.reportPath)
+	})
+	c, err := o.api.client()
+	if err != nil {
+		return err
+	}
+	cp, resumed, err := loadCheckpoint(o.checkpoint)
+	if err != nil {
+		return err
+	}
+	if resumed {
+		fmt.Fprintf(os.Stderr, "Продолжение с %s (от %s)\n", o.checkpoint, cp.UpdatedAt.Local().Format(timeLayout))
+	}
+
+	var report *json.Encoder
+	if o.reportPath != "" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if resumed {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		f, err := os.OpenFile(o.reportPath, flags, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		report = json.NewEncoder(f)
+	}
+
+	imp := &chunkImporter{opts: o, client: c, cp: cp, report: report}
+	for _, name := range files {
+		if err := imp.file(name); err != nil {
+			fmt.Printf("Импортировано: %d, пропущено: %d, ошибок: %d\n", cp.Imported, cp.Skipped, cp.Failed)
+			if o.checkpoint != "" {
+				return fmt.Errorf("%w\nповторите команду с -checkpoint %s, чтобы продолжить", err, o.checkpoint)
+			}
+			return err
+		}
+	}
+
+	fmt.Printf("Импортировано: %d, пропущено (уже были): %d, ошибок: %d\n", cp.Imported, cp.Skipped, cp.Failed)
+	if o.noCache && cp.Imported > 0 {
+		fmt.Println("Заказы не попали в кэш: выполните orderctl cache-reload")
+	}
+	if cp.Failed > 0 {
+		return fmt.Errorf("не импортировано заказов: %d", cp.Failed)
+	}
+	return nil
+}
+
+// chunkImporter набирает порцию заказов из файла и отправляет её.
+type chunkImporter struct {
+	opts   importOptions
+	client *client.Client
+	cp     *importCheckpoint
+	report *json.Encoder
+
+	state   *checkpointFile
+	records int           // прочитано заказов файла
+	chunk   []sourceOrder // порция к отправке
+	body    bytes.Buffer
+}
+
+func (im *chunkImporter) file(name string) error {
+	im.state = im.cp.Files[name]
+	if im.state == nil {
+		im.state = &checkpointFile{}
+		im.cp.Files[name] = im.state
+	}
+	if im.state.Done {
+		fmt.Fprintf(os.Stderr, "%s: уже импортирован, пропускаем\n", name)
+		return nil
+	}
+	im.records, im.chunk = 0, im.chunk[:0]
+
+	err := readOrdersFile(name, func(so sourceOrder) error {
+		im.records++
+		if im.records <= im.state.Records {
+			return nil // обработан в прошлый запуск
+		}
+		im.chunk = append(im.chunk, so)
+		if len(im.chunk) >= im.opts.chunk {
+			return im.send(name)
+		}
+		return nil
+	})
+	if err == nil {
+		err = im.send(name)
+	}
+	if err != nil {
+		return err
+	}
+	im.state.Done = true
+	return im.cp.save(im.opts.checkpoint)
+}
+
+// send отправляет порцию и сдвигает checkpoint за её конец.
+func (im *chunkImporter) send(name string) error {
+	if len(im.chunk) == 0 {
+		return nil
+	}
+	lines := make([]importLine, len(im.chunk))
+	var sent []int // индексы порции в порядке отправки
+	im.body.Reset()
+	for i, so := range im.chunk {
+		lines[i] = importLine{Source: so.Source, OrderUID: so.Order.OrderUID, Status: "imported"}
+		if so.Err != nil {
+			lines[i].Status, lines[i].Reason = "failed", "невалидный JSON: "+so.Err.Error()
+			continue
+		}
+		sent = append(sent, i)
+		im.body.Write(so.Raw)
+		im.body.WriteByte('\n')
+	}
+
+	if len(sent) > 0 {
+		rep, err := im.client.ImportOrders(context.Background(), im.body.Bytes(),
+			client.ImportOptions{Batch: im.opts.batch, SkipCache: im.opts.noCache})
+		if err != nil {
+			return fmt.Errorf("%s: порция до заказа %d не отправлена: %w", name, im.records, err)
+		}
+		if rep.Error != "" || rep.Records != len(sent) {
+			return fmt.Errorf("%s: сервис обработал %d из %d заказов порции: %s", name, rep.Records, len(sent), rep.Error)
+		}
+		for _, r := range rep.Skipped {
+			l := &lines[sent[r.Record-1]]
+			l.Status, l.Reason = "skipped", r.Reason
+		}
+		for _, r := range rep.Failed {
+			l := &lines[sent[r.Record-1]]
+			l.Status, l.Reason = "failed", r.Reason
+		}
+	}
+
+	for _, l := range lines {
+		switch l.Status {
+		case "imported":
+			im.cp.Imported++
+		case "skipped":
+			im.cp.Skipped++
+		case "failed":
+			im.cp.Failed++
+			fmt.Printf("✗ %s (%s): %s\n", l.Source, orDash(l.OrderUID), l.Reason)
+		}
+		if im.report != nil {
+			if err := im.report.Encode(l); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s: обработано %d заказов\n", name, im.records)
+
+	im.chunk = im.chunk[:0]
+	im.state.Records = im.records
+	return im.cp.save(im.opts.checkpoint)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"text/tabwriter"
+)
+
+// === keys: ключи шифрования контактов получателя ===
+// Ротация: добавить в PII_KEYFILE ключ со следующей версией, перезапустить
+// все экземпляры сервиса, выполнить keys rotate и, когда keys status
+// покажет строки только с новой версией, удалить старый ключ из файла.
+
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return errors.New("использование: orderctl keys status|rotate ...")
+	}
+	switch args[0] {
+	case "status":
+		return runKeysStatus(args[1:])
+	case "rotate":
+		return runKeysRotate(args[1:])
+	}
+	return fmt.Errorf("неизвестная команда keys %q: нужна status или rotate", args[0])
+}
+
+func runKeysStatus(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("keys status", flag.ExitOnError)
+	api.register(fs)
+	fs.Usage = usageFor(fs, "keys status [флаги]")
+	fs.Parse(args)
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	st, err := c.KeyStatus(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return api.print(st, func(w *tabwriter.Writer) {
+		if st.Enabled {
+			fmt.Fprintf(w, "Шифрование включено, активный ключ v%d, ключи %v\n\n", st.ActiveVersion, st.Versions)
+		} else {
+			fmt.Fprintln(w, "Шифрование выключено (PII_KEYFILE не задан)")
+			fmt.Fprintln(w)
+		}
+		seen := map[string]bool{}
+		var versions []string
+		for _, m := range []map[string]int{st.Rows, st.Archive, st.DeadLetters} {
+			for v := range m {
+				if !seen[v] {
+					seen[v] = true
+					versions = append(versions, v)
+				}
+			}
+		}
+		sort.Strings(versions)
+		fmt.Fprintln(w, "КЛЮЧ\tСТРОК\tВ АРХИВЕ\tВ DLQ")
+		for _, v := range versions {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", v, st.Rows[v], st.Archive[v], st.DeadLetters[v])
+		}
+	})
+}
+
+func runKeysRotate(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("keys rotate", flag.ExitOnError)
+	api.register(fs)
+	fs.Usage = usageFor(fs, "keys rotate [флаги]")
+	fs.Parse(args)
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	rep, err := c.RotateKeys(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if err := api.print(rep, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "✓ перешифровано %d строк ключом v%d за %d мс\n", rep.Rotated, rep.ActiveVersion, rep.DurationMs)
+		for _, uid := range rep.Failed {
+			fmt.Fprintf(w, "✗ %s: не удалось расшифровать, подробности в логе сервиса\n", uid)
+		}
+	}); err != nil {
+		return err
+	}
+	if len(rep.Failed) > 0 {
+		return fmt.Errorf("%d строк не перешифрованы", len(rep.Failed))
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"time"
+
+	"order-service-demo/client"
+)
+
+// === Нагрузочный режим ===
+// Заказы из генератора отправляются с заданной частотой в NATS или в
+// POST /orders, после чего каждый корректный заказ опрашивается через
+// GET /order/{uid}. Задержка — от начала отправки до первого ответа 200.
+
+type loadOptions struct {
+	config      configOptions
+	nats        natsOptions
+	target      string
+	baseURL     string
+	token       string
+	rate        float64
+	duration    time.Duration
+	count       int
+	invalid     float64
+	seed        uint64
+	visTimeout  time.Duration
+	poll        time.Duration
+	maxInFlight int
+}
+
+// loadStats — счётчики прогона; обновляются из горутин отправки.
+type loadStats struct {
+	mu          sync.Mutex
+	sent        int
+	invalidSent int
+	sendErrors  int
+	rejected    int // некорректные заказы, отклонённые POST /orders
+	accepted    int // некорректные заказы, которые сервис всё же принял
+	visible     int
+	timeouts    int
+	inFlight    int
+	latencies   []time.Duration
+	lastError   error
+}
+
+func (s *loadStats) update(fn func(s *loadStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+func runLoad(args []string) error {
+	var o loadOptions
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	o.config.register(fs)
+	o.nats.register(fs)
+	fs.StringVar(&o.target, "target", "nats", "куда отправлять: nats или http")
+	fs.StringVar(&o.baseURL, "url", "", "адрес HTTP API (ORDERCTL_URL, по умолчанию http://localhost:8080)")
+	fs.StringVar(&o.token, "token", "", "токен администратора для POST /orders (ADMIN_TOKEN)")
+	fs.Float64Var(&o.rate, "rate", 50, "заказов в секунду")
+	fs.DurationVar(&o.duration, "duration", 30*time.Second, "длительность прогона")
+	fs.IntVar(&o.count, "n", 0, "остановиться после n заказов (0 — по -duration)")
+	fs.Float64Var(&o.invalid, "invalid", 0, "доля заведомо некорректных заказов, 0..1")
+	fs.Uint64Var(&o.seed, "seed", 0, "seed генератора; 0 — случайный")
+	fs.DurationVar(&o.visTimeout, "visibility-timeout", 10*time.Second, "сколько ждать появления заказа в /order/{uid}")
+	fs.DurationVar(&o.poll, "poll", 20*time.Millisecond, "интервал опроса /order/{uid}")
+	fs.IntVar(&o.maxInFlight, "max-inflight", 1000, "сколько заказов одновременно отправляется и ожидается")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: orderctl load [флаги]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	prof, err := o.config.load()
+	if err != nil {
+		return err
+	}
+	o.nats.apply(prof)
+	o.baseURL = firstNonEmpty(o.baseURL, os.Getenv("ORDERCTL_URL"), prof.URL, "http://localhost:8080")
+	o.token = firstNonEmpty(o.token, os.Getenv("ADMIN_TOKEN"), prof.Token)
+
+	switch {
+	case o.target != "nats" && o.target != "http":
+		return errors.New("-target должен быть nats или http")
+	case o.rate <= 0:
+		return errors.New("-rate должно быть больше нуля")
+	case o.invalid < 0 || o.invalid > 1:
+		return errors.New("-invalid должно быть от 0 до 1")
+	case o.maxInFlight <= 0:
+		return errors.New("-max-inflight должно быть больше нуля")
+	}
+	if o.seed == 0 {
+		o.seed = uint64(time.Now().UnixNano())
+	}
+
+	hc := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{MaxIdleConnsPerHost: o.maxInFlight},
+	}
+	api, err := client.New(o.baseURL, client.WithHTTPClient(hc), client.WithToken(o.token), client.WithRetries(0, 0, 0))
+	if err != nil {
+		return err
+	}
+
+	var send func(ctx context.Context, g generatedOrder) error
+	switch o.target {
+	case "nats":
+		sc, err := o.nats.connect(o.visTimeout)
+		if err != nil {
+			return err
+		}
+		defer sc.Close()
+		send = func(ctx context.Context, g generatedOrder) error {
+			return sc.Publish(o.nats.subject, g.Raw)
+		}
+	case "http":
+		send = func(ctx context.Context, g generatedOrder) error {
+			_, err := api.CreateOrderRaw(ctx, g.Raw)
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var st loadStats
+	gen := newOrderGenerator(o.seed, o.invalid)
+	sem := make(chan struct{}, o.maxInFlight)
+	var wg sync.WaitGroup
+
+	progress := time.NewTicker(time.Second)
+	defer progress.Stop()
+
+	interval := time.Duration(float64(time.Second) / o.rate)
+	start := time.Now()
+	deadline := start.Add(o.duration)
+	fmt.Fprintf(os.Stderr, "Нагрузка: %s, %.0f заказов/с, seed=%d\n", o.target, o.rate, o.seed)
+
+send:
+	for i := 0; o.count == 0 || i < o.count; i++ {
+		// Время отправки считается от старта, а не от предыдущего заказа,
+		// чтобы задержки планировщика не снижали частоту.
+		at := start.Add(time.Duration(i) * interval)
+		if o.count == 0 && !at.Before(deadline) {
+			break
+		}
+		if wait := time.Until(at); wait > 0 {
+			select {
+			case <-ctx.Done():
+				break send
+			case <-progress.C:
+				printLoadProgress(&st, start)
+				i--
+				continue
+			case <-time.After(wait):
+			}
+		}
+		select {
+		case <-ctx.Done():
+			break send
+		case sem <- struct{}{}:
+		}
+
+		g := gen.next()
+		st.update(func(s *loadStats) { s.inFlight++ })
+		wg.Add(1)
+		go func() {
+			defer func() {
+				st.update(func(s *loadStats) { s.inFlight-- })
+				<-sem
+				wg.Done()
+			}()
+			runLoadOrder(ctx, &o, api, send, g, &st)
+		}()
+	}
+	elapsed := time.Since(start)
+
+	fmt.Fprintln(os.Stderr, "Отправка закончена, ждём появления заказов...")
+	wg.Wait()
+	printLoadReport(&o, &st, elapsed)
+
+	if st.sendErrors > 0 || st.timeouts > 0 || st.accepted > 0 {
+		return errors.New("прогон завершён с ошибками")
+	}
+	return nil
+}
+
+func runLoadOrder(ctx context.Context, o *loadOptions, api *client.Client, send func(context.Context, generatedOrder) error, g generatedOrder, st *loadStats) {
+	started := time.Now()
+	err := send(ctx, g)
+
+	var verr *client.ValidationError
+	switch {
+	case err != nil && !g.Valid && errors.As(err, &verr):
+		st.update(func(s *loadStats) { s.sent++; s.invalidSent++; s.rejected++ })
+		return
+	case err != nil:
+		st.update(func(s *loadStats) { s.sent++; s.sendErrors++; s.lastError = err })
+		return
+	case !g.Valid:
+		st.update(func(s *loadStats) {
+			s.sent++
+			s.invalidSent++
+			// Через NATS отказ не виден отправителю, а HTTP должен был вернуть 422
+			if o.target == "http" {
+				s.accepted++
+			}
+		})
+		return
+	}
+	st.update(func(s *loadStats) { s.sent++ })
+
+	// Ждём, пока заказ станет виден в /order/{uid}
+	deadline := started.Add(o.visTimeout)
+	for {
+		_, err := api.GetOrder(ctx, g.Order.OrderUID)
+		if err == nil {
+			latency := time.Since(started)
+			st.update(func(s *loadStats) { s.visible++; s.latencies = append(s.latencies, latency) })
+			return
+		}
+		if !errors.Is(err, client.ErrNotFound) {
+			st.update(func(s *loadStats) { s.lastError = err })
+		}
+		if time.Now().Add(o.poll).After(deadline) || ctx.Err() != nil {
+			st.update(func(s *loadStats) { s.timeouts++ })
+			return
+		}
+		time.Sleep(o.poll)
+	}
+}
+
+func printLoadProgress(st *loadStats, start time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	fmt.Fprintf(os.Stderr, "%6s: отправлено %d, видны %d, ошибок %d, ожидают %d\n",
+		time.Since(start).Truncate(time.Second), st.sent, st.visible, st.sendErrors+st.timeouts, st.inFlight)
+}
+
+func printLoadReport(o *loadOptions, st *loadStats, elapsed time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	fmt.Printf("Цель:                 %s, заданная частота %.1f/с, фактическая %.1f/с за %s\n",
+		o.target, o.rate, float64(st.sent)/elapsed.Seconds(), elapsed.Truncate(time.Millisecond))
+	fmt.Printf("Отправлено:           %d (из них некорректных: %d)\n", st.sent, st.invalidSent)
+	fmt.Printf("Ошибки отправки:      %d\n", st.sendErrors)
+	if o.target == "http" {
+		fmt.Printf("Некорректные заказы:  отклонено %d, принято по ошибке %d\n", st.rejected, st.accepted)
+	}
+	fmt.Printf("Видны в /order/{uid}: %d, не дождались за %s: %d\n", st.visible, o.visTimeout, st.timeouts)
+	if st.lastError != nil {
+		fmt.Printf("Последняя ошибка:     %v\n", st.lastError)
+	}
+
+	if len(st.latencies) == 0 {
+		return
+	}
+	slices.Sort(st.latencies)
+	var sum time.Duration
+	for _, l := range st.latencies {
+		sum += l
+	}
+	fmt.Printf("Задержка до видимости: min %s, p50 %s, p90 %s, p99 %s, max %s, среднее %s\n",
+		fmtLatency(st.latencies[0]),
+		fmtLatency(percentile(st.latencies, 0.50)),
+		fmtLatency(percentile(st.latencies, 0.90)),
+		fmtLatency(percentile(st.latencies, 0.99)),
+		fmtLatency(st.latencies[len(st.latencies)-1]),
+		fmtLatency(sum/time.Duration(len(st.latencies))))
+}
+
+// percentile по отсортированному ряду, метод ближайшего ранга.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func fmtLatency(d time.Duration) string {
+	return d.Round(100 * time.Microsecond).String()
+}
@@ -0,0 +1,85 @@
+// Команда orderctl — утилита для работы с сервисом заказов.
+//
+//	orderctl publish fixtures/            # отправить тестовые заказы в NATS
+//	orderctl publish -new-uid orders.ndjson
+//	orderctl gen -n 1000 -invalid 0.05 > orders.ndjson
+//	orderctl load -rate 200 -duration 1m     # нагрузка через NATS
+//
+//	orderctl search -o yaml Иванов
+//	orderctl dlq list
+//	orderctl import -checkpoint import.json archive/
+//	orderctl rates load XML_daily.xml
+//	orderctl keys rotate
+//	orderctl erase -reason "обращение 1234" customer42
+//	orderctl archive get 2024-01
+//	orderctl webhooks add -events order.saved https://partner.example/hooks
+//	orderctl shards rebalance
+//
+// Адреса и токены берутся из флагов, окружения или профиля в
+// ~/.config/orderctl/config.yaml. Подробности по командам: orderctl <команда> -h.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]command{
+	"publish": {"отправить заказы из JSON/NDJSON-файлов в NATS Streaming", runPublish},
+	"gen":     {"сгенерировать правдоподобные заказы в NDJSON", runGen},
+	"load":    {"нагрузка на сервис с замером задержки до появления заказа", runLoad},
+
+	"get":          {"показать заказ", runGet},
+	"list":         {"список заказов с фильтрами и сортировкой", runList},
+	"search":       {"поиск по order_uid, трек-номеру, customer_id и контактам", runSearch},
+	"delete":       {"удалить заказы из БД и кэша", runDelete},
+	"export":       {"выгрузить заказы в CSV, NDJSON или XLSX", runExport},
+	"import":       {"массовый импорт заказов из архивов с checkpoint", runImport},
+	"cache-stats":  {"состояние кэша сервиса", runCacheStats},
+	"cache-reload": {"перечитать кэш сервиса из БД", runCacheReload},
+	"dlq":          {"недоставленные сообщения: dlq list, dlq resubmit ID", runDLQ},
+	"outbox":       {"очередь событий order.* для NATS", runOutbox},
+	"rates":        {"курсы валют ЦБ: rates load ФАЙЛ, rates show", runRates},
+	"keys":         {"ключи шифрования контактов: keys status, keys rotate", runKeys},
+	"erase":        {"стереть контакты получателя во всех заказах покупателя", runErase},
+	"archive":      {"архив старых заказов: archive run, archive get YYYY-MM", runArchive},
+	"webhooks":     {"подписки на события о заказах: webhooks add, list, log, listen ...", runWebhooks},
+	"shards":       {"шарды хранилища заказов: shards status, shards rebalance", runShards},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Использование: orderctl <команда> [флаги] [аргументы]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Команды:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "orderctl: неизвестная команда %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "orderctl:", err)
+		os.Exit(1)
+	}
+}
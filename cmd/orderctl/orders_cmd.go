@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"order-service-demo/client"
+)
+
+// === Команды для заказов: get, list, search, delete, export ===
+
+const timeLayout = "2006-01-02 15:04"
+
+func runGet(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	api.register(fs)
+	fs.Usage = usageFor(fs, "get [флаги] ORDER_UID")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("нужен один order_uid")
+	}
+
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	order, err := c.GetOrder(context.Background(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return api.print(order, func(w *tabwriter.Writer) {
+		d, p := order.Delivery, order.Payment
+		fmt.Fprintf(w, "order_uid\t%s\n", order.OrderUID)
+		fmt.Fprintf(w, "track_number\t%s\n", order.TrackNumber)
+		fmt.Fprintf(w, "date_created\t%s\n", order.DateCreated.Local().Format(timeLayout))
+		fmt.Fprintf(w, "customer_id\t%s\n", order.CustomerID)
+		fmt.Fprintf(w, "delivery_service\t%s\n", order.DeliveryService)
+		fmt.Fprintf(w, "получатель\t%s, %s, %s\n", d.Name, d.Phone, d.Email)
+		fmt.Fprintf(w, "адрес\t%s, %s, %s, %s\n", d.Zip, d.Region, d.City, d.Address)
+		fmt.Fprintf(w, "оплата\t%s (товары %s, доставка %s, сбор %s), %s, %s\n",
+			p.Amount, p.GoodsTotal.Decimal(), p.DeliveryCost.Decimal(), p.CustomFee.Decimal(), p.Provider, p.Bank)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "ТОВАР\tБРЕНД\tРАЗМЕР\tЦЕНА\tСКИДКА\tИТОГО\tСТАТУС")
+		for _, it := range order.Items {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d%%\t%s\t%d\n", it.Name, it.Brand, it.Size, it.Price.Decimal(), it.Sale, it.TotalPrice.Decimal(), it.Status)
+		}
+	})
+}
+
+// listFlags — фильтры и параметры страницы, общие для list, search и export.
+type listFlags struct {
+	opts client.ListOptions
+	from string
+	to   string
+}
+
+func (l *listFlags) register(fs *flag.FlagSet, paging bool) {
+	fs.StringVar(&l.opts.CustomerID, "customer", "", "точное совпадение customer_id")
+	fs.StringVar(&l.opts.DeliveryService, "service", "", "точное совпадение delivery_service")
+	fs.StringVar(&l.opts.Currency, "currency", "", "валюта оплаты")
+	fs.StringVar(&l.from, "from", "", "начало периода: YYYY-MM-DD или RFC 3339")
+	fs.StringVar(&l.to, "to", "", "конец периода; дата без времени включает весь день")
+	if paging {
+		fs.StringVar(&l.opts.Sort, "sort", "", "поле сортировки: date_created, customer_id, delivery_service, item_count, amount, currency")
+		fs.BoolVar(&l.opts.Asc, "asc", false, "по возрастанию")
+		fs.IntVar(&l.opts.Page, "page", 1, "страница")
+		fs.IntVar(&l.opts.Limit, "limit", 20, "строк на странице")
+	}
+}
+
+func (l *listFlags) options() (client.ListOptions, error) {
+	var err error
+	if l.opts.From, _, err = parseDateFlag(l.from); err != nil {
+		return l.opts, fmt.Errorf("-from: %w", err)
+	}
+	var dateOnly bool
+	if l.opts.To, dateOnly, err = parseDateFlag(l.to); err != nil {
+		return l.opts, fmt.Errorf("-to: %w", err)
+	}
+	if dateOnly {
+		l.opts.To = l.opts.To.AddDate(0, 0, 1)
+	}
+	return l.opts, nil
+}
+
+// parseDateFlag разбирает дату так же, как сервис: день в UTC или RFC 3339.
+func parseDateFlag(v string) (t time.Time, dateOnly bool, err error) {
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, v)
+	return t, false, err
+}
+
+func runList(args []string) error {
+	return listOrders("list", args)
+}
+
+func runSearch(args []string) error {
+	return listOrders("search", args)
+}
+
+func listOrders(name string, args []string) error {
+	var api apiOptions
+	var lf listFlags
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	api.register(fs)
+	lf.register(fs, true)
+	if name == "search" {
+		fs.Usage = usageFor(fs, "search [флаги] СТРОКА")
+	} else {
+		fs.StringVar(&lf.opts.Query, "q", "", "поиск подстроки (как в search)")
+		fs.Usage = usageFor(fs, "list [флаги]")
+	}
+	fs.Parse(args)
+	var query string
+	switch {
+	case name == "search" && fs.NArg() == 1:
+		query = fs.Arg(0)
+	case name == "search":
+		fs.Usage()
+		return errors.New("нужна одна строка поиска")
+	case fs.NArg() > 0:
+		fs.Usage()
+		return fmt.Errorf("лишние аргументы: %s", strings.Join(fs.Args(), " "))
+	}
+
+	opts, err := lf.options()
+	if err != nil {
+		return err
+	}
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	var list *client.OrderList
+	if name == "search" {
+		list, err = c.Search(context.Background(), query, opts)
+	} else {
+		list, err = c.ListOrders(context.Background(), opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	return api.print(list, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ORDER_UID\tTRACK\tСОЗДАН\tCUSTOMER\tДОСТАВКА\tТОВАРОВ\tСУММА")
+		for _, o := range list.Orders {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", o.OrderUID, o.TrackNumber,
+				o.DateCreated.Local().Format(timeLayout), o.CustomerID, o.DeliveryService, o.ItemCount, o.Amount)
+		}
+		pages := (list.Total + list.Limit - 1) / max(list.Limit, 1)
+		fmt.Fprintf(w, "\nСтраница %d из %d, всего заказов: %d\n", list.Page, max(pages, 1), list.Total)
+	})
+}
+
+func runDelete(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	api.register(fs)
+	yes := fs.Bool("y", false, "не спрашивать подтверждение")
+	fs.Usage = usageFor(fs, "delete [флаги] ORDER_UID ...")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("не указаны order_uid")
+	}
+
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	if !*yes && !confirm(fmt.Sprintf("Удалить заказы (%d) из БД и кэша?", fs.NArg())) {
+		return errors.New("отменено")
+	}
+
+	failed := 0
+	for _, uid := range fs.Args() {
+		if err := c.DeleteOrder(context.Background(), uid); err != nil {
+			failed++
+			fmt.Printf("✗ %s: %v\n", uid, err)
+			continue
+		}
+		fmt.Printf("✓ %s удалён\n", uid)
+	}
+	if failed > 0 {
+		return fmt.Errorf("не удалось удалить: %d", failed)
+	}
+	return nil
+}
+
+// confirm спрашивает да/нет в терминале.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes" || answer == "д" || answer == "да"
+}
+
+// runExport скачивает выгрузку GET /export. NDJSON с раскладкой order —
+// заказы целиком, формат, который понимают import и publish.
+func runExport(args []string) error {
+	var api apiOptions
+	var lf listFlags
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	api.register(fs)
+	lf.register(fs, false)
+	fs.StringVar(&lf.opts.Query, "q", "", "поиск подстроки")
+	fs.StringVar(&lf.opts.ReportCurrency, "report-currency", "", "пересчитать суммы в эту валюту по курсу ЦБ на дату оплаты")
+	format := fs.String("format", "ndjson", "формат: csv, ndjson, xlsx")
+	layout := fs.String("layout", "order", "order — строка на заказ, item — строка на товар")
+	sortBy := fs.String("sort", "date_created", "поле сортировки")
+	desc := fs.Bool("desc", false, "по убыванию")
+	out := fs.String("out", "-", "файл для выгрузки, - — stdout")
+	fs.Usage = usageFor(fs, "export [флаги] > orders.ndjson")
+	fs.Parse(args)
+
+	opts, err := lf.options()
+	if err != nil {
+		return err
+	}
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	body, err := c.Export(context.Background(), client.ExportOptions{
+		Filter: opts.Filter,
+		Format: *format,
+		Layout: *layout,
+		Sort:   *sortBy,
+		Asc:    !*desc,
+	})
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return fmt.Errorf("выгрузка прервана после %d байт: %w", n, err)
+	}
+	fmt.Fprintf(os.Stderr, "Выгружено: %d байт\n", n)
+	return nil
+}
+
+func usageFor(fs *flag.FlagSet, synopsis string) func() {
+	return func() {
+		fmt.Fprintln(fs.Output(), "Использование: orderctl "+synopsis)
+		fs.PrintDefaults()
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"order-service-demo/model"
+)
+
+// sourceOrder — заказ из файла вместе с исходными байтами и местом, откуда
+// он прочитан, чтобы в отчётах можно было сослаться на строку файла.
+type sourceOrder struct {
+	Source string
+	Raw    json.RawMessage
+	Order  model.Order
+	Err    error // ошибка разбора JSON
+}
+
+// expandPaths раскрывает каталоги в список *.json, *.ndjson и *.jsonl файлов.
+func expandPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		if p == "-" {
+			files = append(files, p)
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		var found []string
+		for _, e := range entries {
+			if !e.IsDir() && isOrdersFile(e.Name()) {
+				found = append(found, filepath.Join(p, e.Name()))
+			}
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+func isOrdersFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".ndjson", ".jsonl":
+		return true
+	}
+	return false
+}
+
+func isNDJSON(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".ndjson" || ext == ".jsonl"
+}
+
+// readOrdersFile читает заказы из файла. NDJSON — по заказу на строку,
+// JSON — один объект или массив объектов. "-" означает stdin (NDJSON).
+func readOrdersFile(name string, fn func(sourceOrder) error) error {
+	var r io.Reader
+	if name == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if name == "-" || isNDJSON(name) {
+		return readNDJSON(name, r, fn)
+	}
+	return readJSON(name, r, fn)
+}
+
+func readNDJSON(name string, r io.Reader, fn func(sourceOrder) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if err := fn(decodeOrder(fmt.Sprintf("%s:%d", name, line), raw)); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func readJSON(name string, r io.Reader, fn func(sourceOrder) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if delim, ok := tok.(json.Delim); ok && delim == '[' {
+		for i := 1; dec.More(); i++ {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return fmt.Errorf("%s[%d]: %w", name, i, err)
+			}
+			if err := fn(decodeOrder(fmt.Sprintf("%s[%d]", name, i), raw)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Одиночный объект: перечитываем файл целиком
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("%s: ожидался объект или массив заказов", name)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return fn(decodeOrder(name, bytes.TrimSpace(data)))
+}
+
+func decodeOrder(source string, raw []byte) sourceOrder {
+	so := sourceOrder{Source: source, Raw: append(json.RawMessage(nil), raw...)}
+	so.Err = json.Unmarshal(raw, &so.Order)
+	return so
+}
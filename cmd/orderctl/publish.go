@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/stan.go"
+
+	"order-service-demo/model"
+)
+
+// natsOptions — флаги подключения к NATS Streaming, общие для publish и load.
+type natsOptions struct {
+	url      string
+	cluster  string
+	clientID string
+	subject  string
+}
+
+func (o *natsOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "nats", "", "адрес NATS (по умолчанию nats://localhost:4223)")
+	fs.StringVar(&o.cluster, "cluster", "", "cluster id NATS Streaming (по умолчанию test-cluster)")
+	fs.StringVar(&o.clientID, "client-id", "orderctl-"+strconv.Itoa(os.Getpid()), "client id подключения")
+	fs.StringVar(&o.subject, "subject", "", "канал, в который публикуются заказы (по умолчанию orders)")
+}
+
+// apply дополняет незаданные флаги значениями из профиля и умолчаниями.
+func (o *natsOptions) apply(p profile) {
+	o.url = firstNonEmpty(o.url, p.NATS, "nats://localhost:4223")
+	o.cluster = firstNonEmpty(o.cluster, p.Cluster, "test-cluster")
+	o.subject = firstNonEmpty(o.subject, p.Subject, "orders")
+}
+
+func (o *natsOptions) connect(ackWait time.Duration) (stan.Conn, error) {
+	sc, err := stan.Connect(o.cluster, o.clientID, stan.NatsURL(o.url), stan.PubAckWait(ackWait))
+	if err != nil {
+		return nil, fmt.Errorf("подключение к NATS Streaming: %w", err)
+	}
+	return sc, nil
+}
+
+type publishOptions struct {
+	nats    natsOptions
+	uid     string
+	newUID  bool
+	date    string
+	force   bool
+	dryRun  bool
+	timeout time.Duration
+}
+
+// publishResult — итог по одному сообщению. Seq — порядковый номер в этом
+// запуске, GUID — идентификатор, которым NATS Streaming подтверждает приём.
+type publishResult struct {
+	Seq      int
+	Source   string
+	OrderUID string
+	GUID     string
+	Err      error
+}
+
+func runPublish(args []string) error {
+	var o publishOptions
+	var cfg configOptions
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	cfg.register(fs)
+	o.nats.register(fs)
+	fs.StringVar(&o.uid, "uid", "", "заменить order_uid; при нескольких заказах добавляется суффикс -N")
+	fs.BoolVar(&o.newUID, "new-uid", false, "сгенерировать каждому заказу новый order_uid")
+	fs.StringVar(&o.date, "date", "", "заменить date_created и payment_dt: now или RFC 3339")
+	fs.BoolVar(&o.force, "force", false, "отправлять и заказы, не прошедшие проверку (для проверки отказов)")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "только прочитать и проверить, ничего не отправлять")
+	fs.DurationVar(&o.timeout, "ack-timeout", 30*time.Second, "сколько ждать подтверждений")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Использование: orderctl publish [флаги] ФАЙЛ|КАТАЛОГ|- ...")
+		fmt.Fprintln(fs.Output(), "Файлы: *.json (объект или массив), *.ndjson/*.jsonl (заказ на строку), - — NDJSON из stdin.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	prof, err := cfg.load()
+	if err != nil {
+		return err
+	}
+	o.nats.apply(prof)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("не указаны файлы с заказами")
+	}
+	if o.uid != "" && o.newUID {
+		return errors.New("-uid и -new-uid взаимоисключающие")
+	}
+	var date time.Time
+	switch o.date {
+	case "":
+	case "now":
+		date = time.Now().UTC().Truncate(time.Second)
+	default:
+		t, err := time.Parse(time.RFC3339, o.date)
+		if err != nil {
+			return fmt.Errorf("некорректный -date: %w", err)
+		}
+		date = t
+	}
+
+	files, err := expandPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	var batch []sourceOrder
+	for _, f := range files {
+		err := readOrdersFile(f, func(so sourceOrder) error {
+			batch = append(batch, so)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(batch) == 0 {
+		return errors.New("в указанных файлах нет заказов")
+	}
+
+	// Подмена полей и проверка тем же валидатором, что и у сервиса
+	var toSend []sourceOrder
+	skipped := 0
+	for i := range batch {
+		so := &batch[i]
+		if so.Err == nil {
+			applyOverrides(so, o, i, len(batch), date)
+			so.Err = model.Validate(so.Order)
+		}
+		if so.Err != nil {
+			fmt.Printf("✗ %s (%s): %v\n", so.Source, orDash(so.Order.OrderUID), so.Err)
+			if !o.force {
+				skipped++
+				continue
+			}
+		}
+		toSend = append(toSend, *so)
+	}
+
+	if o.dryRun {
+		fmt.Printf("Проверено: %d, к отправке: %d, не прошли проверку: %d\n", len(batch), len(toSend), len(batch)-len(toSend))
+		return nil
+	}
+	if len(toSend) == 0 {
+		return errors.New("нечего отправлять: все заказы не прошли проверку (см. -force)")
+	}
+
+	results, err := publishOrders(o, toSend)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("[%d] %s → %s: ошибка: %v\n", r.Seq, r.Source, orDash(r.OrderUID), r.Err)
+			continue
+		}
+		fmt.Printf("[%d] %s → %s: подтверждено, guid=%s\n", r.Seq, r.Source, orDash(r.OrderUID), r.GUID)
+	}
+	fmt.Printf("Отправлено: %d, подтверждено: %d, ошибок: %d, пропущено: %d\n",
+		len(results), len(results)-failed, failed, skipped)
+	if failed > 0 {
+		return fmt.Errorf("%d сообщений не подтверждено", failed)
+	}
+	return nil
+}
+
+func applyOverrides(so *sourceOrder, o publishOptions, i, total int, date time.Time) {
+	changed := false
+	oldUID := so.Order.OrderUID
+
+	switch {
+	case o.uid != "":
+		so.Order.OrderUID = o.uid
+		if total > 1 {
+			so.Order.OrderUID = fmt.Sprintf("%s-%d", o.uid, i+1)
+		}
+		changed = true
+	case o.newUID:
+		so.Order.OrderUID = randomUID()
+		changed = true
+	}
+	// В тестовых заказах transaction совпадает с order_uid — сохраняем это
+	if changed && so.Order.Payment.Transaction == oldUID {
+		so.Order.Payment.Transaction = so.Order.OrderUID
+	}
+
+	if !date.IsZero() {
+		so.Order.DateCreated = date
+		so.Order.Payment.PaymentDt = date.Unix()
+		changed = true
+	}
+
+	if changed {
+		raw, _ := json.Marshal(so.Order)
+		so.Raw = raw
+	}
+}
+
+// randomUID повторяет вид тестовых order_uid: 16 hex-символов и "test".
+func randomUID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b) + "test"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
+
+// publishOrders отправляет сообщения асинхронно и ждёт подтверждения на
+// каждое. Результаты возвращаются в порядке отправки.
+func publishOrders(o publishOptions, batch []sourceOrder) ([]publishResult, error) {
+	sc, err := o.nats.connect(o.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer sc.Close()
+
+	results := make([]publishResult, len(batch))
+	var wg sync.WaitGroup
+	for i, so := range batch {
+		res := &results[i]
+		*res = publishResult{Seq: i + 1, Source: so.Source, OrderUID: so.Order.OrderUID}
+
+		wg.Add(1)
+		guid, err := sc.PublishAsync(o.nats.subject, so.Raw, func(ackGUID string, err error) {
+			defer wg.Done()
+			res.GUID, res.Err = ackGUID, err
+		})
+		if err != nil {
+			wg.Done()
+			res.GUID, res.Err = guid, err
+		}
+	}
+	wg.Wait()
+	return results, nil
+}
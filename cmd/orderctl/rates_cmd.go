@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// === rates: курсы валют для отчётов в валюте ===
+// Файлы — ежедневный XML ЦБ (www.cbr.ru/scripts/XML_daily.asp?date_req=...)
+// или CSV с колонками date, currency, nominal, value; каждый файл
+// загружается отдельным запросом.
+
+func runRates(args []string) error {
+	if len(args) == 0 {
+		return errors.New("использование: orderctl rates load|show ...")
+	}
+	switch args[0] {
+	case "load":
+		return runRatesLoad(args[1:])
+	case "show":
+		return runRatesShow(args[1:])
+	}
+	return fmt.Errorf("неизвестная команда rates %q: нужна load или show", args[0])
+}
+
+func runRatesLoad(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("rates load", flag.ExitOnError)
+	api.register(fs)
+	fs.Usage = usageFor(fs, "rates load [флаги] ФАЙЛ ...")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("не указаны файлы с курсами")
+	}
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range fs.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rep, err := c.LoadRates(context.Background(), data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		period := rep.From
+		if rep.To != rep.From {
+			period += " — " + rep.To
+		}
+		fmt.Printf("✓ %s: %d курсов за %s (%s)\n", name, rep.Loaded, period, strings.Join(rep.Currencies, ", "))
+		if len(rep.Skipped) > 0 {
+			fmt.Printf("  пропущены валюты вне справочника: %s\n", strings.Join(rep.Skipped, ", "))
+		}
+	}
+	return nil
+}
+
+func runRatesShow(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("rates show", flag.ExitOnError)
+	api.register(fs)
+	date := fs.String("date", "", "дата YYYY-MM-DD, по умолчанию сегодня")
+	fs.Usage = usageFor(fs, "rates show [флаги]")
+	fs.Parse(args)
+
+	var day time.Time
+	if *date != "" {
+		var err error
+		if day, err = time.Parse("2006-01-02", *date); err != nil {
+			return errors.New("-date: нужна дата YYYY-MM-DD")
+		}
+	}
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	list, err := c.Rates(context.Background(), day)
+	if err != nil {
+		return err
+	}
+
+	return api.print(list, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Курсы ЦБ на %s, %s за номинал\n\n", list.Date, list.Base)
+		fmt.Fprintln(w, "ВАЛЮТА\tНОМИНАЛ\tКУРС\tУСТАНОВЛЕН")
+		for _, r := range list.Rates {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", r.Currency, r.Nominal, r.Value, r.Date)
+		}
+		if len(list.Rates) == 0 {
+			fmt.Fprintln(w, "курсов нет: загрузите их командой orderctl rates load")
+		}
+	})
+}
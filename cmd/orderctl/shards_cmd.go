@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+)
+
+// === shards: шарды хранилища заказов ===
+// После смены SHARD_MAP: перезапустить все экземпляры сервиса с новой
+// картой, посмотреть shards status и выполнить shards rebalance, пока в
+// колонке «не на месте» не останутся нули.
+
+func runShards(args []string) error {
+	if len(args) == 0 {
+		return errors.New("использование: orderctl shards status|rebalance ...")
+	}
+	switch args[0] {
+	case "status":
+		return runShardsStatus(args[1:])
+	case "rebalance":
+		return runShardsRebalance(args[1:])
+	}
+	return fmt.Errorf("неизвестная команда shards %q: нужна status или rebalance", args[0])
+}
+
+func runShardsStatus(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("shards status", flag.ExitOnError)
+	api.register(fs)
+	fs.Usage = usageFor(fs, "shards status [флаги]")
+	fs.Parse(args)
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	shards, err := c.Shards(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return api.print(shards, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ШАРД\tЗАКАЗОВ\tВ АРХИВЕ\tНЕ НА МЕСТЕ")
+		for _, s := range shards {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", s.Name, s.Orders, s.Archived, s.Misplaced)
+		}
+	})
+}
+
+func runShardsRebalance(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("shards rebalance", flag.ExitOnError)
+	api.register(fs)
+	yes := fs.Bool("y", false, "не спрашивать подтверждение")
+	fs.Usage = usageFor(fs, "shards rebalance [флаги]")
+	fs.Parse(args)
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if !*yes {
+		shards, err := c.Shards(ctx)
+		if err != nil {
+			return err
+		}
+		misplaced := 0
+		for _, s := range shards {
+			misplaced += s.Misplaced
+		}
+		if !confirm(fmt.Sprintf("Перенести заказы между шардами (%d не на месте)?", misplaced)) {
+			return errors.New("отменено")
+		}
+	}
+	rep, err := c.RebalanceShards(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := api.print(rep, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "✓ перенесено %d заказов и %d из архива за %d мс\n", rep.Moved, rep.MovedArchived, rep.DurationMs)
+		for _, uid := range rep.Failed {
+			fmt.Fprintf(w, "✗ %s: не перенесён, подробности в логе сервиса\n", uid)
+		}
+	}); err != nil {
+		return err
+	}
+	if len(rep.Failed) > 0 {
+		return fmt.Errorf("%d заказов не перенесены", len(rep.Failed))
+	}
+	return nil
+}
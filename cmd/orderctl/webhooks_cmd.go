@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"order-service-demo/client"
+)
+
+// === webhooks: подписки на события о заказах ===
+// webhooks listen поднимает локальный приёмник, который проверяет подпись
+// и печатает события: удобно, чтобы посмотреть, что именно получит партнёр.
+//
+//	orderctl webhooks listen -addr :9000 -secret <secret>
+//	orderctl webhooks add -events order.saved -delivery-services cdek http://localhost:9000/
+//	orderctl webhooks test 1
+
+func runWebhooks(args []string) error {
+	if len(args) == 0 {
+		return errors.New("использование: orderctl webhooks add|list|rm|enable|test|log|listen ...")
+	}
+	switch args[0] {
+	case "add":
+		return runWebhooksAdd(args[1:])
+	case "list":
+		return runWebhooksList(args[1:])
+	case "rm":
+		return runWebhooksRm(args[1:])
+	case "enable":
+		return runWebhooksEnable(args[1:])
+	case "test":
+		return runWebhooksTest(args[1:])
+	case "log":
+		return runWebhooksLog(args[1:])
+	case "listen":
+		return runWebhooksListen(args[1:])
+	}
+	return fmt.Errorf("неизвестная команда webhooks %q: нужна add, list, rm, enable, test, log или listen", args[0])
+}
+
+// splitList разбирает значение флага через запятую; пустое — nil.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func runWebhooksAdd(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("webhooks add", flag.ExitOnError)
+	api.register(fs)
+	events := fs.String("events", "", "события через запятую: order.saved, order.updated, order.deleted (по умолчанию все)")
+	entries := fs.String("entries", "", "entry через запятую (по умолчанию любой)")
+	services := fs.String("delivery-services", "", "службы доставки через запятую (по умолчанию любая)")
+	fs.Usage = usageFor(fs, "webhooks add [флаги] URL")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("нужен один URL")
+	}
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	h, err := c.CreateWebhook(context.Background(), client.WebhookRequest{
+		URL:              fs.Arg(0),
+		Events:           splitList(*events),
+		Entries:          splitList(*entries),
+		DeliveryServices: splitList(*services),
+	})
+	if err != nil {
+		return err
+	}
+
+	return api.print(h, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "✓ подписка %d: %s\n", h.ID, h.URL)
+		fmt.Fprintf(w, "секрет\t%s\n", h.Secret)
+		fmt.Fprintln(w, "секрет показывается только сейчас: сохраните его у получателя")
+	})
+}
+
+func runWebhooksList(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("webhooks list", flag.ExitOnError)
+	api.register(fs)
+	fs.Usage = usageFor(fs, "webhooks list [флаги]")
+	fs.Parse(args)
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	hooks, err := c.Webhooks(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return api.print(hooks, func(w *tabwriter.Writer) {
+		anyOf := func(s []string) string {
+			if len(s) == 0 {
+				return "все"
+			}
+			return strings.Join(s, ",")
+		}
+		fmt.Fprintln(w, "ID\tURL\tСОБЫТИЯ\tENTRY\tСЛУЖБЫ\tСОСТОЯНИЕ")
+		for _, h := range hooks {
+			state := "включена"
+			if !h.Enabled {
+				state = "выключена"
+				if h.DisabledAt != nil {
+					state += " " + h.DisabledAt.Local().Format(timeLayout)
+				}
+			} else if h.ConsecutiveFailures > 0 {
+				state = fmt.Sprintf("включена, неудач подряд: %d", h.ConsecutiveFailures)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", h.ID, h.URL,
+				anyOf(h.Events), anyOf(h.Entries), anyOf(h.DeliveryServices), state)
+		}
+	})
+}
+
+// webhookIDs разбирает id подписок из аргументов и вызывает fn для каждого.
+func webhookIDs(name string, args []string, fn func(c *client.Client, id int64) (string, error)) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("webhooks "+name, flag.ExitOnError)
+	api.register(fs)
+	fs.Usage = usageFor(fs, "webhooks "+name+" [флаги] ID ...")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("не указаны id подписок")
+	}
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, arg := range fs.Args() {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("некорректный id %q", arg)
+		}
+		msg, err := fn(c, id)
+		if err != nil {
+			failed++
+			fmt.Printf("✗ %d: %v\n", id, err)
+			continue
+		}
+		fmt.Printf("✓ %d: %s\n", id, msg)
+	}
+	if failed > 0 {
+		return fmt.Errorf("не выполнено для %d подписок", failed)
+	}
+	return nil
+}
+
+func runWebhooksRm(args []string) error {
+	return webhookIDs("rm", args, func(c *client.Client, id int64) (string, error) {
+		return "удалена", c.DeleteWebhook(context.Background(), id)
+	})
+}
+
+func runWebhooksEnable(args []string) error {
+	return webhookIDs("enable", args, func(c *client.Client, id int64) (string, error) {
+		return "включена", c.EnableWebhook(context.Background(), id)
+	})
+}
+
+func runWebhooksTest(args []string) error {
+	return webhookIDs("test", args, func(c *client.Client, id int64) (string, error) {
+		res, err := c.TestWebhook(context.Background(), id)
+		if err != nil {
+			return "", err
+		}
+		if res.Error != "" {
+			return "", fmt.Errorf("ping не доставлен за %d мс: %s", res.DurationMs, res.Error)
+		}
+		return fmt.Sprintf("ping доставлен: HTTP %d за %d мс", res.Status, res.DurationMs), nil
+	})
+}
+
+func runWebhooksLog(args []string) error {
+	var api apiOptions
+	fs := flag.NewFlagSet("webhooks log", flag.ExitOnError)
+	api.register(fs)
+	status := fs.String("status", "", "только pending, delivered или failed")
+	limit := fs.Int("limit", 50, "сколько последних доставок показать")
+	fs.Usage = usageFor(fs, "webhooks log [флаги] ID")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("нужен один id подписки")
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("некорректный id %q", fs.Arg(0))
+	}
+	c, err := api.client()
+	if err != nil {
+		return err
+	}
+	list, err := c.WebhookDeliveries(context.Background(), id, *status, *limit)
+	if err != nil {
+		return err
+	}
+
+	return api.print(list, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tСОЗДАНА\tСОБЫТИЕ\tORDER_UID\tСОСТОЯНИЕ\tПОПЫТОК\tПОСЛЕДНИЙ ОТВЕТ")
+		for _, d := range list {
+			state := d.Status
+			if d.Status == "pending" && d.NextAttemptAt != nil {
+				state += ", повтор " + d.NextAttemptAt.Local().Format(timeLayout)
+			}
+			last := "—"
+			if d.LastStatus != 0 {
+				last = "HTTP " + strconv.Itoa(d.LastStatus)
+			}
+			if d.LastError != "" && d.Status != "delivered" {
+				last = truncate(d.LastError, 60)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n", d.ID, d.CreatedAt.Local().Format(timeLayout),
+				d.EventType, orDash(d.OrderUID), state, d.Attempts, last)
+		}
+	})
+}
+
+// runWebhooksListen — локальный приёмник webhooks: проверяет подпись и
+// печатает каждое событие одной строкой JSON в stdout. -fail отвечает 500,
+// чтобы посмотреть на повторы и выключение подписки.
+func runWebhooksListen(args []string) error {
+	fs := flag.NewFlagSet("webhooks listen", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:9000", "адрес приёмника")
+	secret := fs.String("secret", os.Getenv("WEBHOOK_SECRET"), "секрет подписки ($WEBHOOK_SECRET); пусто — подпись не проверяется")
+	tolerance := fs.Duration("tolerance", 5*time.Minute, "допустимое расхождение X-Webhook-Timestamp")
+	fail := fs.Bool("fail", false, "отвечать 500 на все запросы")
+	fs.Usage = usageFor(fs, "webhooks listen [флаги]")
+	fs.Parse(args)
+	if *secret == "" {
+		fmt.Fprintln(os.Stderr, "⚠ -secret не задан: подпись не проверяется")
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "нужен POST", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 16<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		event, delivery := r.Header.Get("X-Webhook-Event"), r.Header.Get("X-Webhook-Delivery")
+		if *secret != "" {
+			if err := client.VerifyWebhook(*secret, r, body, *tolerance); err != nil {
+				fmt.Fprintf(os.Stderr, "✗ доставка %s (%s): %v\n", delivery, event, err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		if *fail {
+			fmt.Fprintf(os.Stderr, "✗ доставка %s (%s): отвечаем 500 (-fail)\n", delivery, event)
+			http.Error(w, "отказ по -fail", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "✓ доставка %s (%s)\n", delivery, event)
+		fmt.Println(strings.TrimSpace(string(body)))
+		w.WriteHeader(http.StatusNoContent)
+	})}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+	fmt.Fprintf(os.Stderr, "Приём webhooks на http://%s/ (Ctrl+C — выход)\n", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// === Согласованность кэша между экземплярами сервиса ===
+// У каждого экземпляра свой кэш заказов. Транзакция, которая записывает,
+// меняет или удаляет заказ, отправляет NOTIFY в канал order_cache с
+// order_uid и новой версией заказа; Postgres доставит его всем слушателям
+// после коммита, а при откате не доставит вовсе. Получив уведомление,
+// экземпляр перечитывает заказ из БД или убирает его из кэша.
+//
+// Версии берутся из одной последовательности order_version_seq, так что
+// растут и после удаления и повторной записи заказа. Уведомление с версией
+// не новее той, что уже в кэше, устарело (в том числе собственное) и
+// отбрасывается; версия удаления помнится cacheTombstoneTTL, чтобы
+// запоздавшее чтение не вернуло удалённый заказ. Если связь со слушателем
+// рвалась, уведомления за это время потеряны — кэш перечитывается целиком.
+// NOTIFY уходит из той БД, где записан заказ, поэтому при шардировании
+// (shards.go) экземпляр слушает канал в каждом шарде.
+
+const (
+	cacheChannel      = "order_cache"
+	cacheTombstoneTTL = time.Minute
+)
+
+// cacheNotice — тело уведомления; Postgres ограничивает его 8000 байт,
+// поэтому сам заказ не передаётся.
+type cacheNotice struct {
+	UID     string `json:"uid,omitempty"`
+	Version int64  `json:"v,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// notifyOrderTx сообщает остальным экземплярам об изменении заказа; уходит
+// вместе с коммитом tx.
+func notifyOrderTx(tx *sql.Tx, uid string, version int64, deleted bool) error {
+	payload, _ := json.Marshal(cacheNotice{UID: uid, Version: version, Deleted: deleted})
+	_, err := tx.Exec("SELECT pg_notify($1, $2)", cacheChannel, string(payload))
+	return err
+}
+
+// listenCacheNotices подписывается на канал order_cache во всех шардах.
+// Вызывается до загрузки кэша: уведомления копятся, пока не запущен
+// runCacheListener.
+func listenCacheNotices() []*pq.Listener {
+	var listeners []*pq.Listener
+	for _, s := range router.shards {
+		name := s.name
+		l := pq.NewListener(s.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+			switch ev {
+			case pq.ListenerEventDisconnected:
+				log.Printf(" Потеряна связь со слушателем %s (шард %s): %v", cacheChannel, name, err)
+			case pq.ListenerEventReconnected:
+				log.Printf(" Слушатель %s (шард %s) переподключён", cacheChannel, name)
+			}
+		})
+		if err := l.Listen(cacheChannel); err != nil {
+			log.Fatalf(" Ошибка подписки на уведомления кэша (шард %s): %v", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+// runCacheListener применяет уведомления других экземпляров к кэшу.
+func runCacheListener(l *pq.Listener) {
+	prune := time.NewTicker(cacheTombstoneTTL)
+	defer prune.Stop()
+	for {
+		select {
+		case n := <-l.Notify:
+			if n == nil {
+				// Переподключение: что пришло за время обрыва, неизвестно
+				log.Println(" Уведомления кэша могли потеряться, перечитываем кэш из БД")
+				loadCacheFromDB()
+				continue
+			}
+			var notice cacheNotice
+			if err := json.Unmarshal([]byte(n.Extra), &notice); err != nil {
+				log.Printf(" Некорректное уведомление кэша %q: %v", n.Extra, err)
+				continue
+			}
+			applyCacheNotice(notice)
+		case <-prune.C:
+			cachePruneTombstones(time.Now().Add(-cacheTombstoneTTL))
+		case <-time.After(90 * time.Second):
+			// Без трафика обрыв соединения можно не заметить
+			go l.Ping()
+		}
+	}
+}
+
+func applyCacheNotice(n cacheNotice) {
+	switch {
+	case n.Deleted:
+		cacheDelete(n.UID, n.Version)
+	default:
+		cacheMutex.RLock()
+		stale := n.Version <= cacheVersionLocked(n.UID)
+		cacheMutex.RUnlock()
+		if stale {
+			return
+		}
+		order, err := getOrderFromDB(n.UID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return // уже удалён; об этом будет своё уведомление
+		}
+		if err != nil {
+			log.Printf(" Не удалось перечитать заказ %s по уведомлению: %v", n.UID, err)
+			return
+		}
+		cachePut(order, n.Version)
+	}
+}
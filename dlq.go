@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// === Очередь недоставленных сообщений (dead letters) ===
+// Сообщения из NATS, которые не удалось принять (отклонены проверкой или
+// не записались в БД), сохраняются в таблицу dead_letters. Админ может
+// просмотреть их и отправить повторно, при необходимости исправив тело.
+//
+// Тело сообщения — заказ вместе с контактами получателя, поэтому при
+// заданном PII_KEYFILE оно хранится зашифрованным, как архив заказов
+// (sealBlob), с привязкой к order_uid строки.
+
+const (
+	defaultDLQLimit = 50
+	maxDLQLimit     = 500
+)
+
+type deadLetter struct {
+	ID            int64      `json:"id"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	Source        string     `json:"source"`
+	OrderUID      string     `json:"order_uid,omitempty"`
+	Reason        string     `json:"reason"`
+	Payload       string     `json:"payload"`
+	PayloadError  string     `json:"payload_error,omitempty"` // тело не удалось расшифровать
+	Attempts      int        `json:"attempts"`
+	ResubmittedAt *time.Time `json:"resubmitted_at,omitempty"`
+}
+
+type deadLetterList struct {
+	Items []deadLetter `json:"items"`
+	Total int          `json:"total"`
+	Page  int          `json:"page"`
+	Limit int          `json:"limit"`
+}
+
+// deadLetterAAD — к чему привязан шифротекст тела: order_uid строки
+// (пустой, если его не удалось разобрать).
+func deadLetterAAD(uid string) string {
+	return "dead_letters/" + uid
+}
+
+func saveDeadLetter(source string, payload []byte, uid string, reason error) {
+	version, dek, data, err := sealBlob(deadLetterAAD(uid), payload)
+	if err != nil {
+		log.Printf(" Не удалось зашифровать сообщение для dead_letters: %v", err)
+		return
+	}
+	_, err = db.Exec(`
+		INSERT INTO dead_letters (source, order_uid, reason, payload, key_version, dek)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)`,
+		source, uid, reason.Error(), data, version, dek)
+	if err != nil {
+		log.Printf(" Не удалось записать сообщение в dead_letters: %v", err)
+	}
+}
+
+// updateDeadLetter записывает итог повторной отправки: причину отказа или
+// отметку о приёме и тело, которое отправлялось.
+func updateDeadLetter(id int64, uid string, payload []byte, reason error) error {
+	version, dek, data, err := sealBlob(deadLetterAAD(uid), payload)
+	if err != nil {
+		return err
+	}
+	if reason != nil {
+		_, err = db.Exec(`
+			UPDATE dead_letters SET attempts = attempts + 1, reason = $2, payload = $3, key_version = $4, dek = $5
+			WHERE id = $1`, id, reason.Error(), data, version, dek)
+		return err
+	}
+	_, err = db.Exec(`
+		UPDATE dead_letters SET attempts = attempts + 1, resubmitted_at = now(), payload = $2, key_version = $3, dek = $4
+		WHERE id = $1`, id, data, version, dek)
+	return err
+}
+
+// === HTTP: GET /admin/dlq ===
+// По умолчанию только ещё не переотправленные; all=1 — все.
+func listDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	list := deadLetterList{Page: 1, Limit: defaultDLQLimit}
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "некорректный page", http.StatusBadRequest)
+			return
+		}
+		list.Page = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDLQLimit {
+			http.Error(w, "limit должен быть от 1 до "+strconv.Itoa(maxDLQLimit), http.StatusBadRequest)
+			return
+		}
+		list.Limit = n
+	}
+	where := "WHERE resubmitted_at IS NULL"
+	if q.Get("all") == "1" {
+		where = ""
+	}
+
+	if err := db.QueryRow("SELECT count(*) FROM dead_letters " + where).Scan(&list.Total); err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows, err := db.Query(`
+		SELECT id, received_at, source, coalesce(order_uid, ''), reason, payload, key_version, dek, attempts, resubmitted_at
+		FROM dead_letters `+where+`
+		ORDER BY id DESC LIMIT $1 OFFSET $2`, list.Limit, (list.Page-1)*list.Limit)
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list.Items = []deadLetter{}
+	for rows.Next() {
+		var d deadLetter
+		var version sql.NullInt64
+		var payload, dek []byte
+		if err := rows.Scan(&d.ID, &d.ReceivedAt, &d.Source, &d.OrderUID, &d.Reason, &payload, &version, &dek,
+			&d.Attempts, &d.ResubmittedAt); err != nil {
+			http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Нерасшифрованное тело не мешает показать остальные сообщения
+		if payload, err = openBlob(deadLetterAAD(d.OrderUID), version, dek, payload); err != nil {
+			log.Printf(" Сообщение DLQ %d не расшифровано: %v", d.ID, err)
+			d.PayloadError = err.Error()
+		}
+		d.Payload = string(payload)
+		list.Items = append(list.Items, d)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// === HTTP: POST /admin/dlq/{id}/resubmit ===
+// Непустое тело запроса заменяет сохранённое сообщение (исправленный заказ).
+func resubmitDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "некорректный id", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOrderBody))
+	if err != nil {
+		http.Error(w, "Слишком большой или оборванный запрос: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var uid string
+	var version sql.NullInt64
+	var payload, dek []byte
+	var resubmitted *time.Time
+	err = db.QueryRow(`
+		SELECT coalesce(order_uid, ''), payload, key_version, dek, resubmitted_at
+		FROM dead_letters WHERE id = $1`, id).Scan(&uid, &payload, &version, &dek, &resubmitted)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Сообщение не найдено", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if resubmitted != nil {
+		http.Error(w, "Сообщение уже переотправлено", http.StatusConflict)
+		return
+	}
+	if len(body) > 0 {
+		payload = body
+	} else if payload, err = openBlob(deadLetterAAD(uid), version, dek, payload); err != nil {
+		http.Error(w, "Не удалось расшифровать сообщение: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	order, _, err := ingestOrder(payload)
+	if err != nil {
+		if dbErr := updateDeadLetter(id, uid, payload, err); dbErr != nil {
+			log.Printf(" Не удалось обновить dead letter %d: %v", id, dbErr)
+		}
+		var rej *rejectError
+		if errors.As(err, &rej) {
+			http.Error(w, rej.reason, http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "Ошибка сохранения заказа", http.StatusInternalServerError)
+		return
+	}
+
+	if err := updateDeadLetter(id, uid, payload, nil); err != nil {
+		log.Printf(" Не удалось отметить dead letter %d: %v", id, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summarizeOrder(order))
+}
+
+// rotateDeadLetters перешифровывает тела сообщений активным ключом —
+// пачками по rotateBatch, как строки deliveries (rotateBatchTx). DLQ живёт
+// только в основной БД.
+func rotateDeadLetters(rep *keyRotationReport) error {
+	var after int64
+	for {
+		n, last, err := rotateDeadLetterBatchTx(after, rep)
+		if err != nil || n == 0 {
+			return err
+		}
+		after = last
+	}
+}
+
+func rotateDeadLetterBatchTx(after int64, rep *keyRotationReport) (n int, last int64, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, coalesce(order_uid, ''), payload, key_version, dek
+		FROM dead_letters
+		WHERE key_version IS DISTINCT FROM $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+		FOR UPDATE`, keyring.active, after, rotateBatch)
+	if err != nil {
+		return 0, 0, err
+	}
+	type row struct {
+		id           int64
+		uid          string
+		payload, dek []byte
+		version      sql.NullInt64
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.uid, &r.payload, &r.version, &r.dek); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, r := range batch {
+		plain, err := openBlob(deadLetterAAD(r.uid), r.version, r.dek, r.payload)
+		if err != nil {
+			log.Printf(" Ротация ключей DLQ: сообщение %d: %v", r.id, err)
+			rep.Failed = append(rep.Failed, "dlq:"+strconv.FormatInt(r.id, 10))
+			continue
+		}
+		version, dek, data, err := sealBlob(deadLetterAAD(r.uid), plain)
+		if err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.Exec(`UPDATE dead_letters SET payload = $2, key_version = $3, dek = $4 WHERE id = $1`,
+			r.id, data, version, dek); err != nil {
+			return 0, 0, err
+		}
+		rep.Rotated++
+	}
+	if len(batch) == 0 {
+		return 0, 0, nil
+	}
+	return len(batch), batch[len(batch)-1].id, tx.Commit()
+}
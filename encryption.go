@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// === Шифрование контактов получателя в БД ===
+// Имя, телефон, email и адрес в deliveries хранятся зашифрованными по схеме
+// envelope encryption: у каждой строки свой ключ данных (DEK) AES-256-GCM,
+// а сам DEK зашифрован мастер-ключом из файла PII_KEYFILE. Версия мастер-ключа
+// — в key_version; строки с key_version NULL записаны до включения
+// шифрования и лежат открытым текстом. Шифротекст привязан к order_uid и
+// полю, поэтому значения нельзя переставить между строками.
+//
+// Искать по зашифрованным телефону и email можно по точному совпадению:
+// рядом хранятся слепые индексы — HMAC-SHA256 нормализованного значения
+// отдельным ключом index, который при ротации не меняется.
+//
+// Файл ключей — строки «версия ключ», ключ — 32 байта в base64. Новые
+// строки шифруются ключом с наибольшей версией:
+//
+//	index 3q2+7w...
+//	1 Zm9vYmFy...
+//	2 YmF6cXV4...
+
+const rotateBatch = 500
+
+type piiKeyring struct {
+	keys   map[int][]byte
+	active int
+	index  []byte
+}
+
+// keyring — ключи из PII_KEYFILE; nil — шифрование выключено.
+var keyring *piiKeyring
+
+func loadKeyring(path string) (*piiKeyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil && fi.Mode().Perm()&0o077 != 0 {
+		log.Printf(" Файл ключей %s доступен не только владельцу (%v)", path, fi.Mode().Perm())
+	}
+
+	k := &piiKeyring{keys: map[int][]byte{}}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, " ")
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if !ok || err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%s:%d: нужна строка «версия ключ», ключ — 32 байта в base64", path, line)
+		}
+		if name == "index" {
+			k.index = key
+			continue
+		}
+		v, err := strconv.Atoi(name)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("%s:%d: версия ключа должна быть целым числом больше нуля", path, line)
+		}
+		if _, dup := k.keys[v]; dup {
+			return nil, fmt.Errorf("%s:%d: версия %d повторяется", path, line, v)
+		}
+		k.keys[v] = key
+		k.active = max(k.active, v)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if k.active == 0 || k.index == nil {
+		return nil, fmt.Errorf("%s: нужны ключ index и хотя бы один версионный ключ", path)
+	}
+	return k, nil
+}
+
+func (k *piiKeyring) versions() []int {
+	vs := make([]int, 0, len(k.keys))
+	for v := range k.keys {
+		vs = append(vs, v)
+	}
+	slices.Sort(vs)
+	return vs
+}
+
+func seal(key, plaintext []byte, aad string) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(aad)), nil
+}
+
+func unseal(key, sealed []byte, aad string) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("шифротекст обрезан")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(aad))
+}
+
+// === Слепые индексы ===
+
+// normalizePhone оставляет только цифры; российское 8XXXXXXXXXX
+// приводится к 7XXXXXXXXXX.
+func normalizePhone(s string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+	if len(digits) == 11 && digits[0] == '8' {
+		digits = "7" + digits[1:]
+	}
+	return digits
+}
+
+func normalizeEmail(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+func (k *piiKeyring) blindIndex(kind, normalized string) sql.NullString {
+	if normalized == "" {
+		return sql.NullString{}
+	}
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(kind + ":" + normalized))
+	return sql.NullString{String: hex.EncodeToString(mac.Sum(nil)), Valid: true}
+}
+
+func (k *piiKeyring) phoneIndex(s string) sql.NullString {
+	return k.blindIndex("phone", normalizePhone(s))
+}
+
+func (k *piiKeyring) emailIndex(s string) sql.NullString {
+	return k.blindIndex("email", normalizeEmail(s))
+}
+
+// === Строка deliveries ===
+
+// storedDelivery — строка deliveries в том виде, в каком она лежит в БД.
+type storedDelivery struct {
+	Delivery
+	keyVersion sql.NullInt64
+	dek        []byte
+	phoneIdx   sql.NullString
+	emailIdx   sql.NullString
+}
+
+// encryptedFields — поля Delivery, которые шифруются.
+func encryptedFields(d *Delivery) map[string]*string {
+	return map[string]*string{"name": &d.Name, "phone": &d.Phone, "email": &d.Email, "address": &d.Address}
+}
+
+// newDEK создаёт ключ данных для строки uid и возвращает его вместе с
+// версией мастер-ключа и зашифрованной копией для записи в БД.
+func newDEK(uid string) (dek []byte, version sql.NullInt64, wrapped []byte, err error) {
+	dek = make([]byte, 32)
+	if _, err = rand.Read(dek); err != nil {
+		return nil, version, nil, err
+	}
+	if wrapped, err = seal(keyring.keys[keyring.active], dek, uid); err != nil {
+		return nil, version, nil, err
+	}
+	return dek, sql.NullInt64{Int64: int64(keyring.active), Valid: true}, wrapped, nil
+}
+
+// openDEK расшифровывает ключ данных строки uid.
+func openDEK(uid string, version sql.NullInt64, wrapped []byte) ([]byte, error) {
+	if keyring == nil {
+		return nil, fmt.Errorf("данные заказа %s зашифрованы, а PII_KEYFILE не задан", uid)
+	}
+	kek, ok := keyring.keys[int(version.Int64)]
+	if !ok {
+		return nil, fmt.Errorf("данные заказа %s зашифрованы ключом версии %d, его нет в PII_KEYFILE", uid, version.Int64)
+	}
+	dek, err := unseal(kek, wrapped, uid)
+	if err != nil {
+		return nil, fmt.Errorf("ключ данных заказа %s: %w", uid, err)
+	}
+	return dek, nil
+}
+
+// sealDelivery готовит доставку к записи: шифрует контакты активным ключом
+// или, если шифрование выключено, оставляет как есть.
+func sealDelivery(uid string, d Delivery) (storedDelivery, error) {
+	s := storedDelivery{Delivery: d}
+	if keyring == nil {
+		return s, nil
+	}
+	s.phoneIdx = keyring.phoneIndex(d.Phone)
+	s.emailIdx = keyring.emailIndex(d.Email)
+
+	dek, version, wrapped, err := newDEK(uid)
+	if err != nil {
+		return s, err
+	}
+	for field, p := range encryptedFields(&s.Delivery) {
+		sealed, err := seal(dek, []byte(*p), uid+"/"+field)
+		if err != nil {
+			return s, err
+		}
+		*p = base64.StdEncoding.EncodeToString(sealed)
+	}
+	s.keyVersion, s.dek = version, wrapped
+	return s, nil
+}
+
+// openDelivery расшифровывает строку deliveries.
+func openDelivery(uid string, s storedDelivery) (Delivery, error) {
+	if !s.keyVersion.Valid {
+		return s.Delivery, nil
+	}
+	dek, err := openDEK(uid, s.keyVersion, s.dek)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	d := s.Delivery
+	for field, p := range encryptedFields(&d) {
+		sealed, err := base64.StdEncoding.DecodeString(*p)
+		if err == nil {
+			var plain []byte
+			plain, err = unseal(dek, sealed, uid+"/"+field)
+			*p = string(plain)
+		}
+		if err != nil {
+			return Delivery{}, fmt.Errorf("поле %s заказа %s: %w", field, uid, err)
+		}
+	}
+	return d, nil
+}
+
+// sealBlob шифрует данные заказа целиком (архив, см. retention.go) так же,
+// как контакты: своим ключом данных под активным мастер-ключом. Без
+// PII_KEYFILE данные остаются как есть.
+func sealBlob(uid string, plain []byte) (version sql.NullInt64, wrapped, data []byte, err error) {
+	if keyring == nil {
+		return version, nil, plain, nil
+	}
+	dek, version, wrapped, err := newDEK(uid)
+	if err != nil {
+		return version, nil, nil, err
+	}
+	data, err = seal(dek, plain, uid+"/blob")
+	return version, wrapped, data, err
+}
+
+func openBlob(uid string, version sql.NullInt64, wrapped, data []byte) ([]byte, error) {
+	if !version.Valid {
+		return data, nil
+	}
+	dek, err := openDEK(uid, version, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return unseal(dek, data, uid+"/blob")
+}
+
+func insertDeliveryTx(tx *sql.Tx, uid string, d Delivery) error {
+	s, err := sealDelivery(uid, d)
+	if err != nil {
+		return fmt.Errorf("шифрование контактов: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email, key_version, dek, phone_bidx, email_bidx)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		uid, s.Name, s.Phone, s.Zip, s.City, s.Address, s.Region, s.Email, s.keyVersion, s.dek, s.phoneIdx, s.emailIdx)
+	return err
+}
+
+// === Ротация ключей ===
+
+type keyStatus struct {
+	Enabled       bool           `json:"enabled"`
+	ActiveVersion int            `json:"active_version,omitempty"`
+	Versions      []int          `json:"versions,omitempty"`
+	Rows          map[string]int `json:"rows"`         // строк deliveries по версии ключа; plain — открытым текстом
+	Archive       map[string]int `json:"archive"`      // то же для архива заказов
+	DeadLetters   map[string]int `json:"dead_letters"` // то же для тел сообщений DLQ
+}
+
+type keyRotationReport struct {
+	ActiveVersion int      `json:"active_version"`
+	Rotated       int      `json:"rotated"`
+	Failed        []string `json:"failed"` // order_uid строк (dlq:<id> — сообщений DLQ), которые не удалось расшифровать
+	DurationMs    int64    `json:"duration_ms"`
+}
+
+func currentKeyStatus() (keyStatus, error) {
+	st := keyStatus{Enabled: keyring != nil}
+	if keyring != nil {
+		st.ActiveVersion, st.Versions = keyring.active, keyring.versions()
+	}
+	var err error
+	if st.Rows, err = countByKeyVersion("deliveries"); err != nil {
+		return st, err
+	}
+	if st.Archive, err = countByKeyVersion("archived_orders"); err != nil {
+		return st, err
+	}
+	st.DeadLetters, err = countByKeyVersion("dead_letters")
+	return st, err
+}
+
+// countByKeyVersion считает строки по версиям ключа во всех шардах.
+func countByKeyVersion(table string) (map[string]int, error) {
+	counts := map[string]int{}
+	err := eachShard(func(s *shard) error {
+		rows, err := s.db.Query("SELECT key_version, COUNT(*) FROM " + table + " GROUP BY 1")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var v sql.NullInt64
+			var n int
+			if err := rows.Scan(&v, &n); err != nil {
+				return err
+			}
+			key := "plain"
+			if v.Valid {
+				key = strconv.FormatInt(v.Int64, 10)
+			}
+			counts[key] += n
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// rotateDataKeys перешифровывает новым ключом данных и активным
+// мастер-ключом все строки deliveries, архива и DLQ, записанные другим ключом
+// или открытым текстом. Строки идут пачками по rotateBatch, каждая пачка —
+// своя транзакция, так что прерванную ротацию можно просто запустить снова.
+// Шарды перешифровываются по очереди.
+func rotateDataKeys() (keyRotationReport, error) {
+	rep := keyRotationReport{ActiveVersion: keyring.active, Failed: []string{}}
+	start := time.Now()
+	err := eachShard(func(s *shard) error {
+		for _, batch := range []func(*shard, string, *keyRotationReport) (int, string, error){rotateBatchTx, rotateArchiveBatchTx} {
+			after := ""
+			for {
+				n, last, err := batch(s, after, &rep)
+				if err != nil {
+					return err
+				}
+				if n == 0 {
+					break
+				}
+				after = last
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = rotateDeadLetters(&rep)
+	}
+	if err != nil {
+		return rep, err
+	}
+	rep.DurationMs = time.Since(start).Milliseconds()
+	return rep, nil
+}
+
+func rotateBatchTx(s *shard, after string, rep *keyRotationReport) (n int, last string, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT order_uid, COALESCE(name, ''), COALESCE(phone, ''), COALESCE(address, ''), COALESCE(email, ''), key_version, dek
+		FROM deliveries
+		WHERE key_version IS DISTINCT FROM $1 AND anonymized_at IS NULL AND order_uid > $2
+		ORDER BY order_uid
+		LIMIT $3
+		FOR UPDATE`, keyring.active, after, rotateBatch)
+	if err != nil {
+		return 0, "", err
+	}
+	type row struct {
+		uid string
+		s   storedDelivery
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.uid, &r.s.Name, &r.s.Phone, &r.s.Address, &r.s.Email, &r.s.keyVersion, &r.s.dek); err != nil {
+			rows.Close()
+			return 0, "", err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+
+	for _, r := range batch {
+		d, err := openDelivery(r.uid, r.s)
+		if err != nil {
+			log.Printf(" Ротация ключей: %v", err)
+			rep.Failed = append(rep.Failed, r.uid)
+			continue
+		}
+		s, err := sealDelivery(r.uid, d)
+		if err != nil {
+			return 0, "", err
+		}
+		_, err = tx.Exec(`
+			UPDATE deliveries SET name = $2, phone = $3, address = $4, email = $5,
+				key_version = $6, dek = $7, phone_bidx = $8, email_bidx = $9
+			WHERE order_uid = $1`,
+			r.uid, s.Name, s.Phone, s.Address, s.Email, s.keyVersion, s.dek, s.phoneIdx, s.emailIdx)
+		if err != nil {
+			return 0, "", err
+		}
+		rep.Rotated++
+	}
+	if len(batch) == 0 {
+		return 0, "", nil
+	}
+	return len(batch), batch[len(batch)-1].uid, tx.Commit()
+}
+
+// === HTTP: GET /admin/keys и POST /admin/keys/rotate (только для админа) ===
+func keyStatusHandler(w http.ResponseWriter, r *http.Request) {
+	st, err := currentKeyStatus()
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+func rotateKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if keyring == nil {
+		http.Error(w, "Шифрование выключено: сервис запущен без PII_KEYFILE", http.StatusConflict)
+		return
+	}
+	rep, err := rotateDataKeys()
+	if err != nil {
+		log.Printf(" Ротация ключей прервана после %d строк: %v", rep.Rotated, err)
+		http.Error(w, fmt.Sprintf("Ротация прервана после %d строк: %v", rep.Rotated, err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf(" Ротация ключей: перешифровано %d строк ключом v%d, ошибок %d за %d мс",
+		rep.Rotated, rep.ActiveVersion, len(rep.Failed), rep.DurationMs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
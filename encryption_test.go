@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useKeyring включает шифрование на время теста: ключи версий versions
+// (последняя — активная) и общий ключ index. Ключ версии v одинаков во всех
+// вызовах теста, как в файле ключей, из которого убирают или добавляют
+// строки.
+func useKeyring(t *testing.T, versions ...int) {
+	t.Helper()
+	k := &piiKeyring{keys: map[int][]byte{}, index: bytes.Repeat([]byte{'i'}, 32)}
+	for _, v := range versions {
+		k.keys[v] = bytes.Repeat([]byte{byte(v)}, 32)
+		k.active = v
+	}
+	prev := keyring
+	keyring = k
+	t.Cleanup(func() { keyring = prev })
+}
+
+func TestLoadKeyring(t *testing.T) {
+	key := func() string {
+		b := make([]byte, 32)
+		rand.Read(b)
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	write := func(text string) string {
+		path := filepath.Join(t.TempDir(), "keys")
+		if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	k, err := loadKeyring(write("# ключи\nindex " + key() + "\n2 " + key() + "\n\n1 " + key() + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.active != 2 || len(k.versions()) != 2 {
+		t.Errorf("активный ключ v%d, версии %v", k.active, k.versions())
+	}
+
+	bad := map[string]string{
+		"нет index":          "1 " + key() + "\n",
+		"нет версий":         "index " + key() + "\n",
+		"короткий ключ":      "index " + key() + "\n1 c2hvcnQ=\n",
+		"версия не число":    "index " + key() + "\nv1 " + key() + "\n",
+		"версия повторяется": "index " + key() + "\n1 " + key() + "\n1 " + key() + "\n",
+	}
+	for name, text := range bad {
+		if _, err := loadKeyring(write(text)); err == nil {
+			t.Errorf("%s: файл принят", name)
+		}
+	}
+}
+
+func TestSealDelivery(t *testing.T) {
+	useKeyring(t, 1)
+	d := loadFixture(t, "basic").Delivery
+
+	s, err := sealDelivery("uid-1", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name == d.Name || s.Phone == d.Phone || s.Email == d.Email || s.Address == d.Address {
+		t.Errorf("контакты не зашифрованы: %+v", s.Delivery)
+	}
+	if s.City != d.City || s.Zip != d.Zip || s.Region != d.Region {
+		t.Errorf("город, индекс и регион должны остаться открытыми: %+v", s.Delivery)
+	}
+	if got, err := openDelivery("uid-1", s); err != nil || got != d {
+		t.Errorf("расшифровано %+v, %v", got, err)
+	}
+
+	// Шифротекст привязан к заказу и полю
+	if _, err := openDelivery("uid-2", s); err == nil {
+		t.Error("строка расшифрована под чужим order_uid")
+	}
+	swapped := s
+	swapped.Phone, swapped.Email = s.Email, s.Phone
+	if _, err := openDelivery("uid-1", swapped); err == nil {
+		t.Error("переставленные поля расшифрованы")
+	}
+
+	version, dek, data, err := sealBlob("uid-1", []byte("заказ"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := openBlob("uid-1", version, dek, data); err != nil || string(plain) != "заказ" {
+		t.Errorf("blob: %q, %v", plain, err)
+	}
+	if _, err := openBlob("uid-2", version, dek, data); err == nil {
+		t.Error("blob расшифрован под чужим order_uid")
+	}
+}
+
+func TestSealWithoutKeyring(t *testing.T) {
+	prev := keyring
+	keyring = nil
+	t.Cleanup(func() { keyring = prev })
+
+	d := loadFixture(t, "basic").Delivery
+	s, err := sealDelivery("uid-1", d)
+	if err != nil || s.Delivery != d || s.keyVersion.Valid || s.phoneIdx.Valid {
+		t.Errorf("без ключей строка изменена: %+v, %v", s, err)
+	}
+	version, _, data, err := sealBlob("uid-1", []byte("заказ"))
+	if err != nil || version.Valid || string(data) != "заказ" {
+		t.Errorf("без ключей blob изменён: %q, %v", data, err)
+	}
+}
+
+func TestOpenAfterKeyChange(t *testing.T) {
+	useKeyring(t, 1)
+	d := loadFixture(t, "basic").Delivery
+	old, err := sealDelivery("uid-1", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Новый ключ добавлен, старый ещё в файле: старые строки читаются,
+	// новые пишутся новым ключом
+	useKeyring(t, 1, 2)
+	if got, err := openDelivery("uid-1", old); err != nil || got != d {
+		t.Errorf("строка ключа v1: %+v, %v", got, err)
+	}
+	if s, err := sealDelivery("uid-1", d); err != nil || s.keyVersion.Int64 != 2 {
+		t.Errorf("новая строка: ключ v%d, %v", s.keyVersion.Int64, err)
+	}
+
+	// Старый ключ убран до ротации
+	useKeyring(t, 2)
+	if _, err := openDelivery("uid-1", old); err == nil {
+		t.Error("строка ключа v1 расшифрована без него")
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	useKeyring(t, 1)
+	same := [][2]string{
+		{"+7 (999) 123-45-67", "89991234567"},
+		{"+7 (999) 123-45-67", "7 999 123 45 67"},
+	}
+	for _, p := range same {
+		if keyring.phoneIndex(p[0]) != keyring.phoneIndex(p[1]) {
+			t.Errorf("телефоны %q и %q дают разные индексы", p[0], p[1])
+		}
+	}
+	if keyring.emailIndex(" Ivan@Example.com") != keyring.emailIndex("ivan@example.com") {
+		t.Error("email с другим регистром дал другой индекс")
+	}
+	if keyring.phoneIndex("+7 (999) 123-45-67") == keyring.phoneIndex("+7 (999) 123-45-68") {
+		t.Error("разные телефоны дали один индекс")
+	}
+	if keyring.phoneIndex("79991234567") == keyring.blindIndex("email", "79991234567") {
+		t.Error("индексы телефона и email совпадают")
+	}
+	if keyring.phoneIndex("нет").Valid || keyring.emailIndex(" ").Valid {
+		t.Error("пустое значение проиндексировано")
+	}
+
+	// Ключ index при ротации не меняется, поэтому индекс тоже
+	before := keyring.phoneIndex("89991234567")
+	useKeyring(t, 1, 2)
+	if keyring.phoneIndex("89991234567") != before {
+		t.Error("индекс изменился со сменой мастер-ключа")
+	}
+}
+
+func TestRotateDataKeys(t *testing.T) {
+	needDB(t)
+	useKeyring(t, 1)
+	orders := saveFixtures(t, "basic", "clothes")
+	bad := loadFixture(t, "kids")
+	bad.Items = nil
+	payload, _ := json.Marshal(bad)
+	saveDeadLetter("nats", payload, bad.OrderUID, errors.New("нет товаров"))
+
+	useKeyring(t, 1, 2)
+	rep, err := rotateDataKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Rotated != len(orders)+1 || len(rep.Failed) != 0 {
+		t.Errorf("отчёт %+v", rep)
+	}
+	st, err := currentKeyStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Rows["2"] != len(orders) || st.Rows["1"] != 0 || st.DeadLetters["2"] != 1 {
+		t.Errorf("после ротации: строки %v, DLQ %v", st.Rows, st.DeadLetters)
+	}
+
+	// Старый ключ убран: всё читается, поиск по слепому индексу работает
+	useKeyring(t, 2)
+	for _, o := range orders {
+		got, err := getOrderFromDB(o.OrderUID)
+		if err != nil || got.Delivery != o.Delivery {
+			t.Errorf("%s: %+v, %v", o.OrderUID, got.Delivery, err)
+		}
+	}
+	srv := newTestServer(t)
+	resp := doRequest(t, srv, "GET", "/orders?q="+url.QueryEscape("8"+normalizePhone(orders[0].Delivery.Phone)[1:]), testManagerToken, nil)
+	var list orderList
+	if err := json.Unmarshal(readBody(t, resp), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 || list.Orders[0].OrderUID != orders[0].OrderUID {
+		t.Errorf("поиск по телефону: %+v", list)
+	}
+
+	resp = doRequest(t, srv, "GET", "/admin/dlq", testAdminToken, nil)
+	var dlq deadLetterList
+	if err := json.Unmarshal(readBody(t, resp), &dlq); err != nil {
+		t.Fatal(err)
+	}
+	if dlq.Total != 1 || dlq.Items[0].Payload != string(payload) || dlq.Items[0].PayloadError != "" {
+		t.Errorf("DLQ: %+v", dlq)
+	}
+	var stored []byte
+	if err := db.QueryRow("SELECT payload FROM dead_letters").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, []byte(bad.Delivery.Phone)) {
+		t.Error("тело сообщения DLQ хранится открытым текстом")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+// === Удаление персональных данных покупателя ===
+// По запросу покупателя его контакты (имя, телефон, email, адрес, индекс)
+// стираются во всех заказах с его customer_id. Заказы, платежи и товары
+// остаются для бухгалтерии; город и регион тоже — они нужны статистике и
+// человека не определяют. Вместе с контактами удаляются сообщения DLQ по
+// этим заказам: в их теле лежит исходный заказ целиком. Заказы в архиве
+// перезаписываются обезличенными.
+
+type erasureReport struct {
+	CustomerID    string     `json:"customer_id"`
+	DryRun        bool       `json:"dry_run"`
+	Orders        []string   `json:"orders"`         // заказы, в которых стираются контакты
+	AlreadyErased int        `json:"already_erased"` // заказы, обезличенные раньше
+	Archived      int        `json:"archived"`       // из них в архиве (retention.go)
+	DeadLetters   int        `json:"dead_letters"`   // сообщения DLQ по этим заказам
+	AuditID       int64      `json:"audit_id,omitempty"`
+	ErasedAt      *time.Time `json:"erased_at,omitempty"`
+}
+
+// eraseCustomer стирает контакты в заказах покупателя; при dryRun только
+// считает, что будет затронуто. Запись в журнал аудита делается в той же
+// транзакции. При шардировании (shards.go) у каждого шарда своя
+// транзакция: они фиксируются раньше основной с DLQ и аудитом, так что
+// после сбоя между ними повторный вызов допишет аудит по уже стёртым
+// заказам.
+func eraseCustomer(r *http.Request, customerID, reason string, dryRun bool) (erasureReport, error) {
+	rep := erasureReport{CustomerID: customerID, DryRun: dryRun, Orders: []string{}}
+	tx, err := db.Begin()
+	if err != nil {
+		return rep, err
+	}
+	defer tx.Rollback()
+
+	var parts []*shardErasure
+	var uids []string // все заказы покупателя, для DLQ
+	for _, s := range router.shards {
+		stx := tx
+		if s.db != db {
+			if stx, err = s.db.Begin(); err != nil {
+				return rep, err
+			}
+			defer stx.Rollback()
+		}
+		p, err := lockCustomerTx(stx, customerID, &rep)
+		if err != nil {
+			return rep, err
+		}
+		parts = append(parts, p)
+		uids = append(uids, p.uids...)
+	}
+	if len(rep.Orders) == 0 && rep.AlreadyErased == 0 {
+		return rep, nil
+	}
+
+	if dryRun {
+		err = tx.QueryRow("SELECT COUNT(*) FROM dead_letters WHERE order_uid = ANY($1)", pq.Array(uids)).
+			Scan(&rep.DeadLetters)
+		return rep, err
+	}
+
+	versions := make(map[string]int64)
+	var hot []string
+	for _, p := range parts {
+		if err := p.eraseTx(customerID, versions); err != nil {
+			return rep, err
+		}
+		hot = append(hot, p.hot...)
+	}
+	res, err := tx.Exec("DELETE FROM dead_letters WHERE order_uid = ANY($1)", pq.Array(uids))
+	if err != nil {
+		return rep, err
+	}
+	n, _ := res.RowsAffected()
+	rep.DeadLetters = int(n)
+
+	// В журнал — только идентификаторы: стёртых данных там быть не должно
+	rep.AuditID, err = writeAudit(tx, r, "customer.erase", customerID, map[string]any{
+		"reason":         reason,
+		"orders":         rep.Orders,
+		"already_erased": rep.AlreadyErased,
+		"dead_letters":   rep.DeadLetters,
+	})
+	if err != nil {
+		return rep, err
+	}
+	for _, p := range parts {
+		if p.tx != tx {
+			if err := p.tx.Commit(); err != nil {
+				return rep, err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return rep, err
+	}
+	kickOutbox()
+	now := time.Now()
+	rep.ErasedAt = &now
+
+	// Кэш и backlog событий держат заказы целиком — перечитываем их из БД
+	for _, uid := range hot {
+		order, err := getOrderFromDB(uid)
+		if err != nil {
+			log.Printf(" Заказ %s обезличен в БД, но не перечитан в кэш: %v", uid, err)
+			cacheDelete(uid, 0)
+			continue
+		}
+		cachePut(order, versions[uid])
+		events.replaceOrder(order)
+	}
+	return rep, nil
+}
+
+// shardErasure — заказы покупателя в одном шарде, заблокированные в tx.
+type shardErasure struct {
+	tx       *sql.Tx
+	uids     []string   // все заказы покупателя в шарде, и в архиве тоже
+	refs     []orderRef // заказы, где контакты ещё не стёрты
+	hot      []string   // из них не в архиве
+	archived []Order    // из них в архиве, расшифрованные
+}
+
+// lockCustomerTx блокирует заказы покупателя в шарде и добавляет их в отчёт.
+func lockCustomerTx(tx *sql.Tx, customerID string, rep *erasureReport) (*shardErasure, error) {
+	p := &shardErasure{tx: tx}
+	rows, err := tx.Query(`
+		SELECT o.order_uid, COALESCE(o.entry, ''), COALESCE(o.delivery_service, ''), d.anonymized_at IS NOT NULL
+		FROM orders o
+		JOIN deliveries d ON d.order_uid = o.order_uid
+		WHERE o.customer_id = $1
+		ORDER BY o.order_uid
+		FOR UPDATE OF d`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var ref orderRef
+		var erased bool
+		if err := rows.Scan(&ref.OrderUID, &ref.Entry, &ref.DeliveryService, &erased); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.uids = append(p.uids, ref.OrderUID)
+		if erased {
+			rep.AlreadyErased++
+		} else {
+			rep.Orders = append(rep.Orders, ref.OrderUID)
+			p.refs = append(p.refs, ref)
+			p.hot = append(p.hot, ref.OrderUID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if p.archived, err = lockArchivedTx(tx, customerID, rep, &p.uids); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// eraseTx стирает контакты в заблокированных заказах шарда и добавляет
+// новые версии заказов в versions.
+func (p *shardErasure) eraseTx(customerID string, versions map[string]int64) error {
+	_, err := p.tx.Exec(`
+		UPDATE deliveries SET name = '', phone = '', zip = '', address = '', email = '',
+			key_version = NULL, dek = NULL, phone_bidx = NULL, email_bidx = NULL, anonymized_at = now()
+		WHERE anonymized_at IS NULL AND order_uid IN (SELECT order_uid FROM orders WHERE customer_id = $1)`, customerID)
+	if err != nil {
+		return err
+	}
+	bumped, err := bumpVersionsTx(p.tx, p.hot)
+	if err != nil {
+		return err
+	}
+	for uid, v := range bumped {
+		versions[uid] = v
+	}
+	refs := p.refs
+	for _, order := range p.archived {
+		refs = append(refs, refOf(order))
+		for _, f := range piiFields {
+			*f.field(&order.Delivery) = ""
+		}
+		if err := writeArchivedTx(p.tx, order, true); err != nil {
+			return err
+		}
+	}
+	for _, ref := range refs {
+		if err := writeOutboxTx(p.tx, eventOrderUpdated, ref, outboxUpdate{Reason: "customer.erase"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bumpVersionsTx присваивает изменённым заказам новые версии и сообщает о
+// них остальным экземплярам сервиса.
+func bumpVersionsTx(tx *sql.Tx, uids []string) (map[string]int64, error) {
+	versions := make(map[string]int64, len(uids))
+	for _, uid := range uids {
+		version, err := nextVersion()
+		if err != nil {
+			return nil, err
+		}
+		res, err := tx.Exec("UPDATE orders SET version = $2 WHERE order_uid = $1", uid, version)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		versions[uid] = version
+		if err := notifyOrderTx(tx, uid, version, false); err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// lockArchivedTx блокирует заказы покупателя в архиве, добавляет их в отчёт
+// и в uids и возвращает расшифрованными те, где контакты ещё не стёрты.
+func lockArchivedTx(tx *sql.Tx, customerID string, rep *erasureReport, uids *[]string) ([]Order, error) {
+	rows, err := tx.Query(`
+		SELECT order_uid, anonymized_at IS NOT NULL, key_version, dek, data
+		FROM archived_orders
+		WHERE customer_id = $1
+		ORDER BY order_uid
+		FOR UPDATE`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		var uid string
+		var erased bool
+		var version sql.NullInt64
+		var dek, data []byte
+		if err := rows.Scan(&uid, &erased, &version, &dek, &data); err != nil {
+			return nil, err
+		}
+		*uids = append(*uids, uid)
+		if erased {
+			rep.AlreadyErased++
+			continue
+		}
+		rep.Archived++
+		order, err := decodeArchived(uid, version, dek, data)
+		if err != nil {
+			return nil, err
+		}
+		rep.Orders = append(rep.Orders, uid)
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// === HTTP: POST /admin/customers/{customer_id}/erase (только для админа) ===
+// dry_run=1 — только показать затронутые заказы; reason — основание
+// (номер обращения), попадает в журнал аудита.
+func eraseCustomerHandler(w http.ResponseWriter, r *http.Request) {
+	customerID := chi.URLParam(r, "customer_id")
+	q := r.URL.Query()
+	dryRun := q.Get("dry_run") == "1"
+	reason := strings.TrimSpace(q.Get("reason"))
+	if reason == "" && !dryRun {
+		http.Error(w, "Укажите reason — основание удаления (например, номер обращения)", http.StatusBadRequest)
+		return
+	}
+
+	rep, err := eraseCustomer(r, customerID, reason, dryRun)
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(rep.Orders) == 0 && rep.AlreadyErased == 0 {
+		http.Error(w, "Заказов покупателя не найдено", http.StatusNotFound)
+		return
+	}
+	if !dryRun {
+		log.Printf(" Контакты покупателя %s стёрты в %d заказах (аудит #%d)", customerID, len(rep.Orders), rep.AuditID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
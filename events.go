@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// === Лента событий (Server-Sent Events) ===
+
+const (
+	eventBacklogSize   = 500
+	eventSubscriberBuf = 64
+	eventHeartbeat     = 20 * time.Second
+	eventRetryMillis   = 3000
+)
+
+type event struct {
+	ID        uint64
+	Type      string
+	AdminOnly bool
+	Data      []byte
+	Order     *Order // для событий order — заказ целиком (для gRPC WatchOrders)
+}
+
+type rejectionEvent struct {
+	OrderUID string    `json:"order_uid,omitempty"`
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+}
+
+type eventSubscriber struct {
+	ch    chan event
+	admin bool
+}
+
+// eventHub раздаёт события подписчикам /events и хранит последние
+// eventBacklogSize событий, чтобы переподключившийся клиент мог догнать
+// пропущенное по Last-Event-ID.
+type eventHub struct {
+	mu      sync.Mutex
+	nextID  uint64
+	backlog []event
+	subs    map[*eventSubscriber]struct{}
+}
+
+func newEventHub() *eventHub {
+	// ID начинаются с текущего времени, чтобы после перезапуска сервиса они
+	// не повторяли уже выданные клиентам.
+	return &eventHub{
+		nextID: uint64(time.Now().UnixMicro()),
+		subs:   make(map[*eventSubscriber]struct{}),
+	}
+}
+
+var events = newEventHub()
+
+func (h *eventHub) publish(typ string, adminOnly bool, payload any, order *Order) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf(" Не удалось сериализовать событие %s: %v", typ, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	ev := event{ID: h.nextID, Type: typ, AdminOnly: adminOnly, Data: data, Order: order}
+	h.backlog = append(h.backlog, ev)
+	if len(h.backlog) > eventBacklogSize {
+		h.backlog = h.backlog[len(h.backlog)-eventBacklogSize:]
+	}
+
+	for s := range h.subs {
+		if ev.AdminOnly && !s.admin {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			// Медленный клиент: закрываем поток, браузер переподключится
+			// с Last-Event-ID и получит пропущенное из backlog.
+			delete(h.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// orderSaved публикует заказ, только что записанный в БД.
+func (h *eventHub) orderSaved(order Order) {
+	h.publish("order", false, summarizeOrder(order), &order)
+}
+
+// orderRejected публикует отказ в приёме заказа; видят его только админы.
+func (h *eventHub) orderRejected(uid, reason string) {
+	h.publish("rejected", true, rejectionEvent{OrderUID: uid, Reason: reason, At: time.Now()}, nil)
+}
+
+// replaceOrder подменяет заказ в событиях backlog, например после удаления
+// из него персональных данных.
+func (h *eventHub) replaceOrder(order Order) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, ev := range h.backlog {
+		if ev.Order != nil && ev.Order.OrderUID == order.OrderUID {
+			o := order
+			h.backlog[i].Order = &o
+		}
+	}
+}
+
+// subscribe регистрирует подписчика и под той же блокировкой возвращает
+// события после lastID, так что между backlog и каналом ничего не теряется.
+func (h *eventHub) subscribe(lastID uint64, admin bool) ([]event, *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var missed []event
+	if lastID > 0 {
+		for _, ev := range h.backlog {
+			if ev.ID > lastID && (admin || !ev.AdminOnly) {
+				missed = append(missed, ev)
+			}
+		}
+	}
+
+	s := &eventSubscriber{ch: make(chan event, eventSubscriberBuf), admin: admin}
+	h.subs[s] = struct{}{}
+	return missed, s
+}
+
+func (h *eventHub) unsubscribe(s *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
+
+func summarizeOrder(order Order) orderSummary {
+	return orderSummary{
+		OrderUID:        order.OrderUID,
+		TrackNumber:     order.TrackNumber,
+		DateCreated:     order.DateCreated,
+		CustomerID:      order.CustomerID,
+		DeliveryService: order.DeliveryService,
+		ItemCount:       len(order.Items),
+		Amount:          order.Payment.Amount,
+		Currency:        order.Payment.Currency,
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+	return err
+}
+
+// === HTTP: GET /events ===
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	// Браузер сам шлёт Last-Event-ID при переподключении; параметр нужен,
+	// когда клиент создаёт новый EventSource после окончательного обрыва.
+	lastRaw := r.Header.Get("Last-Event-ID")
+	if lastRaw == "" {
+		lastRaw = r.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if lastRaw != "" {
+		id, err := strconv.ParseUint(lastRaw, 10, 64)
+		if err != nil {
+			http.Error(w, "некорректный Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	missed, sub := events.subscribe(lastID, streamRole(r) == roleAdmin)
+	defer events.unsubscribe(sub)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetryMillis)
+	for _, ev := range missed {
+		if writeEvent(w, ev) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			if writeEvent(w, ev) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
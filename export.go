@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// === Выгрузка заказов: GET /export?format=csv|ndjson|xlsx&layout=order|item ===
+// Фильтры и сортировка — как у GET /orders, страницы нет. Заказы читаются
+// одним запросом и пишутся в ответ по мере чтения, поэтому размер выгрузки
+// не ограничен памятью. При шардировании запрос идёт в каждый шард, а
+// потоки сливаются в общем порядке сортировки.
+
+var exportFormats = map[string]struct {
+	contentType string
+	ext         string
+}{
+	"csv":    {"text/csv; charset=utf-8", "csv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+	"xlsx":   {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"},
+}
+
+var exportLayouts = []string{"order", "item"}
+
+// exportColumn — колонка плоской выгрузки. it == nil для раскладки order.
+type exportColumn struct {
+	name  string
+	value func(o *exportOrder, it *Item) any
+}
+
+var orderHeadColumns = []exportColumn{
+	{"order_uid", func(o *exportOrder, _ *Item) any { return o.OrderUID }},
+	{"track_number", func(o *exportOrder, _ *Item) any { return o.TrackNumber }},
+	{"date_created", func(o *exportOrder, _ *Item) any { return o.DateCreated }},
+	{"customer_id", func(o *exportOrder, _ *Item) any { return o.CustomerID }},
+	{"delivery_service", func(o *exportOrder, _ *Item) any { return o.DeliveryService }},
+}
+
+// exportOrderColumns — строка на заказ: заказ, получатель, оплата.
+var exportOrderColumns = append(append([]exportColumn{}, orderHeadColumns...),
+	exportColumn{"entry", func(o *exportOrder, _ *Item) any { return o.Entry }},
+	exportColumn{"locale", func(o *exportOrder, _ *Item) any { return o.Locale }},
+	exportColumn{"name", func(o *exportOrder, _ *Item) any { return o.Delivery.Name }},
+	exportColumn{"phone", func(o *exportOrder, _ *Item) any { return o.Delivery.Phone }},
+	exportColumn{"email", func(o *exportOrder, _ *Item) any { return o.Delivery.Email }},
+	exportColumn{"zip", func(o *exportOrder, _ *Item) any { return o.Delivery.Zip }},
+	exportColumn{"region", func(o *exportOrder, _ *Item) any { return o.Delivery.Region }},
+	exportColumn{"city", func(o *exportOrder, _ *Item) any { return o.Delivery.City }},
+	exportColumn{"address", func(o *exportOrder, _ *Item) any { return o.Delivery.Address }},
+	exportColumn{"transaction", func(o *exportOrder, _ *Item) any { return o.Payment.Transaction }},
+	exportColumn{"provider", func(o *exportOrder, _ *Item) any { return o.Payment.Provider }},
+	exportColumn{"bank", func(o *exportOrder, _ *Item) any { return o.Payment.Bank }},
+	exportColumn{"currency", func(o *exportOrder, _ *Item) any { return o.Payment.Currency }},
+	exportColumn{"amount", func(o *exportOrder, _ *Item) any { return amount(o.Payment.Amount) }},
+	exportColumn{"goods_total", func(o *exportOrder, _ *Item) any { return amount(o.Payment.GoodsTotal) }},
+	exportColumn{"delivery_cost", func(o *exportOrder, _ *Item) any { return amount(o.Payment.DeliveryCost) }},
+	exportColumn{"custom_fee", func(o *exportOrder, _ *Item) any { return amount(o.Payment.CustomFee) }},
+	exportColumn{"payment_dt", func(o *exportOrder, _ *Item) any { return time.Unix(o.Payment.PaymentDt, 0).UTC() }},
+	exportColumn{"item_count", func(o *exportOrder, _ *Item) any { return len(o.Items) }},
+)
+
+// exportItemColumns — строка на товар с ключевыми полями заказа.
+var exportItemColumns = append(append([]exportColumn{}, orderHeadColumns...),
+	exportColumn{"currency", func(o *exportOrder, _ *Item) any { return o.Payment.Currency }},
+	exportColumn{"chrt_id", func(_ *exportOrder, it *Item) any { return it.ChrtID }},
+	exportColumn{"nm_id", func(_ *exportOrder, it *Item) any { return it.NmID }},
+	exportColumn{"rid", func(_ *exportOrder, it *Item) any { return it.Rid }},
+	exportColumn{"item_name", func(_ *exportOrder, it *Item) any { return it.Name }},
+	exportColumn{"brand", func(_ *exportOrder, it *Item) any { return it.Brand }},
+	exportColumn{"size", func(_ *exportOrder, it *Item) any { return it.Size }},
+	exportColumn{"price", func(_ *exportOrder, it *Item) any { return amount(it.Price) }},
+	exportColumn{"sale", func(_ *exportOrder, it *Item) any { return it.Sale }},
+	exportColumn{"total_price", func(_ *exportOrder, it *Item) any { return amount(it.TotalPrice) }},
+	exportColumn{"status", func(_ *exportOrder, it *Item) any { return it.Status }},
+)
+
+// exportAmount — сумма в единицах валюты («1817.50»): в CSV и NDJSON как
+// есть, в XLSX — числом.
+type exportAmount string
+
+func amount(m Money) exportAmount { return exportAmount(m.Decimal()) }
+
+func (a exportAmount) MarshalJSON() ([]byte, error) { return []byte(a), nil }
+
+// exportOrder — заказ в выгрузке. rate — курс пересчёта в валюту отчёта
+// reportCurrency; nil, если пересчёт не запрошен или курса на дату оплаты нет.
+type exportOrder struct {
+	*Order
+	reportCurrency string
+	rate           *big.Rat
+}
+
+// fxRate — курс пересчёта для выгрузки; пусто, если курса нет.
+func (o *exportOrder) fxRate() any {
+	if o.rate == nil {
+		return ""
+	}
+	return exportAmount(o.rate.FloatString(8))
+}
+
+// report пересчитывает сумму в валюту отчёта; пусто, если курса нет.
+func (o *exportOrder) report(m Money) any {
+	if o.rate == nil {
+		return ""
+	}
+	v, err := m.Convert(o.rate, o.reportCurrency)
+	if err != nil {
+		return ""
+	}
+	return amount(v)
+}
+
+// reportColumns — колонки пересчёта в валюту отчёта (report_currency).
+func reportColumns(perItem bool) []exportColumn {
+	cols := []exportColumn{
+		{"report_currency", func(o *exportOrder, _ *Item) any { return o.reportCurrency }},
+		{"fx_rate", func(o *exportOrder, _ *Item) any { return o.fxRate() }},
+	}
+	if perItem {
+		return append(cols, exportColumn{"total_price_report", func(o *exportOrder, it *Item) any { return o.report(it.TotalPrice) }})
+	}
+	return append(cols, exportColumn{"amount_report", func(o *exportOrder, _ *Item) any { return o.report(o.Payment.Amount) }})
+}
+
+func columnNames(cols []exportColumn) []string {
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.name
+	}
+	return names
+}
+
+// exportEncoder пишет заказы в одном из форматов.
+type exportEncoder interface {
+	writeOrder(o *exportOrder) error
+	close() error
+}
+
+// rowEncoder раскладывает заказ на строки (одну или по товару) и отдаёт
+// их в writeRow конкретного формата.
+type rowEncoder struct {
+	cols     []exportColumn
+	perItem  bool
+	writeRow func(cells []any) error
+	closeFn  func() error
+}
+
+func (e *rowEncoder) writeOrder(o *exportOrder) error {
+	if !e.perItem {
+		return e.writeRow(e.cells(o, nil))
+	}
+	for i := range o.Items {
+		if err := e.writeRow(e.cells(o, &o.Items[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *rowEncoder) cells(o *exportOrder, it *Item) []any {
+	cells := make([]any, len(e.cols))
+	for i, c := range e.cols {
+		cells[i] = c.value(o, it)
+	}
+	return cells
+}
+
+func (e *rowEncoder) close() error { return e.closeFn() }
+
+// csvText защищает текст из заказа (имя, адрес, бренд и т. п.) от CSV
+// injection: значение, с которого Excel или LibreOffice начали бы формулу,
+// пишется с апострофом впереди (рекомендация OWASP). Суммы и числа — не
+// строки и сюда не попадают, так что «-5.00» остаётся числом. В XLSX текст
+// пишется строкой (inlineStr) и формулой не бывает.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func newCSVEncoder(w io.Writer, cols []exportColumn, perItem bool) (exportEncoder, error) {
+	// BOM, чтобы Excel открыл UTF-8 без мастера импорта
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columnNames(cols)); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(cols))
+	return &rowEncoder{
+		cols:    cols,
+		perItem: perItem,
+		writeRow: func(cells []any) error {
+			for i, v := range cells {
+				switch v := v.(type) {
+				case time.Time:
+					record[i] = v.Format(time.RFC3339)
+				case string:
+					record[i] = csvText(v)
+				default:
+					record[i] = fmt.Sprint(v)
+				}
+			}
+			return cw.Write(record)
+		},
+		closeFn: func() error {
+			cw.Flush()
+			return cw.Error()
+		},
+	}, nil
+}
+
+func newXLSXEncoder(w io.Writer, cols []exportColumn, perItem bool) (exportEncoder, error) {
+	x, err := newXLSXWriter(w, "Заказы")
+	if err != nil {
+		return nil, err
+	}
+	if err := x.writeHeader(columnNames(cols)); err != nil {
+		return nil, err
+	}
+	return &rowEncoder{cols: cols, perItem: perItem, writeRow: x.writeRow, closeFn: x.close}, nil
+}
+
+// ndjsonEncoder: раскладка order — заказ целиком, как в GET /order/{uid}
+// (такой файл понимают orderctl import и publish), с пересчётом в валюту
+// отчёта в поле report; item — плоский объект с колонками cols.
+type ndjsonEncoder struct {
+	bw      *bufio.Writer
+	enc     *json.Encoder
+	cols    []exportColumn
+	perItem bool
+}
+
+// ndjsonReport — поле report заказа в NDJSON. null — курса на дату оплаты нет.
+type ndjsonReport struct {
+	Currency string        `json:"currency"`
+	Rate     *exportAmount `json:"rate"`
+	Amount   *exportAmount `json:"amount"`
+}
+
+func (e *ndjsonEncoder) writeOrder(o *exportOrder) error {
+	if !e.perItem {
+		if o.reportCurrency == "" {
+			return e.enc.Encode(o.Order)
+		}
+		rep := &ndjsonReport{Currency: o.reportCurrency}
+		if rate, ok := o.fxRate().(exportAmount); ok {
+			rep.Rate = &rate
+		}
+		if a, ok := o.report(o.Payment.Amount).(exportAmount); ok {
+			rep.Amount = &a
+		}
+		return e.enc.Encode(struct {
+			*Order
+			Report *ndjsonReport `json:"report"`
+		}{o.Order, rep})
+	}
+	for i := range o.Items {
+		// Ключи в порядке колонок, как в CSV
+		e.bw.WriteByte('{')
+		for j, c := range e.cols {
+			if j > 0 {
+				e.bw.WriteByte(',')
+			}
+			key, _ := json.Marshal(c.name)
+			val, err := json.Marshal(c.value(o, &o.Items[i]))
+			if err != nil {
+				return err
+			}
+			e.bw.Write(key)
+			e.bw.WriteByte(':')
+			e.bw.Write(val)
+		}
+		if _, err := e.bw.WriteString("}\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ndjsonEncoder) close() error { return e.bw.Flush() }
+
+func newExportEncoder(w io.Writer, format, layout, reportCurrency string) (exportEncoder, error) {
+	perItem := layout == "item"
+	cols := exportOrderColumns
+	if perItem {
+		cols = exportItemColumns
+	}
+	if reportCurrency != "" {
+		cols = append(append([]exportColumn{}, cols...), reportColumns(perItem)...)
+	}
+	switch format {
+	case "csv":
+		return newCSVEncoder(w, cols, perItem)
+	case "xlsx":
+		return newXLSXEncoder(w, cols, perItem)
+	}
+	bw := bufio.NewWriterSize(w, 64<<10)
+	return &ndjsonEncoder{bw: bw, enc: json.NewEncoder(bw), cols: cols, perItem: perItem}, nil
+}
+
+// === Чтение заказов для выгрузки ===
+// Заказ, получатель, оплата и товары приходят одним запросом: строка на
+// товар, строки одного заказа идут подряд. Последняя колонка — курс
+// пересчёта в валюту отчёта, если она задана.
+func queryExportOrders(sdb *sql.DB, f orderFilter, collateC bool) (*sql.Rows, error) {
+	where, args := f.where()
+	rate, fxJoin := "NULL", ""
+	if f.ReportCurrency != "" {
+		rate, fxJoin = "fx.rate::text", fxJoinSQL(f.ReportCurrency)
+	}
+	return sdb.Query(fmt.Sprintf(`
+		SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature, o.customer_id,
+			o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+			COALESCE(d.name, ''), COALESCE(d.phone, ''), COALESCE(d.zip, ''), COALESCE(d.city, ''),
+			COALESCE(d.address, ''), COALESCE(d.region, ''), COALESCE(d.email, ''), d.key_version, d.dek,
+			COALESCE(p.transaction, ''), COALESCE(p.request_id, ''), COALESCE(p.currency, ''),
+			COALESCE(p.provider, ''), COALESCE(p.amount, 0), COALESCE(p.payment_dt, 0), COALESCE(p.bank, ''),
+			COALESCE(p.delivery_cost, 0), COALESCE(p.goods_total, 0), COALESCE(p.custom_fee, 0),
+			i.chrt_id, i.track_number, i.price, i.rid, i.name, i.sale, i.size, i.total_price, i.nm_id, i.brand, i.status,
+			(SELECT COUNT(*) FROM items ic WHERE ic.order_uid = o.order_uid) AS item_count,
+			%s
+		FROM orders o
+		LEFT JOIN deliveries d ON d.order_uid = o.order_uid
+		LEFT JOIN payments p ON p.order_uid = o.order_uid
+		%s
+		LEFT JOIN items i ON i.order_uid = o.order_uid
+		%s
+		ORDER BY %s, i.chrt_id`, rate, fxJoin, where, f.orderBy(collateC)), args...)
+}
+
+func (o *exportOrder) sortKey() orderSortKey {
+	return orderSortKey{o.OrderUID, o.DateCreated, o.CustomerID, o.DeliveryService, o.Payment.Currency,
+		len(o.Items), o.Payment.Amount.Minor}
+}
+
+// errExportStopped останавливает чтение шардов, когда слияние прервано.
+var errExportStopped = errors.New("выгрузка остановлена")
+
+// mergeExportOrders читает заказы из нескольких шардов параллельно и
+// передаёт их в fn в общем порядке сортировки f: каждый поток уже
+// отсортирован, так что достаточно каждый раз брать наименьший из голов.
+func mergeExportOrders(shardRows []*sql.Rows, f orderFilter, fn func(o *exportOrder) error) (int, error) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(done)
+
+	streams := make([]chan *exportOrder, len(shardRows))
+	errs := make([]error, len(shardRows))
+	for i, rows := range shardRows {
+		streams[i] = make(chan *exportOrder, 64)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(streams[i])
+			_, errs[i] = scanExportOrders(rows, f.ReportCurrency, func(o *exportOrder) error {
+				select {
+				case streams[i] <- o:
+					return nil
+				case <-done:
+					return errExportStopped
+				}
+			})
+		}()
+	}
+
+	heads := make([]*exportOrder, len(streams))
+	next := func(i int) error {
+		o, ok := <-streams[i]
+		heads[i] = o
+		if !ok {
+			return errs[i] // поток закрыт: записанная ошибка уже видна
+		}
+		return nil
+	}
+	for i := range streams {
+		if err := next(i); err != nil {
+			return 0, err
+		}
+	}
+	n := 0
+	last := ""
+	for {
+		best := -1
+		for i, o := range heads {
+			if o != nil && (best < 0 || f.compareSortKeys(o.sortKey(), heads[best].sortKey()) < 0) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return n, nil
+		}
+		// Копии заказа, который переносит rebalance, идут подряд
+		if uid := heads[best].OrderUID; uid != last {
+			if err := fn(heads[best]); err != nil {
+				return n, err
+			}
+			n++
+			last = uid
+		}
+		if err := next(best); err != nil {
+			return n, err
+		}
+	}
+}
+
+// scanExportOrders собирает строки в заказы и передаёт каждый в fn.
+func scanExportOrders(rows *sql.Rows, reportCurrency string, fn func(o *exportOrder) error) (int, error) {
+	var cur *exportOrder
+	n := 0
+	for rows.Next() {
+		var o Order
+		var it struct {
+			chrtID, nmID                  sql.NullInt64
+			price, sale, total, status    sql.NullInt64
+			track, rid, name, size, brand sql.NullString
+		}
+		var itemCount int
+		var rate sql.NullString
+		var d storedDelivery
+		err := rows.Scan(&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerID,
+			&o.DeliveryService, &o.Shardkey, &o.SmID, &o.DateCreated, &o.OofShard,
+			&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email, &d.keyVersion, &d.dek,
+			&o.Payment.Transaction, &o.Payment.RequestID, &o.Payment.Currency,
+			&o.Payment.Provider, &o.Payment.Amount.Minor, &o.Payment.PaymentDt, &o.Payment.Bank,
+			&o.Payment.DeliveryCost.Minor, &o.Payment.GoodsTotal.Minor, &o.Payment.CustomFee.Minor,
+			&it.chrtID, &it.track, &it.price, &it.rid, &it.name, &it.sale, &it.size, &it.total, &it.nmID, &it.brand, &it.status,
+			&itemCount, &rate)
+		if err != nil {
+			return n, err
+		}
+
+		if cur == nil || cur.OrderUID != o.OrderUID {
+			if cur != nil {
+				setOrderCurrency(cur.Order)
+				if err := fn(cur); err != nil {
+					return n, err
+				}
+				n++
+			}
+			if o.Delivery, err = openDelivery(o.OrderUID, d); err != nil {
+				return n, err
+			}
+			o.Items = make([]Item, 0, itemCount)
+			cur = &exportOrder{Order: &o, reportCurrency: reportCurrency, rate: parseRate(rate.String)}
+		}
+		if it.chrtID.Valid {
+			cur.Items = append(cur.Items, Item{
+				ChrtID: it.chrtID.Int64, TrackNumber: it.track.String, Price: Money{Minor: it.price.Int64},
+				Rid: it.rid.String, Name: it.name.String, Sale: int(it.sale.Int64), Size: it.size.String,
+				TotalPrice: Money{Minor: it.total.Int64}, NmID: it.nmID.Int64, Brand: it.brand.String, Status: int(it.status.Int64),
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if cur != nil {
+		setOrderCurrency(cur.Order)
+		if err := fn(cur); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// === HTTP: GET /export ===
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	ft, ok := exportFormats[format]
+	if !ok {
+		http.Error(w, "format должен быть csv, ndjson или xlsx", http.StatusBadRequest)
+		return
+	}
+	layout := q.Get("layout")
+	if layout == "" {
+		layout = "order"
+	}
+	if !slices.Contains(exportLayouts, layout) {
+		http.Error(w, "layout должен быть order или item", http.StatusBadRequest)
+		return
+	}
+	f, err := parseOrderFilter(q, requestRole(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Запросы ко всем шардам — до первых байт ответа, чтобы их ошибки
+	// ещё можно было вернуть статусом
+	sharded := len(router.shards) > 1
+	var shardRows []*sql.Rows
+	defer func() {
+		for _, rows := range shardRows {
+			rows.Close()
+		}
+	}()
+	err = eachShard(func(s *shard) error {
+		rows, err := queryExportOrders(s.db, f, sharded)
+		if err == nil {
+			shardRows = append(shardRows, rows)
+		}
+		return err
+	})
+	if err != nil {
+		http.Error(w, "Ошибка чтения заказов: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("orders-%s-%s.%s", layout, time.Now().Format("20060102-150405"), ft.ext)
+	w.Header().Set("Content-Type", ft.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+
+	// После первых байт статус уже не поменять: при ошибке ответ обрывается,
+	// клиент увидит неполный файл.
+	enc, err := newExportEncoder(w, format, layout, f.ReportCurrency)
+	if err != nil {
+		log.Printf(" Ошибка выгрузки: %v", err)
+		return
+	}
+	ro := requestRole(r)
+	write := func(o *exportOrder) error {
+		if !ro.seesPII() {
+			o.Delivery = maskDelivery(o.Delivery)
+		}
+		return enc.writeOrder(o)
+	}
+	var n int
+	if sharded {
+		n, err = mergeExportOrders(shardRows, f, write)
+	} else {
+		n, err = scanExportOrders(shardRows[0], f.ReportCurrency, write)
+	}
+	if err == nil {
+		err = enc.close()
+	}
+	if err != nil {
+		log.Printf(" Выгрузка прервана после %d заказов: %v", n, err)
+		panic(http.ErrAbortHandler)
+	}
+}
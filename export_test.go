@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"order-service-demo/model"
+)
+
+func TestCSVFormulaInjection(t *testing.T) {
+	o := loadFixture(t, "basic")
+	o.Delivery.Name = "=HYPERLINK(\"http://evil.example\",\"Иван\")"
+	o.Delivery.Address = "@SUM(1+1)"
+	o.Delivery.City = "-2+3"
+	o.Delivery.Region = "\t=1"
+	o.Payment.Bank = "+cmd|' /C calc'!A0"
+	o.Payment.CustomFee = model.FromMinor(-500, "RUB") // отрицательная сумма — число, не формула
+
+	var buf bytes.Buffer
+	enc, err := newCSVEncoder(&buf, exportOrderColumns, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.writeOrder(&exportOrder{Order: &o}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("строк %d", len(records))
+	}
+	row := map[string]string{}
+	for i, name := range records[0] {
+		row[name] = records[1][i]
+	}
+	want := map[string]string{
+		"name":       "'" + o.Delivery.Name,
+		"address":    "'@SUM(1+1)",
+		"city":       "'-2+3",
+		"region":     "'\t=1",
+		"bank":       "'" + o.Payment.Bank,
+		"phone":      "'" + o.Delivery.Phone, // +7 ... тоже начало формулы
+		"custom_fee": "-5.00",
+		"amount":     "1817.00",
+		"order_uid":  o.OrderUID,
+		"email":      o.Delivery.Email,
+	}
+	for col, v := range want {
+		if row[col] != v {
+			t.Errorf("%s: %q, ожидалось %q", col, row[col], v)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"order-service-demo/api/orderpb"
+)
+
+// === gRPC API (orders.v1.OrderService) ===
+
+type orderGRPCServer struct {
+	orderpb.UnimplementedOrderServiceServer
+}
+
+// grpcRole определяет роль по метаданным authorization: Bearer <токен>,
+// с теми же токенами, что и HTTP API.
+func grpcRole(ctx context.Context) role {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(v, "Bearer "); ok {
+			return tokenRole(strings.TrimSpace(token))
+		}
+	}
+	return roleAnonymous
+}
+
+func (orderGRPCServer) GetOrder(ctx context.Context, req *orderpb.GetOrderRequest) (*orderpb.Order, error) {
+	if req.GetOrderUid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_uid обязателен")
+	}
+
+	order, exists := cacheGet(req.GetOrderUid())
+	if !exists {
+		var err error
+		order, err = findArchivedOrder(req.GetOrderUid())
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "заказ %s не найден", req.GetOrderUid())
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "ошибка чтения архива: %v", err)
+		}
+	}
+	return orderToProto(orderFor(order, grpcRole(ctx))), nil
+}
+
+func (orderGRPCServer) GetByTrackNumber(ctx context.Context, req *orderpb.GetByTrackNumberRequest) (*orderpb.Order, error) {
+	if req.GetTrackNumber() == "" {
+		return nil, status.Error(codes.InvalidArgument, "track_number обязателен")
+	}
+
+	// Самый новый заказ с этим трек-номером среди всех шардов
+	var uid string
+	var latest time.Time
+	err := eachShard(func(s *shard) error {
+		var u string
+		var created sql.NullTime
+		err := s.db.QueryRowContext(ctx, `
+			SELECT order_uid, date_created FROM orders WHERE track_number = $1
+			ORDER BY date_created DESC LIMIT 1`, req.GetTrackNumber()).Scan(&u, &created)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err == nil && (uid == "" || created.Time.After(latest)) {
+			uid, latest = u, created.Time
+		}
+		return err
+	})
+	if err == nil && uid == "" {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "заказ с трек-номером %s не найден", req.GetTrackNumber())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка БД: %v", err)
+	}
+
+	order, exists := cacheGet(uid)
+	if !exists {
+		if order, err = getOrderFromDB(uid); err != nil {
+			return nil, status.Errorf(codes.Internal, "ошибка БД: %v", err)
+		}
+	}
+	return orderToProto(orderFor(order, grpcRole(ctx))), nil
+}
+
+// ListOrders переводит запрос в параметры GET /orders, чтобы проверка и
+// значения по умолчанию были одни и те же.
+func (orderGRPCServer) ListOrders(ctx context.Context, req *orderpb.ListOrdersRequest) (*orderpb.ListOrdersResponse, error) {
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	if req.GetPage() != 0 {
+		set("page", strconv.Itoa(int(req.GetPage())))
+	}
+	if req.GetLimit() != 0 {
+		set("limit", strconv.Itoa(int(req.GetLimit())))
+	}
+	set("q", req.GetQuery())
+	set("sort", req.GetSort())
+	set("order", req.GetOrder())
+	set("customer_id", req.GetCustomerId())
+	set("delivery_service", req.GetDeliveryService())
+	set("currency", req.GetCurrency())
+	if req.DateFrom != nil {
+		set("date_from", req.GetDateFrom().AsTime().Format(time.RFC3339Nano))
+	}
+	if req.DateTo != nil {
+		set("date_to", req.GetDateTo().AsTime().Format(time.RFC3339Nano))
+	}
+
+	f, err := parseOrderFilter(q, grpcRole(ctx))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	list, err := listOrdersFromDB(f)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "ошибка чтения списка заказов: %v", err)
+	}
+
+	resp := &orderpb.ListOrdersResponse{
+		Total: int32(list.Total),
+		Page:  int32(list.Page),
+		Limit: int32(list.Limit),
+	}
+	for _, s := range list.Orders {
+		resp.Orders = append(resp.Orders, summaryToProto(s))
+	}
+	return resp, nil
+}
+
+// WatchOrders отдаёт заказы из той же ленты событий, что и GET /events.
+// Если клиент не успевает читать, поток закрывается с Unavailable, и
+// клиент продолжает с after_event_id последнего полученного события.
+func (orderGRPCServer) WatchOrders(req *orderpb.WatchOrdersRequest, stream grpc.ServerStreamingServer[orderpb.OrderEvent]) error {
+	missed, sub := events.subscribe(req.GetAfterEventId(), false)
+	defer events.unsubscribe(sub)
+	ro := grpcRole(stream.Context())
+
+	send := func(ev event) error {
+		if ev.Type != "order" || ev.Order == nil {
+			return nil
+		}
+		return stream.Send(&orderpb.OrderEvent{EventId: ev.ID, Order: orderToProto(orderFor(*ev.Order, ro))})
+	}
+
+	for _, ev := range missed {
+		if err := send(ev); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-sub.ch:
+			if !ok {
+				return status.Error(codes.Unavailable, "клиент отстал от ленты, переподключитесь с after_event_id")
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// === Преобразование моделей в protobuf ===
+func orderToProto(o Order) *orderpb.Order {
+	pb := &orderpb.Order{
+		OrderUid:    o.OrderUID,
+		TrackNumber: o.TrackNumber,
+		Entry:       o.Entry,
+		Delivery: &orderpb.Delivery{
+			Name:    o.Delivery.Name,
+			Phone:   o.Delivery.Phone,
+			Zip:     o.Delivery.Zip,
+			City:    o.Delivery.City,
+			Address: o.Delivery.Address,
+			Region:  o.Delivery.Region,
+			Email:   o.Delivery.Email,
+		},
+		Payment: &orderpb.Payment{
+			Transaction:  o.Payment.Transaction,
+			RequestId:    o.Payment.RequestID,
+			Currency:     o.Payment.Currency,
+			Provider:     o.Payment.Provider,
+			Amount:       o.Payment.Amount.Minor,
+			PaymentDt:    o.Payment.PaymentDt,
+			Bank:         o.Payment.Bank,
+			DeliveryCost: o.Payment.DeliveryCost.Minor,
+			GoodsTotal:   o.Payment.GoodsTotal.Minor,
+			CustomFee:    o.Payment.CustomFee.Minor,
+		},
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerId:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		Shardkey:          o.Shardkey,
+		SmId:              int32(o.SmID),
+		DateCreated:       timestamppb.New(o.DateCreated),
+		OofShard:          o.OofShard,
+	}
+	for _, it := range o.Items {
+		pb.Items = append(pb.Items, &orderpb.Item{
+			ChrtId:      it.ChrtID,
+			TrackNumber: it.TrackNumber,
+			Price:       it.Price.Minor,
+			Rid:         it.Rid,
+			Name:        it.Name,
+			Sale:        int32(it.Sale),
+			Size:        it.Size,
+			TotalPrice:  it.TotalPrice.Minor,
+			NmId:        it.NmID,
+			Brand:       it.Brand,
+			Status:      int32(it.Status),
+		})
+	}
+	return pb
+}
+
+func summaryToProto(s orderSummary) *orderpb.OrderSummary {
+	return &orderpb.OrderSummary{
+		OrderUid:        s.OrderUID,
+		TrackNumber:     s.TrackNumber,
+		DateCreated:     timestamppb.New(s.DateCreated),
+		CustomerId:      s.CustomerID,
+		DeliveryService: s.DeliveryService,
+		ItemCount:       int32(s.ItemCount),
+		Amount:          s.Amount.Minor,
+		Currency:        s.Currency,
+	}
+}
+
+// === Запуск gRPC-сервера (порт из GRPC_ADDR, по умолчанию :9090) ===
+func startGRPCServer(addr string) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(" Не удалось открыть порт gRPC:", err)
+	}
+	srv := grpc.NewServer()
+	orderpb.RegisterOrderServiceServer(srv, orderGRPCServer{})
+
+	log.Printf(" gRPC-сервер запущен на %s", addr)
+	if err := srv.Serve(lis); err != nil {
+		log.Fatal(" gRPC-сервер остановлен:", err)
+	}
+}
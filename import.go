@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"order-service-demo/model"
+)
+
+// === Массовый импорт: POST /admin/import ===
+// Загрузка исторических заказов из архивов. Заказы проверяются тем же
+// валидатором, что и при приёме, и пишутся пачками по batch заказов в одной
+// транзакции на шард. Уже известные order_uid, в том числе архивные,
+// пропускаются (как в saveOrderToDB), поэтому повторная отправка того же
+// файла безопасна.
+// Статистика приёма и лента событий импорт не видят: это не новые заказы;
+// внешние потребители получают order.saved через outbox, как при приёме.
+
+const (
+	defaultImportBatch = 500
+	maxImportBatch     = 5000
+	maxImportBody      = 256 << 20
+)
+
+// importResult — заказ из тела запроса, который не был сохранён.
+type importResult struct {
+	Record   int    `json:"record"` // номер заказа в теле запроса, с 1
+	OrderUID string `json:"order_uid,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+type importReport struct {
+	Records    int            `json:"records"`
+	Imported   int            `json:"imported"`
+	Skipped    []importResult `json:"skipped"`
+	Failed     []importResult `json:"failed"`
+	Cached     bool           `json:"cached"`
+	Error      string         `json:"error,omitempty"` // разбор тела прерван, остаток не прочитан
+	DurationMs int64          `json:"duration_ms"`
+}
+
+type importRecord struct {
+	record int
+	order  Order
+}
+
+// importBatch пишет пачку и возвращает версии заказов; versions[i] == 0 —
+// заказ уже был в БД. notify — сообщить остальным экземплярам, чтобы они
+// добавили заказы в свой кэш. Заказы разных шардов пишутся в транзакциях
+// своих шардов, которые фиксируются только после записи всей пачки, но по
+// очереди: если коммит одного шарда не прошёл, заказы уже зафиксированных
+// остаются в БД. Для них done[i] == true, и versions[i] верна и при ошибке.
+func importBatch(batch []importRecord, notify bool) (versions []int64, done []bool, err error) {
+	txs := make(map[*shard]*sql.Tx)
+	defer func() {
+		for _, tx := range txs {
+			tx.Rollback()
+		}
+	}()
+
+	versions, done = make([]int64, len(batch)), make([]bool, len(batch))
+	targets := make([]*shard, len(batch))
+	for i, rec := range batch {
+		target := router.routeOrder(rec.order)
+		dup, err := router.storedElsewhere(rec.order.OrderUID, target)
+		if err != nil {
+			return versions, done, fmt.Errorf("заказ %s: %w", rec.order.OrderUID, err)
+		}
+		if dup {
+			continue
+		}
+		tx := txs[target]
+		if tx == nil {
+			if tx, err = target.db.Begin(); err != nil {
+				return versions, done, err
+			}
+			txs[target] = tx
+		}
+		targets[i] = target
+		if versions[i], err = insertOrderTx(tx, rec.order); err != nil {
+			return versions, done, fmt.Errorf("заказ %s: %w", rec.order.OrderUID, err)
+		}
+		if versions[i] == 0 {
+			continue
+		}
+		if err := writeOutboxTx(tx, eventOrderSaved, refOf(rec.order), summarizeOrder(rec.order)); err != nil {
+			return versions, done, err
+		}
+		if notify {
+			if err := notifyOrderTx(tx, rec.order.OrderUID, versions[i], false); err != nil {
+				return versions, done, err
+			}
+		}
+	}
+	defer kickOutbox()
+	for _, s := range router.shards {
+		tx := txs[s]
+		if tx == nil {
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			return versions, done, fmt.Errorf("шард %s: %w", s.name, err)
+		}
+		for i := range batch {
+			if targets[i] == s {
+				done[i] = true
+			}
+		}
+	}
+	// Повторы, найденные в других шардах, тоже окончательны
+	for i := range done {
+		done[i] = true
+	}
+	return versions, done, nil
+}
+
+// orderImporter копит проверенные заказы и сбрасывает их пачками.
+type orderImporter struct {
+	batchSize int
+	useCache  bool
+	pending   []importRecord
+	report    importReport
+}
+
+func (im *orderImporter) fail(record int, uid, reason string) {
+	im.report.Failed = append(im.report.Failed, importResult{record, uid, reason})
+}
+
+func (im *orderImporter) add(record int, raw []byte) {
+	var order Order
+	if err := json.Unmarshal(raw, &order); err != nil {
+		im.fail(record, "", "невалидный JSON: "+err.Error())
+		return
+	}
+	if err := model.Validate(order); err != nil {
+		im.fail(record, order.OrderUID, err.Error())
+		return
+	}
+	im.pending = append(im.pending, importRecord{record, order})
+	if len(im.pending) >= im.batchSize {
+		im.flush()
+	}
+}
+
+func (im *orderImporter) flush() {
+	if len(im.pending) == 0 {
+		return
+	}
+	batch := im.pending
+	im.pending = im.pending[:0:0]
+
+	versions, done, err := importBatch(batch, im.useCache)
+	failed := make([]bool, len(batch))
+	if err != nil {
+		// Пачка записана не целиком: остальные заказы пишем по одному, чтобы
+		// ошибка досталась только виноватому. Заказы шардов, которые успели
+		// зафиксироваться, уже сохранены — их не повторяем, иначе они попали
+		// бы в отчёт как повторы
+		log.Printf(" Импорт: пачка из %d заказов не записана (%v), пишем по одному", len(batch), err)
+		for i, rec := range batch {
+			if done[i] {
+				continue
+			}
+			one, _, err := importBatch(batch[i:i+1], im.useCache)
+			if err != nil {
+				failed[i] = true
+				im.fail(rec.record, rec.order.OrderUID, "ошибка БД: "+err.Error())
+				continue
+			}
+			versions[i] = one[0]
+		}
+	}
+
+	for i, rec := range batch {
+		switch {
+		case failed[i]:
+			// уже в отчёте как ошибка
+		case versions[i] != 0:
+			im.report.Imported++
+			if im.useCache {
+				cachePut(rec.order, versions[i])
+			}
+		default:
+			im.report.Skipped = append(im.report.Skipped,
+				importResult{rec.record, rec.order.OrderUID, "заказ с таким order_uid уже есть (или в архиве)"})
+		}
+	}
+}
+
+// readImportBody читает заказы из тела: JSON-массив или поток объектов
+// (NDJSON). Каждый заказ передаётся в fn сырыми байтами.
+func readImportBody(r io.Reader, fn func(record int, raw []byte)) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	dec := json.NewDecoder(br)
+
+	array := false
+	for {
+		b, err := br.Peek(1)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			br.ReadByte()
+			continue
+		}
+		array = b[0] == '['
+		break
+	}
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	for record := 1; ; record++ {
+		if array && !dec.More() {
+			_, err := dec.Token() // закрывающая ]
+			return err
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF && !array {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("заказ %d: %w", record, err)
+		}
+		fn(record, raw)
+	}
+}
+
+func importOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	im := &orderImporter{batchSize: defaultImportBatch, useCache: r.URL.Query().Get("cache") != "0"}
+	if v := r.URL.Query().Get("batch"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxImportBatch {
+			http.Error(w, fmt.Sprintf("batch должен быть от 1 до %d", maxImportBatch), http.StatusBadRequest)
+			return
+		}
+		im.batchSize = n
+	}
+	im.report.Skipped, im.report.Failed, im.report.Cached = []importResult{}, []importResult{}, im.useCache
+
+	start := time.Now()
+	err := readImportBody(http.MaxBytesReader(w, r.Body, maxImportBody), func(record int, raw []byte) {
+		im.report.Records = record
+		im.add(record, raw)
+	})
+	im.flush()
+	im.report.DurationMs = time.Since(start).Milliseconds()
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge) && im.report.Records == 0:
+		http.Error(w, "Тело больше 256 МиБ: разбейте файл на части", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil && im.report.Records == 0:
+		http.Error(w, "Не удалось разобрать тело: "+err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		// Часть заказов уже записана — отдаём отчёт о том, что успели
+		im.report.Error = err.Error()
+	}
+
+	log.Printf(" Импорт: записей %d, сохранено %d, пропущено %d, ошибок %d за %d мс",
+		im.report.Records, im.report.Imported, len(im.report.Skipped), len(im.report.Failed), im.report.DurationMs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(im.report)
+}
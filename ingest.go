@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"order-service-demo/model"
+)
+
+// === Приём заказа (NATS и POST /orders) ===
+
+const maxOrderBody = 1 << 20
+
+// rejectError — заказ отклонён при разборе или проверке. Повторять такую
+// отправку бессмысленно, в отличие от ошибок БД.
+type rejectError struct {
+	reason string
+}
+
+func (e *rejectError) Error() string { return e.reason }
+
+// ingestOrder разбирает, проверяет и сохраняет заказ, обновляет кэш,
+// статистику приёма и ленту событий. Оба канала приёма идут через неё.
+// Версия 0 без ошибки — заказ с таким order_uid уже есть, ничего не записано.
+func ingestOrder(data []byte) (Order, int64, error) {
+	var order Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		log.Printf(" Невалидный JSON: %v", err)
+		ingestStats.recordRejected()
+		events.orderRejected("", "невалидный JSON: "+err.Error())
+		return order, 0, &rejectError{"невалидный JSON: " + err.Error()}
+	}
+
+	if err := model.Validate(order); err != nil {
+		log.Printf(" Отклонено: %v", err)
+		ingestStats.recordRejected()
+		events.orderRejected(order.OrderUID, err.Error())
+		return order, 0, &rejectError{err.Error()}
+	}
+	version, err := saveOrderToDB(order)
+	if err != nil {
+		log.Printf(" Ошибка сохранения в БД: %v", err)
+		return order, 0, err
+	}
+	if version == 0 {
+		// Повторная доставка: заказ уже сохранён и учтён при первом приёме
+		log.Printf(" Заказ %s уже известен, пропущен", order.OrderUID)
+		return order, 0, nil
+	}
+
+	cachePut(order, version)
+
+	ingestStats.recordAccepted(order.Payment.Amount.Float())
+	events.orderSaved(order)
+
+	log.Printf(" Заказ %s сохранён и закэширован", order.OrderUID)
+	return order, version, nil
+}
+
+// === HTTP: POST /orders (только для админа) ===
+// Тот же приём, что и из NATS, но с ответом: 201 — заказ сохранён и уже
+// виден в GET /order/{order_uid}, 409 — заказ с таким order_uid уже есть и
+// не перезаписан, 422 — отклонён.
+func postOrderHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOrderBody))
+	if err != nil {
+		http.Error(w, "Слишком большой или оборванный запрос: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	order, version, err := ingestOrder(data)
+	var rej *rejectError
+	switch {
+	case errors.As(err, &rej):
+		http.Error(w, rej.reason, http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, "Ошибка сохранения заказа", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/order/"+url.PathEscape(order.OrderUID))
+	if version == 0 {
+		http.Error(w, fmt.Sprintf("Заказ %s уже существует, ничего не сохранено", order.OrderUID), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(summarizeOrder(order))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/nats-io/stan.go"
+)
+
+// === Экземпляр сервиса и группа подписчиков NATS ===
+// Экземпляры с одной NATS_QUEUE_GROUP делят сообщения канала orders между
+// собой: каждое получает один из них (durable queue subscription, позиция
+// группы хранится на сервере NATS Streaming и переживает перезапуски всех
+// экземпляров). Если сообщение всё же придёт дважды — при повторной
+// доставке или переназначении — повтор безопасен: заказ с известным
+// order_uid не перезаписывается, а кэши остальных экземпляров обновляются
+// через NOTIFY (coherence.go).
+//
+// INSTANCE_ID отличает экземпляры: из него строится client id NATS,
+// который должен быть уникальным, — второй экземпляр с тем же id сервер
+// не пустит. По умолчанию — имя хоста.
+
+const (
+	defaultQueueGroup = "order-service"
+	natsDurableName   = "order-durable"
+	natsChannel       = "orders"
+)
+
+var (
+	natsQueueGroup = defaultQueueGroup
+	instanceID     string
+)
+
+// В client id NATS Streaming допустимы только буквы, цифры, - и _
+var natsIDInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// parseInstance читает NATS_QUEUE_GROUP и INSTANCE_ID.
+func parseInstance(group, id string) error {
+	if group != "" {
+		if natsIDInvalid.MatchString(group) {
+			return fmt.Errorf("NATS_QUEUE_GROUP=%q: допустимы буквы, цифры, - и _", group)
+		}
+		natsQueueGroup = group
+	}
+	if id == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("INSTANCE_ID не задан, а имя хоста неизвестно: %w", err)
+		}
+		id = host
+	}
+	// Имя хоста с точками приводим к допустимому виду
+	instanceID = strings.Trim(natsIDInvalid.ReplaceAllString(id, "-"), "-")
+	if instanceID == "" {
+		return fmt.Errorf("INSTANCE_ID=%q: нужны буквы или цифры", id)
+	}
+	return nil
+}
+
+// natsClientID — client id этого экземпляра в NATS Streaming.
+func natsClientID() string {
+	return natsQueueGroup + "-" + instanceID
+}
+
+// === Позиция в канале для новой группы ===
+// Позицию существующей группы NATS Streaming хранит сам и параметр начала
+// подписки для неё игнорирует. Новая группа (смена NATS_QUEUE_GROUP,
+// переход со старой подписки без группы) позиции не получает, а чтение
+// канала с начала вернуло бы удалённые и архивные заказы и задвоило DLQ.
+// Поэтому номер последнего обработанного сообщения пишется в nats_positions,
+// и новая группа начинает со следующего.
+
+// natsStartPosition — с какого сообщения начинать, если группа новая. Если
+// позиция ещё не записывалась (первый запуск после обновления), — с
+// последнего сообщения канала: его повтор безопасен.
+func natsStartPosition() (stan.SubscriptionOption, error) {
+	var seq int64
+	err := db.QueryRow(`SELECT sequence FROM nats_positions WHERE channel = $1`, natsChannel).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return stan.StartWithLastReceived(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stan.StartAtSequence(uint64(seq) + 1), nil
+}
+
+// saveNATSPosition запоминает обработанное сообщение. Экземпляры группы
+// обрабатывают сообщения параллельно, поэтому позиция только растёт.
+func saveNATSPosition(seq uint64) {
+	_, err := db.Exec(`
+		INSERT INTO nats_positions (channel, sequence) VALUES ($1, $2)
+		ON CONFLICT (channel) DO UPDATE
+		SET sequence = GREATEST(nats_positions.sequence, EXCLUDED.sequence), updated_at = now()`,
+		natsChannel, int64(seq))
+	if err != nil {
+		log.Printf(" Не удалось сохранить позицию в канале NATS: %v", err)
+	}
+}
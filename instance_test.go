@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nats-io/stan.go"
+	"github.com/nats-io/stan.go/pb"
+)
+
+func TestNATSStartPosition(t *testing.T) {
+	needDB(t)
+	start := func() stan.SubscriptionOptions {
+		t.Helper()
+		opt, err := natsStartPosition()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var o stan.SubscriptionOptions
+		if err := opt(&o); err != nil {
+			t.Fatal(err)
+		}
+		return o
+	}
+
+	if o := start(); o.StartAt != pb.StartPosition_LastReceived {
+		t.Errorf("без записанной позиции: %v", o.StartAt)
+	}
+	// Экземпляры группы подтверждают сообщения не по порядку
+	saveNATSPosition(41)
+	saveNATSPosition(42)
+	saveNATSPosition(40)
+	if o := start(); o.StartAt != pb.StartPosition_SequenceStart || o.StartSequence != 43 {
+		t.Errorf("после сообщения 42: %v с %d", o.StartAt, o.StartSequence)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// === Оперативная статистика приёма заказов (в памяти) ===
+
+// liveWindow — максимальная глубина истории; окна 5/15/60 минут считаются
+// по тем же поминутным корзинам.
+const liveWindow = 60
+
+var liveWindows = []int{5, 15, 60}
+
+type liveBucket struct {
+	minute   int64 // Unix-время начала минуты; 0 — корзина пуста
+	accepted int
+	rejected int
+	amount   float64
+}
+
+// liveStats — кольцо поминутных корзин. Индекс корзины — минута по модулю
+// liveWindow, устаревшая корзина обнуляется при первой записи в неё.
+type liveStats struct {
+	mu      sync.Mutex
+	buckets [liveWindow]liveBucket
+	started time.Time
+	now     func() time.Time
+}
+
+func newLiveStats() *liveStats {
+	return &liveStats{started: time.Now(), now: time.Now}
+}
+
+var ingestStats = newLiveStats()
+
+func (s *liveStats) bucket(t time.Time) *liveBucket {
+	minute := t.Unix() / 60
+	b := &s.buckets[minute%liveWindow]
+	if b.minute != minute {
+		*b = liveBucket{minute: minute}
+	}
+	return b
+}
+
+func (s *liveStats) recordAccepted(amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.bucket(s.now())
+	b.accepted++
+	b.amount += amount
+}
+
+func (s *liveStats) recordRejected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bucket(s.now()).rejected++
+}
+
+type liveWindowStats struct {
+	Minutes         int     `json:"minutes"`
+	Accepted        int     `json:"accepted"`
+	Rejected        int     `json:"rejected"`
+	OrdersPerMinute float64 `json:"orders_per_minute"`
+	RejectionRate   float64 `json:"rejection_rate"`
+	AvgAmount       float64 `json:"avg_amount"`
+}
+
+type liveMinute struct {
+	Minute   time.Time `json:"minute"`
+	Accepted int       `json:"accepted"`
+	Rejected int       `json:"rejected"`
+}
+
+type liveSnapshot struct {
+	At        time.Time         `json:"at"`
+	Windows   []liveWindowStats `json:"windows"`
+	PerMinute []liveMinute      `json:"per_minute"`
+}
+
+// snapshot считает окна, включая текущую неполную минуту. Если сервис
+// работает меньше окна, частота делится на фактически прошедшее время.
+func (s *liveStats) snapshot() liveSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	current := now.Unix() / 60
+	snap := liveSnapshot{At: now}
+
+	// Поминутный ряд от старых минут к новым
+	for i := liveWindow - 1; i >= 0; i-- {
+		m := current - int64(i)
+		lm := liveMinute{Minute: time.Unix(m*60, 0).UTC()}
+		if b := s.buckets[m%liveWindow]; b.minute == m {
+			lm.Accepted, lm.Rejected = b.accepted, b.rejected
+		}
+		snap.PerMinute = append(snap.PerMinute, lm)
+	}
+
+	uptime := now.Sub(s.started).Minutes()
+	for _, n := range liveWindows {
+		w := liveWindowStats{Minutes: n}
+		var amount float64
+		for i := 0; i < n; i++ {
+			m := current - int64(i)
+			if b := s.buckets[m%liveWindow]; b.minute == m {
+				w.Accepted += b.accepted
+				w.Rejected += b.rejected
+				amount += b.amount
+			}
+		}
+
+		span := float64(n)
+		if uptime < span {
+			span = max(uptime, 1)
+		}
+		w.OrdersPerMinute = float64(w.Accepted) / span
+		if total := w.Accepted + w.Rejected; total > 0 {
+			w.RejectionRate = float64(w.Rejected) / float64(total)
+		}
+		if w.Accepted > 0 {
+			w.AvgAmount = amount / float64(w.Accepted)
+		}
+		snap.Windows = append(snap.Windows, w)
+	}
+	return snap
+}
+
+// === HTTP: GET /stats/live ===
+func liveStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ingestStats.snapshot())
+}
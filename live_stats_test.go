@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeLiveStats — статистика со своими часами: сервис запущен за два часа
+// до start, окна заполнены целиком.
+func fakeLiveStats(start time.Time) (*liveStats, *time.Time) {
+	now := start
+	s := &liveStats{started: start.Add(-2 * time.Hour), now: func() time.Time { return now }}
+	return s, &now
+}
+
+func TestLiveStatsWindows(t *testing.T) {
+	start := time.Date(2024, 3, 2, 12, 0, 30, 0, time.UTC)
+	s, now := fakeLiveStats(start)
+	s.recordAccepted(100)
+	s.recordAccepted(300)
+	s.recordRejected()
+	*now = start.Add(10 * time.Minute)
+	s.recordAccepted(200)
+
+	snap := s.snapshot()
+	want := []liveWindowStats{
+		{Minutes: 5, Accepted: 1, OrdersPerMinute: 0.2, AvgAmount: 200},
+		{Minutes: 15, Accepted: 3, Rejected: 1, OrdersPerMinute: 0.2, RejectionRate: 0.25, AvgAmount: 200},
+		{Minutes: 60, Accepted: 3, Rejected: 1, OrdersPerMinute: 0.05, RejectionRate: 0.25, AvgAmount: 200},
+	}
+	if len(snap.Windows) != len(want) {
+		t.Fatalf("окон %d", len(snap.Windows))
+	}
+	for i, w := range want {
+		if snap.Windows[i] != w {
+			t.Errorf("окно %d мин: %+v, ожидалось %+v", w.Minutes, snap.Windows[i], w)
+		}
+	}
+
+	if len(snap.PerMinute) != liveWindow {
+		t.Fatalf("минут %d", len(snap.PerMinute))
+	}
+	last, earlier := snap.PerMinute[liveWindow-1], snap.PerMinute[liveWindow-11]
+	if last.Accepted != 1 || !last.Minute.Equal(start.Add(10*time.Minute).Truncate(time.Minute)) {
+		t.Errorf("текущая минута: %+v", last)
+	}
+	if earlier.Accepted != 2 || earlier.Rejected != 1 || !earlier.Minute.Equal(start.Truncate(time.Minute)) {
+		t.Errorf("10 минут назад: %+v", earlier)
+	}
+
+	// Через час корзина первой минуты занята заново, старые счётчики не
+	// попадают ни в окна, ни в ряд
+	*now = start.Add(time.Hour)
+	s.recordRejected()
+	snap = s.snapshot()
+	if w := snap.Windows[2]; w.Accepted != 1 || w.Rejected != 1 || w.AvgAmount != 200 {
+		t.Errorf("окно часа после круга: %+v", w)
+	}
+	if m := snap.PerMinute[liveWindow-1]; m.Accepted != 0 || m.Rejected != 1 {
+		t.Errorf("текущая минута после круга: %+v", m)
+	}
+}
+
+// TestLiveStatsUptime: пока сервис работает меньше окна, частота делится на
+// прошедшее время, но не меньше минуты.
+func TestLiveStatsUptime(t *testing.T) {
+	start := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	s, now := fakeLiveStats(start)
+	s.started = start
+
+	*now = start.Add(30 * time.Second)
+	s.recordAccepted(10)
+	if w := s.snapshot().Windows[0]; w.OrdersPerMinute != 1 {
+		t.Errorf("через 30 секунд: %+v", w)
+	}
+
+	*now = start.Add(3 * time.Minute)
+	s.recordAccepted(10)
+	s.recordAccepted(10)
+	for _, w := range s.snapshot().Windows {
+		if w.Accepted != 3 || w.OrdersPerMinute != 1 {
+			t.Errorf("через 3 минуты, окно %d мин: %+v", w.Minutes, w)
+		}
+	}
+
+	// Пустая статистика не делит на ноль
+	empty, _ := fakeLiveStats(start)
+	for _, w := range empty.snapshot().Windows {
+		if w != (liveWindowStats{Minutes: w.Minutes}) {
+			t.Errorf("без заказов: %+v", w)
+		}
+	}
+}
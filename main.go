@@ -3,71 +3,30 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	_ "github.com/lib/pq"
 	"github.com/nats-io/stan.go"
+
+	"order-service-demo/model"
 )
 
 // === Модели данных ===
-type Delivery struct {
-	Name    string `json:"name"`
-	Phone   string `json:"phone"`
-	Zip     string `json:"zip"`
-	City    string `json:"city"`
-	Address string `json:"address"`
-	Region  string `json:"region"`
-	Email   string `json:"email"`
-}
-
-type Payment struct {
-	Transaction   string `json:"transaction"`
-	RequestID     string `json:"request_id"`
-	Currency      string `json:"currency"`
-	Provider      string `json:"provider"`
-	Amount        int    `json:"amount"`
-	PaymentDt     int64  `json:"payment_dt"`
-	Bank          string `json:"bank"`
-	DeliveryCost  int    `json:"delivery_cost"`
-	GoodsTotal    int    `json:"goods_total"`
-	CustomFee     int    `json:"custom_fee"`
-}
-
-type Item struct {
-	ChrtID      int64  `json:"chrt_id"`
-	TrackNumber string `json:"track_number"`
-	Price       int    `json:"price"`
-	Rid         string `json:"rid"`
-	Name        string `json:"name"`
-	Sale        int    `json:"sale"`
-	Size        string `json:"size"`
-	TotalPrice  int    `json:"total_price"`
-	NmID        int64  `json:"nm_id"`
-	Brand       string `json:"brand"`
-	Status      int    `json:"status"`
-}
-
-type Order struct {
-	OrderUID          string    `json:"order_uid"`
-	TrackNumber       string    `json:"track_number"`
-	Entry             string    `json:"entry"`
-	Delivery          Delivery  `json:"delivery"`
-	Payment           Payment   `json:"payment"`
-	Items             []Item    `json:"items"`
-	Locale            string    `json:"locale"`
-	InternalSignature string    `json:"internal_signature"`
-	CustomerID        string    `json:"customer_id"`
-	DeliveryService   string    `json:"delivery_service"`
-	Shardkey          string    `json:"shardkey"`
-	SmID              int       `json:"sm_id"`
-	DateCreated       time.Time `json:"date_created"`
-	OofShard          string    `json:"oof_shard"`
-}
+// Структуры живут в пакете model, чтобы их без копирования использовали
+// клиентская библиотека и утилиты.
+type (
+	Order    = model.Order
+	Delivery = model.Delivery
+	Payment  = model.Payment
+	Item     = model.Item
+)
 
 // === Глобальные переменные ===
 var db *sql.DB
@@ -75,8 +34,9 @@ var orderCache = make(map[string]Order)
 var cacheMutex sync.RWMutex
 
 // === Инициализация БД (порт 5433) ===
+const connStr = "user=orderuser password=orderpass dbname=orderdb sslmode=disable host=localhost port=5433"
+
 func initDB() {
-	connStr := "user=orderuser password=orderpass dbname=orderdb sslmode=disable host=localhost port=5433"
 	var err error
 	db, err = sql.Open("postgres", connStr)
 	if err != nil {
@@ -88,63 +48,278 @@ func initDB() {
 	log.Println(" Подключение к PostgreSQL установлено")
 }
 
+// === Схема БД ===
+// migrateSchema создаёт и обновляет таблицы. Схема одна и для основной БД,
+// и для шардов (shards.go): в шарде таблицы, которые живут только в
+// основной БД, просто остаются пустыми.
+func migrateSchema(sdb *sql.DB) error {
+	_, err := sdb.Exec(`
+		CREATE TABLE IF NOT EXISTS orders (
+			order_uid TEXT PRIMARY KEY,
+			track_number TEXT,
+			entry TEXT,
+			locale TEXT,
+			internal_signature TEXT,
+			customer_id TEXT,
+			delivery_service TEXT,
+			shardkey TEXT,
+			sm_id INTEGER,
+			date_created TIMESTAMPTZ,
+			oof_shard TEXT
+		);
+		CREATE TABLE IF NOT EXISTS deliveries (
+			order_uid TEXT REFERENCES orders(order_uid) ON DELETE CASCADE,
+			name TEXT,
+			phone TEXT,
+			zip TEXT,
+			city TEXT,
+			address TEXT,
+			region TEXT,
+			email TEXT
+		);
+		CREATE SEQUENCE IF NOT EXISTS order_version_seq;
+		ALTER TABLE orders
+			ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT nextval('order_version_seq');
+		ALTER TABLE deliveries
+			ADD COLUMN IF NOT EXISTS key_version INTEGER,
+			ADD COLUMN IF NOT EXISTS dek BYTEA,
+			ADD COLUMN IF NOT EXISTS phone_bidx TEXT,
+			ADD COLUMN IF NOT EXISTS email_bidx TEXT,
+			ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMPTZ;
+		CREATE INDEX IF NOT EXISTS deliveries_order_uid_idx ON deliveries (order_uid);
+		CREATE INDEX IF NOT EXISTS deliveries_phone_bidx_idx ON deliveries (phone_bidx);
+		CREATE INDEX IF NOT EXISTS deliveries_email_bidx_idx ON deliveries (email_bidx);
+		CREATE TABLE IF NOT EXISTS payments (
+			order_uid TEXT REFERENCES orders(order_uid) ON DELETE CASCADE,
+			transaction TEXT,
+			request_id TEXT,
+			currency TEXT,
+			provider TEXT,
+			amount BIGINT,
+			payment_dt BIGINT,
+			bank TEXT,
+			delivery_cost BIGINT,
+			goods_total BIGINT,
+			custom_fee BIGINT
+		);
+		CREATE TABLE IF NOT EXISTS items (
+			order_uid TEXT REFERENCES orders(order_uid) ON DELETE CASCADE,
+			chrt_id BIGINT,
+			track_number TEXT,
+			price BIGINT,
+			rid TEXT,
+			name TEXT,
+			sale INTEGER,
+			size TEXT,
+			total_price BIGINT,
+			nm_id BIGINT,
+			brand TEXT,
+			status INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS orders_track_number_idx ON orders (track_number);
+		CREATE TABLE IF NOT EXISTS dead_letters (
+			id BIGSERIAL PRIMARY KEY,
+			received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			source TEXT NOT NULL,
+			order_uid TEXT,
+			reason TEXT NOT NULL,
+			payload BYTEA NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			resubmitted_at TIMESTAMPTZ
+		);
+		ALTER TABLE dead_letters
+			ADD COLUMN IF NOT EXISTS key_version INTEGER,
+			ADD COLUMN IF NOT EXISTS dek BYTEA;
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			actor TEXT NOT NULL,
+			remote_addr TEXT NOT NULL,
+			action TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			details JSONB NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS audit_log_subject_idx ON audit_log (subject);
+		CREATE TABLE IF NOT EXISTS archived_orders (
+			order_uid TEXT PRIMARY KEY,
+			customer_id TEXT,
+			date_created TIMESTAMPTZ,
+			archived_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			anonymized_at TIMESTAMPTZ,
+			key_version INTEGER,
+			dek BYTEA,
+			data BYTEA NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS archived_orders_customer_id_idx ON archived_orders (customer_id);
+		CREATE INDEX IF NOT EXISTS archived_orders_date_created_idx ON archived_orders (date_created);
+		ALTER TABLE archived_orders
+			ADD COLUMN IF NOT EXISTS shardkey TEXT,
+			ADD COLUMN IF NOT EXISTS oof_shard TEXT;
+		CREATE TABLE IF NOT EXISTS outbox (
+			id BIGSERIAL PRIMARY KEY,
+			event_type TEXT NOT NULL,
+			order_uid TEXT NOT NULL,
+			payload JSONB,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			published_at TIMESTAMPTZ,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT
+		);
+		CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE published_at IS NULL;
+		ALTER TABLE outbox
+			ADD COLUMN IF NOT EXISTS entry TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS delivery_service TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS webhooks_at TIMESTAMPTZ;
+		CREATE INDEX IF NOT EXISTS outbox_webhooks_idx ON outbox (id) WHERE webhooks_at IS NULL;
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id BIGSERIAL PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT[] NOT NULL DEFAULT '{}',
+			entries TEXT[] NOT NULL DEFAULT '{}',
+			delivery_services TEXT[] NOT NULL DEFAULT '{}',
+			enabled BOOLEAN NOT NULL DEFAULT true,
+			consecutive_failures INTEGER NOT NULL DEFAULT 0,
+			disabled_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			webhook_id BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event_id BIGINT NOT NULL,
+			event_type TEXT NOT NULL,
+			order_uid TEXT NOT NULL,
+			payload BYTEA NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMPTZ DEFAULT now(),
+			last_status INTEGER,
+			last_error TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			delivered_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id);
+		CREATE TABLE IF NOT EXISTS exchange_rates (
+			rate_date DATE NOT NULL,
+			currency VARCHAR(3) NOT NULL,
+			nominal INTEGER NOT NULL,
+			value NUMERIC(20, 8) NOT NULL,
+			PRIMARY KEY (currency, rate_date)
+		);
+		CREATE TABLE IF NOT EXISTS nats_positions (
+			channel TEXT PRIMARY KEY,
+			sequence BIGINT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+	`)
+	return err
+}
+
 // === Сохранение заказа в БД ===
-func saveOrderToDB(order Order) error {
-	tx, err := db.Begin()
+// Заказ с уже известным order_uid не меняет сохранённый: так повторная
+// доставка из NATS или повторный импорт не плодят дубликаты. Возвращает
+// версию записанного заказа; 0 — заказ уже был, в том числе в архиве.
+// Заказ пишется в шард по его shardkey (shards.go).
+func saveOrderToDB(order Order) (int64, error) {
+	target := router.routeOrder(order)
+	if dup, err := router.storedElsewhere(order.OrderUID, target); err != nil || dup {
+		return 0, err
+	}
+	tx, err := target.db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(`
-		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		ON CONFLICT (order_uid) DO NOTHING`,
-		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
-		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard)
+	version, err := insertOrderTx(tx, order)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if version != 0 {
+		if err := writeOutboxTx(tx, eventOrderSaved, refOf(order), summarizeOrder(order)); err != nil {
+			return 0, err
+		}
+		if err := notifyOrderTx(tx, order.OrderUID, version, false); err != nil {
+			return 0, err
+		}
 	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	kickOutbox()
+	return version, nil
+}
 
-	_, err = tx.Exec(`
-		INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
-		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
-		order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+// insertOrderTx записывает заказ в открытой транзакции и возвращает его
+// версию. 0 — заказ с таким order_uid уже есть, ничего не записано.
+func insertOrderTx(tx *sql.Tx, order Order) (int64, error) {
+	version, err := nextVersion()
 	if err != nil {
-		return err
+		return 0, err
+	}
+	err = tx.QueryRow(`
+		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (order_uid) DO NOTHING
+		RETURNING version`,
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OofShard, version).
+		Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err = insertDeliveryTx(tx, order.OrderUID, order.Delivery); err != nil {
+		return 0, err
 	}
 
 	_, err = tx.Exec(`
 		INSERT INTO payments (order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
 		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
-		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank,
-		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+		order.Payment.Provider, order.Payment.Amount.Minor, order.Payment.PaymentDt, order.Payment.Bank,
+		order.Payment.DeliveryCost.Minor, order.Payment.GoodsTotal.Minor, order.Payment.CustomFee.Minor)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	for _, item := range order.Items {
 		_, err = tx.Exec(`
 			INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
 			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
-			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
-			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
+			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price.Minor, item.Rid, item.Name,
+			item.Sale, item.Size, item.TotalPrice.Minor, item.NmID, item.Brand, item.Status)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	return tx.Commit()
+	return version, nil
 }
 
 // === Загрузка одного заказа из БД ===
+// Заказ ищется во всех шардах: после смены карты он может ещё лежать в
+// прежнем, пока его не перенесёт rebalance.
 func getOrderFromDB(uid string) (Order, error) {
+	for _, s := range router.shards {
+		order, err := getOrderFrom(s.db, uid)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return order, err
+		}
+	}
+	return Order{OrderUID: uid}, sql.ErrNoRows
+}
+
+// getOrderFrom читает заказ из одного шарда или из транзакции в нём.
+func getOrderFrom(q querier, uid string) (Order, error) {
 	var order Order
 	order.OrderUID = uid
 
-	err := db.QueryRow(`
+	err := q.QueryRow(`
 		SELECT track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
 		FROM orders WHERE order_uid = $1`, uid).
 		Scan(&order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature,
@@ -153,26 +328,30 @@ func getOrderFromDB(uid string) (Order, error) {
 		return order, err
 	}
 
-	err = db.QueryRow(`
-		SELECT name, phone, zip, city, address, region, email
+	var stored storedDelivery
+	err = q.QueryRow(`
+		SELECT name, phone, zip, city, address, region, email, key_version, dek
 		FROM deliveries WHERE order_uid = $1`, uid).
-		Scan(&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip,
-			&order.Delivery.City, &order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email)
+		Scan(&stored.Name, &stored.Phone, &stored.Zip, &stored.City, &stored.Address,
+			&stored.Region, &stored.Email, &stored.keyVersion, &stored.dek)
 	if err != nil {
 		return order, err
 	}
+	if order.Delivery, err = openDelivery(uid, stored); err != nil {
+		return order, err
+	}
 
-	err = db.QueryRow(`
+	err = q.QueryRow(`
 		SELECT transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
 		FROM payments WHERE order_uid = $1`, uid).
 		Scan(&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency,
-			&order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDt, &order.Payment.Bank,
-			&order.Payment.DeliveryCost, &order.Payment.GoodsTotal, &order.Payment.CustomFee)
+			&order.Payment.Provider, &order.Payment.Amount.Minor, &order.Payment.PaymentDt, &order.Payment.Bank,
+			&order.Payment.DeliveryCost.Minor, &order.Payment.GoodsTotal.Minor, &order.Payment.CustomFee.Minor)
 	if err != nil {
 		return order, err
 	}
 
-	rows, err := db.Query(`
+	rows, err := q.Query(`
 		SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
 		FROM items WHERE order_uid = $1`, uid)
 	if err != nil {
@@ -182,479 +361,223 @@ func getOrderFromDB(uid string) (Order, error) {
 
 	for rows.Next() {
 		var item Item
-		err := rows.Scan(&item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name,
-			&item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status)
+		err := rows.Scan(&item.ChrtID, &item.TrackNumber, &item.Price.Minor, &item.Rid, &item.Name,
+			&item.Sale, &item.Size, &item.TotalPrice.Minor, &item.NmID, &item.Brand, &item.Status)
 		if err != nil {
 			return order, err
 		}
 		order.Items = append(order.Items, item)
 	}
+	setOrderCurrency(&order)
 
 	return order, nil
 }
 
 // === Восстановление кэша из БД ===
-func loadCacheFromDB() {
-	rows, err := db.Query("SELECT order_uid FROM orders")
+// Кэш собирается в новой карте и подменяется целиком, поэтому так же
+// работает и перезагрузка через POST /admin/cache/reload.
+func loadCacheFromDB() error {
+	cacheReload.Lock()
+	defer cacheReload.Unlock()
+
+	start := time.Now()
+	cacheMutex.Lock()
+	cacheJournal = make(map[string]journalEntry)
+	cacheMutex.Unlock()
+
+	// Версия читается раньше заказа: если заказ успеют изменить, его
+	// следующая версия будет новее и всё равно дойдёт до кэша
+	versions := make(map[string]int64)
+	from := make(map[string]*shard)
+	err := eachShard(func(s *shard) error {
+		rows, err := s.db.Query("SELECT order_uid, version FROM orders")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var uid string
+			var version int64
+			rows.Scan(&uid, &version)
+			// Заказ, который rebalance как раз переносит, есть в двух
+			// шардах; новее — копия в новом
+			if version > versions[uid] {
+				versions[uid] = version
+				from[uid] = s
+			}
+		}
+		return rows.Err()
+	})
 	if err != nil {
 		log.Println(" Ошибка при загрузке UID из БД:", err)
-		return
-	}
-	defer rows.Close()
-
-	var uids []string
-	for rows.Next() {
-		var uid string
-		rows.Scan(&uid)
-		uids = append(uids, uid)
+		cacheMutex.Lock()
+		cacheJournal = nil
+		cacheMutex.Unlock()
+		return err
 	}
 
-	for _, uid := range uids {
-		order, err := getOrderFromDB(uid)
+	fresh := make(map[string]Order, len(versions))
+	for uid := range versions {
+		order, err := getOrderFrom(from[uid].db, uid)
 		if err != nil {
 			log.Printf(" Не удалось загрузить заказ %s из БД: %v", uid, err)
+			delete(versions, uid)
 			continue
 		}
-		cacheMutex.Lock()
-		orderCache[uid] = order
-		cacheMutex.Unlock()
+		fresh[uid] = order
 	}
-	log.Printf(" Кэш восстановлен из БД: %d заказов", len(uids))
+	replaceCache(fresh, versions, time.Since(start))
+	log.Printf(" Кэш восстановлен из БД: %d заказов", len(fresh))
+	return nil
 }
 
 // === Подписка на NATS Streaming (порт 4223) ===
+// Экземпляры делят сообщения через queue group (instance.go). Подписку не
+// отменяем (Unsubscribe), а только закрываем соединение: иначе durable
+// группы удалится вместе с её позицией в канале. Новая группа начинает с
+// позиции, записанной предыдущей (natsStartPosition).
 func startNATSSubscriber() {
-	sc, err := stan.Connect("test-cluster", "order-service", stan.NatsURL("nats://localhost:4223"))
+	sc, err := stan.Connect("test-cluster", natsClientID(), stan.NatsURL("nats://localhost:4223"))
 	if err != nil {
-		log.Fatal(" NATS Streaming connect error:", err)
+		log.Fatalf(" NATS Streaming connect error (client id %s; у каждого экземпляра должен быть свой INSTANCE_ID): %v",
+			natsClientID(), err)
 	}
 	defer sc.Close()
 
-	_, err = sc.Subscribe("orders", func(msg *stan.Msg) {
-		var order Order
-		if err := json.Unmarshal(msg.Data, &order); err != nil {
-			log.Printf(" Невалидный JSON: %v", err)
-			return
-		}
-
-		if order.OrderUID == "" {
-                        log.Println(" Отклонено: отсутствует order_uid")
-                        return
-                }
-                if len(order.OrderUID) > 100 {
-                        log.Println(" Отклонено: order_uid слишком длинный")
-                        return
-                }
-                if order.Delivery.Name == "" {
-                        log.Println(" Отклонено: отсутствует имя получателя")
-                        return
-                }
-                if len(order.Items) == 0 {
-                        log.Println(" Отклонено: заказ без товаров")
-                        return
-                }
-                if order.Payment.Amount <= 0 {
-                        log.Println(" Отклонено: некорректная сумма оплаты")
-                        return
-                }
-		if err := saveOrderToDB(order); err != nil {
-			log.Printf(" Ошибка сохранения в БД: %v", err)
-			return
+	start, err := natsStartPosition()
+	if err != nil {
+		log.Fatal(" Не удалось прочитать позицию в канале NATS:", err)
+	}
+	_, err = sc.QueueSubscribe(natsChannel, natsQueueGroup, func(msg *stan.Msg) {
+		if order, _, err := ingestOrder(msg.Data); err != nil {
+			saveDeadLetter("nats", msg.Data, order.OrderUID, err)
 		}
-
-		cacheMutex.Lock()
-		orderCache[order.OrderUID] = order
-		cacheMutex.Unlock()
-
-		log.Printf(" Заказ %s сохранён и закэширован", order.OrderUID)
-	}, stan.DurableName("order-durable"))
+		saveNATSPosition(msg.Sequence)
+	}, stan.DurableName(natsDurableName), start)
 
 	if err != nil {
 		log.Fatal(" Ошибка подписки на NATS:", err)
 	}
 
-	select {}
+	startOutboxRelay(sc)
 }
 
 // === HTTP-обработчики ===
 func getOrderHandler(w http.ResponseWriter, r *http.Request) {
 	uid := chi.URLParam(r, "order_uid")
 
-	cacheMutex.RLock()
-	order, exists := orderCache[uid]
-	cacheMutex.RUnlock()
-
+	order, exists := cacheGet(uid)
 	if !exists {
-		http.Error(w, "Order not found", http.StatusNotFound)
-		return
+		// Старые заказы — в архиве (retention.go)
+		var err error
+		order, err = findArchivedOrder(uid)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Ошибка чтения архива: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Order-Source", "archive")
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(order)
+	json.NewEncoder(w).Encode(orderFor(order, requestRole(r)))
+}
+// Удаление заказа (только для админа): из БД каскадом и из кэша
+func deleteOrderHandler(w http.ResponseWriter, r *http.Request) {
+	uid := chi.URLParam(r, "order_uid")
+	var version int64
+	var err error
+	for _, s := range router.shards {
+		if version, err = deleteOrderFrom(s, uid); !errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	kickOutbox()
+	cacheDelete(uid, version)
+	log.Printf(" Заказ %s удалён администратором", uid)
+	w.WriteHeader(http.StatusNoContent)
 }
-func clearAllHandler(w http.ResponseWriter, r *http.Request) {
-  // Очистка БД
-  _, err := db.Exec(`
-    DELETE FROM items;
-    DELETE FROM payments;
-    DELETE FROM deliveries;
-    DELETE FROM orders;
-  `)
-  if err != nil {
-    http.Error(w, "Ошибка очистки БД: "+err.Error(), http.StatusInternalServerError)
-    return
-  }
-
-  // Очистка кэша
-  cacheMutex.Lock()
-  orderCache = make(map[string]Order) 
-  cacheMutex.Unlock()
 
-  w.WriteHeader(http.StatusOK)
-  w.Write([]byte(" Все данные удалены из БД и кэша.\n"))
+// deleteOrderFrom удаляет заказ из шарда и возвращает версию удаления;
+// sql.ErrNoRows — в этом шарде заказа нет.
+func deleteOrderFrom(s *shard, uid string) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	ref := orderRef{OrderUID: uid}
+	err = tx.QueryRow(`
+		SELECT COALESCE(entry, ''), COALESCE(delivery_service, '')
+		FROM orders WHERE order_uid = $1 FOR UPDATE`, uid).
+		Scan(&ref.Entry, &ref.DeliveryService)
+	if err != nil {
+		return 0, err
+	}
+	version, err := nextVersion()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM orders WHERE order_uid = $1", uid); err != nil {
+		return 0, err
+	}
+	if err := writeOutboxTx(tx, eventOrderDeleted, ref, nil); err != nil {
+		return 0, err
+	}
+	if err := notifyOrderTx(tx, uid, version, true); err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
 }
+// === Безопасность страниц ===
+// securityHeaders выставляет строгий Content-Security-Policy: скрипты и стили
+// подключаются только файлами с нашего же origin, inline-код запрещён.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy",
+			"default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; img-src 'self'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "same-origin")
+		next.ServeHTTP(w, r)
+	})
+}
+
 func getUIHandler(w http.ResponseWriter, r *http.Request) {
-	uid := chi.URLParam(r, "order_uid")
-	html := fmt.Sprintf(`
-<!DOCTYPE html>
-<html lang="ru">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Заказ %s</title>
-    <style>
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
-            background: #f8f9fa;
-            margin: 0;
-            padding: 20px;
-        }
-        .container {
-            max-width: 900px;
-            margin: 0 auto;
-            background: white;
-            border-radius: 12px;
-            box-shadow: 0 4px 12px rgba(0,0,0,0.08);
-            overflow: hidden;
-        }
-        header {
-            background: #4361ee;
-            color: white;
-            padding: 20px 24px;
-        }
-        h1 {
-            margin: 0;
-            font-size: 1.5rem;
-            font-weight: 600;
-        }
-        .content {
-            padding: 24px;
-        }
-        .section {
-            margin-bottom: 24px;
-        }
-        .section h2 {
-            font-size: 1.2rem;
-            color: #333;
-            margin-bottom: 12px;
-            padding-bottom: 6px;
-            border-bottom: 1px solid #eee;
-        }
-        .grid {
-            display: grid;
-            grid-template-columns: repeat(auto-fill, minmax(200px, 1fr));
-            gap: 12px;
-        }
-        .field {
-            display: flex;
-            flex-direction: column;
-        }
-        .field-label {
-            font-size: 0.85rem;
-            color: #666;
-            margin-bottom: 4px;
-        }
-        .field-value {
-            font-weight: 500;
-            color: #222;
-        }
-        .items-list {
-            display: flex;
-            flex-direction: column;
-            gap: 12px;
-        }
-        .item-card {
-            background: #f8f9fa;
-            padding: 12px;
-            border-radius: 8px;
-            border-left: 4px solid #4cc9f0;
-        }
-        pre {
-            background: #2b2b2b;
-            color: #f8f8f2;
-            padding: 16px;
-            border-radius: 8px;
-            overflow-x: auto;
-            font-size: 13px;
-        }
-        .error {
-            color: #e63946;
-            padding: 20px;
-            text-align: center;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <header>
-            <h1>Детали заказа: %s</h1>
-        </header>
-        <div class="content">
-            <div id="order-data">Загрузка...</div>
-        </div>
-    </div>
-
-    <script>
-        fetch('/order/%s')
-            .then(res => {
-                if (!res.ok) throw new Error('Заказ не найден');
-                return res.json();
-            })
-            .then(order => {
-                document.getElementById('order-data').innerHTML = renderOrder(order);
-            })
-            .catch(err => {
-                document.getElementById('order-data').innerHTML = 
-                    '<div class="error"><h3>❌ ' + err.message + '</h3><p>Проверьте правильность ID заказа.</p></div>';
-            });
-
-        function renderOrder(o) {
-            let html = '';
-
-            // Общая информация
-            html += '<div class="section"><h2>Общее</h2><div class="grid">';
-            html += field('ID заказа', o.order_uid);
-            html += field('Трек-номер', o.track_number);
-            html += field('Точка входа', o.entry);
-            html += field('Язык', o.locale);
-            html += field('ID клиента', o.customer_id);
-            html += field('Служба доставки', o.delivery_service);
-            html += field('Создан', new Date(o.date_created).toLocaleString('ru-RU'));
-            html += '</div></div>';
-
-            // Доставка
-            html += '<div class="section"><h2>Доставка</h2><div class="grid">';
-            html += field('Имя', o.delivery.name);
-            html += field('Телефон', o.delivery.phone);
-            html += field('Email', o.delivery.email); // ← остаётся на английском
-            html += field('Адрес', o.delivery.address + ', ' + o.delivery.city + ', ' + o.delivery.region + ', ' + o.delivery.zip);
-            html += '</div></div>';
-
-            // Оплата
-            html += '<div class="section"><h2>Оплата</h2><div class="grid">';
-            html += field('Сумма', o.payment.amount + ' ' + o.payment.currency);
-            html += field('Провайдер', o.payment.provider);
-            html += field('Банк', o.payment.bank);
-            html += field('Стоимость доставки', o.payment.delivery_cost);
-            html += field('Стоимость товаров', o.payment.goods_total);
-            html += field('Оплачено', new Date(o.payment.payment_dt * 1000).toLocaleString('ru-RU'));
-            html += '</div></div>';
-
-            // Товары
-            html += '<div class="section"><h2>Товары (' + o.items.length + ')</h2><div class="items-list">';
-            o.items.forEach(item => {
-                html += '<div class="item-card">';
-                html += '<strong>' + item.name + '</strong> (' + item.brand + ')<br>';
-                html += 'Цена: ' + item.price + ' → Итого: ' + item.total_price + ' (' + item.sale + '%% скидка)<br>';
-                html += 'Размер: ' + item.size + ' | Статус: ' + item.status;
-                html += '</div>';
-            });
-            html += '</div></div>';
-
-            // Сырой JSON
-            html += '<details><summary>🔍 Показать исходный JSON</summary><pre>' + JSON.stringify(o, null, 2) + '</pre></details>';
-
-            return html;
-        }
-
-        function field(label, value) {
-            return '<div class="field"><div class="field-label">' + label + '</div><div class="field-value">' + (value || '—') + '</div></div>';
-        }
-    </script>
-</body>
-</html>`, uid, uid, uid)
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(html))
+	ui.render(w, "order", struct {
+		UID string
+	}{chi.URLParam(r, "order_uid")})
 }
 func homeHandler(w http.ResponseWriter, r *http.Request) {
-	// Получаем все ID из кэша
-	cacheMutex.RLock()
-	uids := make([]string, 0, len(orderCache))
-	for uid := range orderCache {
-		uids = append(uids, uid)
-	}
-	cacheMutex.RUnlock()
-
-	// Если кэш пуст — попробуем загрузить из БД (на случай, если сервис только запустился)
-	if len(uids) == 0 {
-		rows, err := db.Query("SELECT order_uid FROM orders ORDER BY date_created DESC")
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var uid string
-				rows.Scan(&uid)
-				uids = append(uids, uid)
-			}
-		}
+	// Страница строится тем же запросом, что и GET /orders
+	page := orderListPage{Query: r.URL.Query()}
+	f, err := parseOrderFilter(page.Query, requestRole(r))
+	if err != nil {
+		page.Error = err.Error()
+		f, _ = parseOrderFilter(nil, requestRole(r))
 	}
+	page.Filter = f
+	page.CanExport = requestRole(r).isStaff()
 
-	// Формируем HTML
-	html := `<!DOCTYPE html>
-<html lang="ru">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Все заказы</title>
-    <style>
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
-            background: #f8f9fa;
-            margin: 0;
-            padding: 20px;
-        }
-        .container {
-            max-width: 800px;
-            margin: 0 auto;
-            background: white;
-            border-radius: 12px;
-            box-shadow: 0 4px 12px rgba(0,0,0,0.08);
-            overflow: hidden;
-        }
-        header {
-            background: #4361ee;
-            color: white;
-            padding: 20px;
-            text-align: center;
-        }
-        h1 {
-            margin: 0;
-            font-size: 1.6rem;
-        }
-        .content {
-            padding: 20px;
-        }
-        .manual-search {
-            margin-bottom: 24px;
-            padding: 16px;
-            background: #f1f3f5;
-            border-radius: 8px;
-        }
-        .manual-search input {
-            width: 100%;
-            padding: 10px;
-            font-size: 16px;
-            border: 1px solid #ccc;
-            border-radius: 6px;
-            box-sizing: border-box;
-        }
-        .manual-search button {
-            margin-top: 8px;
-            width: 100%;
-            padding: 10px;
-            background: #4cc9f0;
-            color: white;
-            border: none;
-            border-radius: 6px;
-            cursor: pointer;
-            font-size: 16px;
-        }
-        .orders-list {
-            display: flex;
-            flex-direction: column;
-            gap: 12px;
-        }
-        .order-item {
-            padding: 12px;
-            background: #f8f9fa;
-            border-radius: 8px;
-            border-left: 4px solid #4361ee;
-        }
-        .order-item a {
-            text-decoration: none;
-            color: #4361ee;
-            font-weight: 600;
-            font-family: monospace;
-        }
-        .order-item a:hover {
-            text-decoration: underline;
-        }
-        .empty {
-            text-align: center;
-            color: #666;
-            padding: 40px 0;
-        }
-        .refresh {
-            text-align: center;
-            margin-top: 20px;
-        }
-        .refresh button {
-            background: #7209b7;
-            color: white;
-            border: none;
-            padding: 8px 16px;
-            border-radius: 6px;
-            cursor: pointer;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <header>
-            <h1>📦 Все заказы</h1>
-        </header>
-        <div class="content">
-            <div class="manual-search">
-                <input type="text" id="manualId" placeholder="Или введите ID заказа вручную...">
-                <button onclick="goToOrder()">Перейти</button>
-            </div>
-
-            <h2>Список заказов (всего: ` + fmt.Sprintf("%d", len(uids)) + `)</h2>
-`
-
-	if len(uids) == 0 {
-		html += `<div class="empty">Нет заказов. Отправьте данные через NATS.</div>`
-	} else {
-		html += `<div class="orders-list">`
-		for _, uid := range uids {
-			html += fmt.Sprintf(`<div class="order-item"><a href="/ui/%s">%s</a></div>`, uid, uid)
-		}
-		html += `</div>`
-	}
-
-	html += `
-            <div class="refresh">
-                <button onclick="location.reload()">🔄 Обновить список</button>
-            </div>
-        </div>
-    </div>
-
-    <script>
-        function goToOrder() {
-            const id = document.getElementById('manualId').value.trim();
-            if (id) {
-                window.location.href = '/ui/' + encodeURIComponent(id);
-            }
-        }
-        document.getElementById('manualId').addEventListener('keypress', function(e) {
-            if (e.key === 'Enter') goToOrder();
-        });
-    </script>
-</body>
-</html>`
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(html))
+	page.orderList, err = listOrdersFromDB(f)
+	if err != nil {
+		log.Printf(" Ошибка чтения списка заказов: %v", err)
+		page.Error = "Не удалось загрузить список заказов"
+	}
+
+	ui.render(w, "home", page)
 }
 // === MAIN ===
 func main() {
@@ -662,72 +585,129 @@ func main() {
   log.Println(" Инициализация базы данных...")
   initDB()
 
-  _, err := db.Exec(`
-    CREATE TABLE IF NOT EXISTS orders (
-      order_uid TEXT PRIMARY KEY,
-      track_number TEXT,
-      entry TEXT,
-      locale TEXT,
-      internal_signature TEXT,
-      customer_id TEXT,
-      delivery_service TEXT,
-      shardkey TEXT,
-      sm_id INTEGER,
-      date_created TIMESTAMPTZ,
-      oof_shard TEXT
-    );
-    CREATE TABLE IF NOT EXISTS deliveries (
-      order_uid TEXT REFERENCES orders(order_uid) ON DELETE CASCADE,
-      name TEXT,
-      phone TEXT,
-      zip TEXT,
-      city TEXT,
-      address TEXT,
-      region TEXT,
-      email TEXT
-    );
-    CREATE TABLE IF NOT EXISTS payments (
-      order_uid TEXT REFERENCES orders(order_uid) ON DELETE CASCADE,
-      transaction TEXT,
-      request_id TEXT,
-      currency TEXT,
-      provider TEXT,
-      amount INTEGER,
-      payment_dt BIGINT,
-      bank TEXT,
-      delivery_cost INTEGER,
-      goods_total INTEGER,
-      custom_fee INTEGER
-    );
-    CREATE TABLE IF NOT EXISTS items (
-      order_uid TEXT REFERENCES orders(order_uid) ON DELETE CASCADE,
-      chrt_id BIGINT,
-      track_number TEXT,
-      price INTEGER,
-      rid TEXT,
-      name TEXT,
-      sale INTEGER,
-      size TEXT,
-      total_price INTEGER,
-      nm_id BIGINT,
-      brand TEXT,
-      status INTEGER
-    );
-  `)
-  if err != nil {
+  var err error
+  if err := migrateSchema(db); err != nil {
     log.Fatal(" Ошибка создания таблиц:", err)
   }
+  if err := migrateMoneyColumns(); err != nil {
+    log.Fatal(" Ошибка миграции сумм:", err)
+  }
+
+  // SHARD_MAP — файл карты шардов; без него все заказы в основной БД (shards.go)
+  router = singleShard()
+  if path := os.Getenv("SHARD_MAP"); path != "" {
+    if router, err = loadShardMap(path); err != nil {
+      log.Fatal(" Ошибка загрузки карты шардов:", err)
+    }
+    log.Printf(" Шардирование включено: %s", strings.Join(router.names(), ", "))
+  }
+
+  // PII_KEYFILE — файл ключей шифрования контактов получателя (encryption.go)
+  if path := os.Getenv("PII_KEYFILE"); path != "" {
+    if keyring, err = loadKeyring(path); err != nil {
+      log.Fatal(" Ошибка загрузки ключей шифрования:", err)
+    }
+    log.Printf(" Шифрование контактов включено, активный ключ v%d", keyring.active)
+  } else {
+    log.Println(" PII_KEYFILE не задан: контакты получателя пишутся в БД открытым текстом")
+  }
 
+  // Подписка на изменения кэша — до загрузки, чтобы не пропустить
+  // изменения, сделанные другими экземплярами за время чтения (coherence.go)
+  cacheListeners := listenCacheNotices()
   loadCacheFromDB()
+  for _, l := range cacheListeners {
+    go runCacheListener(l)
+  }
+
+  if spec := os.Getenv("PII_MASK"); spec != "" {
+    if piiRules, err = parsePIIRules(spec); err != nil {
+      log.Fatal(" Некорректный PII_MASK:", err)
+    }
+  }
+
+  // RETENTION_DAYS=365 — переносить в архив заказы старше года (retention.go)
+  if err := parseRetention(os.Getenv("RETENTION_DAYS"), os.Getenv("RETENTION_INTERVAL")); err != nil {
+    log.Fatal(" Некорректные настройки хранения:", err)
+  }
+  if retentionDays > 0 {
+    log.Printf(" Архивация включена: заказы старше %d дней, проверка каждые %s", retentionDays, retentionInterval)
+    go startRetention()
+  }
+
+  // UI_DEV_DIR=web — читать шаблоны и статику с диска, без перезапуска
+  ui, err = newWebUI(os.Getenv("UI_DEV_DIR"))
+  if err != nil {
+    log.Fatal(" Ошибка загрузки шаблонов:", err)
+  }
+
+  go startWebhookWorker()
 
-  log.Println(" Подключение к NATS Streaming...")
+  // NATS_QUEUE_GROUP и INSTANCE_ID — группа подписчиков и имя экземпляра (instance.go)
+  if err := parseInstance(os.Getenv("NATS_QUEUE_GROUP"), os.Getenv("INSTANCE_ID")); err != nil {
+    log.Fatal(" Некорректные настройки экземпляра:", err)
+  }
+  log.Printf(" Подключение к NATS Streaming: экземпляр %s, группа %s...", instanceID, natsQueueGroup)
   go startNATSSubscriber()
 
-  r := chi.NewRouter()
-  r.Get("/", homeHandler)
-  r.Get("/order/{order_uid}", getOrderHandler)
-  r.Get("/ui/{order_uid}", getUIHandler)
+  grpcAddr := os.Getenv("GRPC_ADDR")
+  if grpcAddr == "" {
+    grpcAddr = ":9090"
+  }
+  go startGRPCServer(grpcAddr)
+
+  r := newRouter()
+  checkOpenAPIRoutes(r)
+
+  httpAddr := os.Getenv("HTTP_ADDR")
+  if httpAddr == "" {
+    httpAddr = ":8080"
+  }
+  log.Printf(" HTTP-сервер запущен на %s", httpAddr)
+  log.Fatal(http.ListenAndServe(httpAddr, r))
+}
 
-  log.Println(" HTTP-сервер запущен на http://localhost:8080")
-  log.Fatal(http.ListenAndServe(":8080", r))
+// newRouter собирает маршруты HTTP API и страниц; main и тесты обработчиков
+// используют один и тот же роутер.
+func newRouter() *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(securityHeaders)
+	r.Get("/", homeHandler)
+	r.Get("/orders", listOrdersHandler)
+	r.Post("/orders", requireAdmin(postOrderHandler))
+	r.Get("/export", requireStaff(exportHandler))
+	r.Get("/events", eventsHandler)
+	r.Get("/order/{order_uid}", getOrderHandler)
+	r.Delete("/order/{order_uid}", requireAdmin(deleteOrderHandler))
+	r.Get("/admin/cache", requireAdmin(cacheStatsHandler))
+	r.Post("/admin/cache/reload", requireAdmin(cacheReloadHandler))
+	r.Post("/admin/import", requireAdmin(importOrdersHandler))
+	r.Post("/admin/rates", requireAdmin(loadRatesHandler))
+	r.Get("/admin/keys", requireAdmin(keyStatusHandler))
+	r.Post("/admin/keys/rotate", requireAdmin(rotateKeysHandler))
+	r.Post("/admin/customers/{customer_id}/erase", requireAdmin(eraseCustomerHandler))
+	r.Get("/admin/audit", requireAdmin(listAuditHandler))
+	r.Get("/admin/outbox", requireAdmin(outboxStatsHandler))
+	r.Post("/admin/webhooks", requireAdmin(createWebhookHandler))
+	r.Get("/admin/webhooks", requireAdmin(listWebhooksHandler))
+	r.Delete("/admin/webhooks/{id}", requireAdmin(deleteWebhookHandler))
+	r.Post("/admin/webhooks/{id}/enable", requireAdmin(enableWebhookHandler))
+	r.Post("/admin/webhooks/{id}/test", requireAdmin(testWebhookHandler))
+	r.Get("/admin/webhooks/{id}/deliveries", requireAdmin(webhookDeliveriesHandler))
+	r.Get("/admin/shards", requireAdmin(shardStatusHandler))
+	r.Post("/admin/shards/rebalance", requireAdmin(rebalanceShardsHandler))
+	r.Post("/admin/archive/run", requireAdmin(runArchiveHandler))
+	r.Get("/admin/archive/{month}", requireAdmin(archiveMonthHandler))
+	r.Get("/admin/dlq", requireAdmin(listDeadLettersHandler))
+	r.Post("/admin/dlq/{id}/resubmit", requireAdmin(resubmitDeadLetterHandler))
+	r.Get("/rates", ratesHandler)
+	r.Get("/stats/summary", statsHandler)
+	r.Get("/stats/live", liveStatsHandler)
+	r.Get("/stats/{group}", statsHandler)
+	r.Get("/openapi.json", openAPIHandler)
+	r.Get("/docs", docsHandler)
+	r.Get("/ui/dashboard", dashboardHandler)
+	r.Get("/ui/{order_uid}", getUIHandler)
+	r.Handle("/static/*", ui.staticHandler())
+	return r
 }
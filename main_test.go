@@ -0,0 +1,186 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// === Общее для тестов обработчиков ===
+// Тесты идут через настоящий роутер (newRouter) и обработчики сервиса.
+// Тестам, которым нужна PostgreSQL, её адрес даёт TEST_DATABASE_URL —
+// таблицы этой БД очищаются перед каждым тестом; без переменной такие
+// тесты пропускаются, а db указывает на закрытый порт, так что ответы об
+// ошибке БД проверяются и без неё.
+
+const (
+	testAdminToken   = "test-admin"
+	testManagerToken = "test-manager"
+	testSupportToken = "test-support"
+
+	// unreachableDSN — БД, к которой нельзя подключиться.
+	unreachableDSN = "host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1"
+)
+
+var (
+	testDBReady bool
+	testDSN     string // адрес тестовой БД, если она есть
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		dsn = unreachableDSN
+	}
+	var err error
+	if db, err = sql.Open("postgres", dsn); err != nil {
+		log.Fatal(err)
+	}
+	if dsn != unreachableDSN {
+		if err := db.Ping(); err != nil {
+			log.Fatal("TEST_DATABASE_URL: ", err)
+		}
+		if err := migrateSchema(db); err != nil {
+			log.Fatal("схема тестовой БД: ", err)
+		}
+		testDBReady, testDSN = true, dsn
+	}
+	router = singleShard()
+
+	roleTokens = []struct {
+		role  role
+		token string
+	}{
+		{roleAdmin, testAdminToken},
+		{roleManager, testManagerToken},
+		{roleSupport, testSupportToken},
+	}
+	if ui, err = newWebUI(""); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
+// needDB пропускает тест без TEST_DATABASE_URL, иначе очищает таблицы и
+// кэш.
+func needDB(t *testing.T) {
+	t.Helper()
+	if !testDBReady {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+	_, err := db.Exec(`TRUNCATE orders, deliveries, payments, items, archived_orders, outbox,
+		webhooks, webhook_deliveries, dead_letters, audit_log, exchange_rates, nats_positions CASCADE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetCache(t)
+}
+
+// resetCache очищает кэш заказов, в том числе версии и записи об удалении.
+func resetCache(t *testing.T) {
+	cacheMutex.Lock()
+	orderCache = make(map[string]Order)
+	cacheVersions = make(map[string]int64)
+	cacheTombstones = make(map[string]tombstone)
+	cacheMutex.Unlock()
+	t.Cleanup(func() {
+		cacheMutex.Lock()
+		orderCache = make(map[string]Order)
+		cacheVersions = make(map[string]int64)
+		cacheTombstones = make(map[string]tombstone)
+		cacheMutex.Unlock()
+	})
+}
+
+// brokenDB на время теста подменяет БД недоступной.
+func brokenDB(t *testing.T) {
+	t.Helper()
+	broken, err := sql.Open("postgres", unreachableDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevRouter := db, router
+	db = broken
+	router = singleShard()
+	t.Cleanup(func() {
+		db, router = prevDB, prevRouter
+		broken.Close()
+	})
+}
+
+// loadFixture читает заказ из fixtures/<name>.json.
+func loadFixture(t *testing.T, name string) Order {
+	t.Helper()
+	data, err := os.ReadFile("fixtures/" + name + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		t.Fatalf("fixtures/%s.json: %v", name, err)
+	}
+	return order
+}
+
+// saveFixtures сохраняет заказы в БД и кэш так же, как приём из NATS.
+func saveFixtures(t *testing.T, names ...string) []Order {
+	t.Helper()
+	orders := make([]Order, len(names))
+	for i, name := range names {
+		orders[i] = loadFixture(t, name)
+		version, err := saveOrderToDB(orders[i])
+		if err != nil {
+			t.Fatalf("сохранение %s: %v", name, err)
+		}
+		cachePut(orders[i], version)
+	}
+	return orders
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(newRouter())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// doRequest выполняет запрос к тестовому серверу; token — Bearer-токен
+// роли или "".
+func doRequest(t *testing.T, srv *httptest.Server, method, path, token string, body io.Reader) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func readBody(t *testing.T, resp *http.Response) []byte {
+	t.Helper()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// mediaType — Content-Type без параметров.
+func mediaType(resp *http.Response) string {
+	ct, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	return strings.TrimSpace(ct)
+}
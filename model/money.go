@@ -0,0 +1,284 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Currency — валюта ISO 4217 и число знаков в её дробной части
+// (минимальные единицы: копейки, центы; у иены их нет).
+type Currency struct {
+	Code   string
+	Digits int
+	Symbol string // знак для вывода, пусто — печатается код
+}
+
+// currencies — действующие коды ISO 4217. Всё, чего здесь нет, Validate
+// отклоняет.
+var currencies = func() map[string]Currency {
+	m := make(map[string]Currency)
+	add := func(digits int, codes string) {
+		for _, code := range strings.Fields(codes) {
+			m[code] = Currency{Code: code, Digits: digits}
+		}
+	}
+	add(0, "BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX UYI VND VUV XAF XOF XPF")
+	add(2, "AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BRL BSD BTN BWP BYN BZD "+
+		"CAD CDF CHF CNY COP CRC CUP CVE CZK DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ "+
+		"GYD HKD HNL HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL MAD MDL MGA "+
+		"MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR "+
+		"RON RSD RUB SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY TTD "+
+		"TWD TZS UAH USD UYU UZS VES WST XCD YER ZAR ZMW ZWG")
+	add(3, "BHD IQD JOD KWD LYD OMR TND")
+	add(4, "CLF UYW")
+
+	for code, sym := range map[string]string{
+		"RUB": "₽", "USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "CNY": "¥",
+		"KZT": "₸", "BYN": "Br", "UAH": "₴", "TRY": "₺", "INR": "₹", "KRW": "₩", "AMD": "֏", "GEL": "₾",
+	} {
+		c := m[code]
+		c.Symbol = sym
+		m[code] = c
+	}
+	return m
+}()
+
+// LookupCurrency находит валюту по коду ISO 4217.
+func LookupCurrency(code string) (Currency, bool) {
+	c, ok := currencies[code]
+	return c, ok
+}
+
+// Currencies возвращает все известные валюты, по коду.
+func Currencies() []Currency {
+	list := make([]Currency, 0, len(currencies))
+	for _, c := range currencies {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// Money — сумма в минимальных единицах валюты: 1817,50 ₽ — это
+// Money{Minor: 181750, Currency: "RUB"}.
+//
+// В JSON сумма — число в единицах валюты (1817.5), а сама валюта задаётся
+// один раз, в payment.currency. Поэтому сразу после разбора JSON у суммы
+// ещё нет валюты; заказ проставляет её всем своим суммам (см.
+// Order.UnmarshalJSON).
+type Money struct {
+	Minor    int64
+	Currency string
+
+	scale int // знаков дробной части в Minor, пока Currency не задана
+}
+
+// FromMinor — сумма в минимальных единицах валюты.
+func FromMinor(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// ParseMoney разбирает десятичную запись «1817.50» в валюте currency.
+func ParseMoney(s, currency string) (Money, error) {
+	m, err := parseDecimal(s)
+	if err != nil {
+		return Money{}, err
+	}
+	return m, m.SetCurrency(currency)
+}
+
+func parseDecimal(s string) (Money, error) {
+	digits := strings.TrimPrefix(s, "-")
+	intPart, frac, _ := strings.Cut(digits, ".")
+	if intPart == "" || strings.Trim(intPart+frac, "0123456789") != "" {
+		return Money{}, fmt.Errorf("сумма %q: ожидается десятичное число", s)
+	}
+	n, err := strconv.ParseInt(intPart+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("сумма %q: %w", s, err)
+	}
+	if digits != s {
+		n = -n
+	}
+	return Money{Minor: n, scale: len(frac)}, nil
+}
+
+// SetCurrency привязывает сумму, разобранную без валюты, к валюте и
+// переводит её в минимальные единицы. Ошибка — если валюта неизвестна или
+// знаков после запятой больше, чем у валюты (10.005 RUB).
+func (m *Money) SetCurrency(code string) error {
+	if m.Currency == code {
+		return nil
+	}
+	if m.Currency != "" {
+		return fmt.Errorf("сумма в %s, а нужна в %s", m.Currency, code)
+	}
+	c, ok := LookupCurrency(code)
+	if !ok {
+		return fmt.Errorf("неизвестная валюта %q (нужен код ISO 4217)", code)
+	}
+
+	minor := m.Minor
+	scale := m.scale
+	for ; scale > c.Digits; scale-- {
+		if minor%10 != 0 {
+			return fmt.Errorf("сумма %s: у %s не больше %d знаков после запятой", m.Decimal(), code, c.Digits)
+		}
+		minor /= 10
+	}
+	for ; scale < c.Digits; scale++ {
+		if minor > math.MaxInt64/10 || minor < math.MinInt64/10 {
+			return errors.New("сумма слишком велика")
+		}
+		minor *= 10
+	}
+	*m = Money{Minor: minor, Currency: code}
+	return nil
+}
+
+func (m Money) digits() int {
+	if m.Currency == "" {
+		return m.scale
+	}
+	c, _ := LookupCurrency(m.Currency)
+	return c.Digits
+}
+
+// Decimal — сумма в единицах валюты: «1817.50».
+func (m Money) Decimal() string {
+	s := strconv.FormatInt(m.Minor, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if d := m.digits(); d > 0 {
+		if len(s) <= d {
+			s = strings.Repeat("0", d-len(s)+1) + s
+		}
+		s = s[:len(s)-d] + "." + s[len(s)-d:]
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// Float — сумма в единицах валюты для усреднений и графиков.
+func (m Money) Float() float64 {
+	return float64(m.Minor) / math.Pow10(m.digits())
+}
+
+// Convert пересчитывает сумму в валюту currency по курсу rate (сколько
+// единиц currency стоит единица валюты суммы) и округляет до минимальной
+// единицы, половину — от нуля.
+func (m Money) Convert(rate *big.Rat, currency string) (Money, error) {
+	c, ok := LookupCurrency(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("неизвестная валюта %q (нужен код ISO 4217)", currency)
+	}
+	ten := big.NewInt(10)
+	v := new(big.Rat).SetFrac(big.NewInt(m.Minor), new(big.Int).Exp(ten, big.NewInt(int64(m.digits())), nil))
+	v.Mul(v, rate)
+	v.Mul(v, new(big.Rat).SetInt(new(big.Int).Exp(ten, big.NewInt(int64(c.Digits)), nil)))
+
+	q, r := new(big.Int).QuoRem(v.Num(), v.Denom(), new(big.Int))
+	if r.Abs(r).Lsh(r, 1).Cmp(v.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(v.Sign())))
+	}
+	if !q.IsInt64() {
+		return Money{}, errors.New("сумма слишком велика")
+	}
+	return Money{Minor: q.Int64(), Currency: currency}, nil
+}
+
+// String — «1817.50 RUB».
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.Currency
+}
+
+// Format выводит сумму по правилам локали: ru — «1 817,50 ₽» (с неразрывными
+// пробелами), остальные — как en: «₽1,817.50».
+func (m Money) Format(locale string) string {
+	intPart, frac, _ := strings.Cut(strings.TrimPrefix(m.Decimal(), "-"), ".")
+	sep, point := ",", "."
+	if strings.HasPrefix(locale, "ru") {
+		sep, point = "\u00a0", ","
+	}
+	var b strings.Builder
+	if m.Minor < 0 {
+		b.WriteString("-")
+	}
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteString(point + frac)
+	}
+	num := b.String()
+
+	c, _ := LookupCurrency(m.Currency)
+	switch {
+	case strings.HasPrefix(locale, "ru") && c.Symbol != "":
+		return num + "\u00a0" + c.Symbol
+	case c.Symbol != "":
+		return c.Symbol + num
+	case m.Currency != "":
+		return num + " " + m.Currency
+	}
+	return num
+}
+
+// MarshalJSON пишет сумму числом в единицах валюты с точностью валюты.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON читает число в единицах валюты. Валюту проставляет заказ.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("сумма %s: нужна запись без экспоненты", s)
+	}
+	v, err := parseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Amounts возвращает указатели на все суммы заказа: оплату и цены товаров.
+func (o *Order) Amounts() []*Money {
+	fields := []*Money{&o.Payment.Amount, &o.Payment.DeliveryCost, &o.Payment.GoodsTotal, &o.Payment.CustomFee}
+	for i := range o.Items {
+		fields = append(fields, &o.Items[i].Price, &o.Items[i].TotalPrice)
+	}
+	return fields
+}
+
+// UnmarshalJSON разбирает заказ и переводит суммы в валюту оплаты. Если
+// валюта неизвестна или сумма точнее валюты, суммы остаются без валюты —
+// такой заказ отклонит Validate с понятной причиной.
+func (o *Order) UnmarshalJSON(data []byte) error {
+	type plain Order
+	if err := json.Unmarshal(data, (*plain)(o)); err != nil {
+		return err
+	}
+	for _, m := range o.Amounts() {
+		m.SetCurrency(o.Payment.Currency)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in, currency string
+		minor        int64
+	}{
+		{"1817.50", "RUB", 181750},
+		{"1817.5", "RUB", 181750},
+		{"1817", "RUB", 181700},
+		{"-0.01", "RUB", -1},
+		{"1500", "JPY", 1500},
+		{"1500.000", "JPY", 1500},
+		{"1.234", "KWD", 1234},
+		{"1.2", "KWD", 1200},
+		{"0.0001", "CLF", 1},
+	}
+	for _, c := range cases {
+		m, err := ParseMoney(c.in, c.currency)
+		if err != nil {
+			t.Errorf("%s %s: %v", c.in, c.currency, err)
+			continue
+		}
+		if m != FromMinor(c.minor, c.currency) {
+			t.Errorf("%s %s: %+v, ожидалось %d", c.in, c.currency, m, c.minor)
+		}
+	}
+
+	bad := [][2]string{
+		{"10.005", "RUB"}, // точнее валюты
+		{"1500.5", "JPY"},
+		{"1.2345", "KWD"},
+		{"10", "XDR"}, // не ISO 4217
+		{"abc", "RUB"},
+		{"1.2.3", "RUB"},
+		{".5", "RUB"},
+		{"", "RUB"},
+		{"92233720368547758.08", "RUB"},
+	}
+	for _, c := range bad {
+		if m, err := ParseMoney(c[0], c[1]); err == nil {
+			t.Errorf("%s %s: разобрано как %+v", c[0], c[1], m)
+		}
+	}
+}
+
+func TestOrderAmountsInMinorUnits(t *testing.T) {
+	data := `{"payment": {"currency": "%s", "amount": %s, "delivery_cost": 0, "goods_total": %[2]s, "custom_fee": 0},
+		"items": [{"price": %[2]s, "total_price": %[2]s}]}`
+	cases := []struct {
+		currency, amount string
+		minor            int64
+	}{
+		{"RUB", "1817.5", 181750},
+		{"JPY", "1817", 1817},
+		{"KWD", "1.817", 1817},
+	}
+	for _, c := range cases {
+		var o Order
+		if err := json.Unmarshal([]byte(fmt.Sprintf(data, c.currency, c.amount)), &o); err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range o.Amounts() {
+			if m.Currency != c.currency {
+				t.Errorf("%s: сумма без валюты: %+v", c.currency, *m)
+			}
+		}
+		if o.Payment.Amount.Minor != c.minor || o.Items[0].TotalPrice.Minor != c.minor {
+			t.Errorf("%s %s: оплата %d, товар %d, ожидалось %d",
+				c.currency, c.amount, o.Payment.Amount.Minor, o.Items[0].TotalPrice.Minor, c.minor)
+		}
+		out, err := json.Marshal(o.Payment.Amount)
+		if err != nil || string(out) != c.amount && string(out) != c.amount+"0" {
+			t.Errorf("%s: в JSON %s, %v", c.currency, out, err)
+		}
+	}
+
+	// Сумма точнее валюты остаётся без валюты, и заказ отклоняет Validate
+	var o Order
+	if err := json.Unmarshal([]byte(fmt.Sprintf(data, "JPY", "1817.5")), &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Payment.Amount.Currency != "" {
+		t.Errorf("1817.5 JPY принято: %+v", o.Payment.Amount)
+	}
+	if err := json.Unmarshal([]byte(`{"payment": {"currency": "RUB", "amount": 1e3}}`), &o); err == nil {
+		t.Error("сумма с экспонентой разобрана")
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	cases := map[Money]string{
+		FromMinor(181750, "RUB"): "1817.50",
+		FromMinor(5, "RUB"):      "0.05",
+		FromMinor(-5, "RUB"):     "-0.05",
+		FromMinor(1500, "JPY"):   "1500",
+		FromMinor(1234, "KWD"):   "1.234",
+		FromMinor(7, "KWD"):      "0.007",
+	}
+	for m, want := range cases {
+		if got := m.Decimal(); got != want {
+			t.Errorf("%+v: %s, ожидалось %s", m, got, want)
+		}
+	}
+	if got := FromMinor(181750, "RUB").String(); got != "1817.50 RUB" {
+		t.Errorf("String: %s", got)
+	}
+	if got := FromMinor(181750, "RUB").Float(); got != 1817.5 {
+		t.Errorf("Float: %v", got)
+	}
+}
+
+func TestMoneyConvert(t *testing.T) {
+	rate := func(s string) *big.Rat {
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			t.Fatalf("курс %s", s)
+		}
+		return r
+	}
+	cases := []struct {
+		m        Money
+		rate     string
+		currency string
+		want     int64
+	}{
+		{FromMinor(10000, "USD"), "91.1883", "RUB", 911883},  // 100 $ → 9118.83 ₽
+		{FromMinor(1, "USD"), "91.1883", "RUB", 91},          // 0.911883 → 0.91
+		{FromMinor(100, "JPY"), "0.606898", "RUB", 6069},     // 100 ¥ → 60.6898 → 60.69
+		{FromMinor(181750, "RUB"), "0.0109663", "USD", 1993}, // 19.9312... → 19.93
+		{FromMinor(1, "RUB"), "0.5", "RUB", 1},               // 0.005 → 0.01: половина от нуля
+		{FromMinor(-1, "RUB"), "0.5", "RUB", -1},             // -0.005 → -0.01
+		{FromMinor(3, "RUB"), "0.5", "RUB", 2},               // 0.015 → 0.02
+		{FromMinor(10000, "RUB"), "0.0109663", "JPY", 1},     // 1.09663 ¥ → 1
+		{FromMinor(100000, "RUB"), "0.00327", "KWD", 3270},   // 3.27 KWD
+		{FromMinor(1, "KWD"), "298.5", "RUB", 30},            // 0.2985 → 0.30
+		{FromMinor(0, "USD"), "91.1883", "RUB", 0},
+	}
+	for _, c := range cases {
+		got, err := c.m.Convert(rate(c.rate), c.currency)
+		if err != nil {
+			t.Errorf("%s × %s: %v", c.m, c.rate, err)
+			continue
+		}
+		if got != FromMinor(c.want, c.currency) {
+			t.Errorf("%s × %s: %s, ожидалось %s", c.m, c.rate, got, FromMinor(c.want, c.currency))
+		}
+	}
+
+	if _, err := FromMinor(100, "RUB").Convert(rate("1"), "XDR"); err == nil {
+		t.Error("пересчёт в XDR")
+	}
+	if _, err := FromMinor(1<<62, "JPY").Convert(rate("1000"), "RUB"); err == nil {
+		t.Error("переполнение не замечено")
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	cases := []struct {
+		m      Money
+		locale string
+		want   string
+	}{
+		{FromMinor(181750, "RUB"), "ru", "1\u00a0817,50\u00a0₽"},
+		{FromMinor(181750, "RUB"), "en", "₽1,817.50"},
+		{FromMinor(123456789, "USD"), "ru-RU", "1\u00a0234\u00a0567,89\u00a0$"},
+		{FromMinor(123456789, "USD"), "en-US", "$1,234,567.89"},
+		{FromMinor(-181750, "RUB"), "ru", "-1\u00a0817,50\u00a0₽"},
+		{FromMinor(1500, "JPY"), "ru", "1\u00a0500\u00a0¥"},
+		{FromMinor(1234, "KWD"), "ru", "1,234\u00a0KWD"},
+		{FromMinor(1234567, "KWD"), "en", "1,234.567\u00a0KWD"},
+		{FromMinor(99, "RUB"), "ru", "0,99\u00a0₽"},
+	}
+	for _, c := range cases {
+		if got := c.m.Format(c.locale); got != c.want {
+			t.Errorf("%s, %s: %q, ожидалось %q", c.m, c.locale, got, c.want)
+		}
+	}
+}
+
+func TestCurrencyDigits(t *testing.T) {
+	for code, digits := range map[string]int{"RUB": 2, "USD": 2, "JPY": 0, "KRW": 0, "KWD": 3, "BHD": 3, "CLF": 4} {
+		c, ok := LookupCurrency(code)
+		if !ok || c.Digits != digits {
+			t.Errorf("%s: %+v, %v", code, c, ok)
+		}
+	}
+	if _, ok := LookupCurrency("XDR"); ok {
+		t.Error("XDR не валюта ISO 4217 для платежей")
+	}
+}
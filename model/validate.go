@@ -0,0 +1,40 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Validate проверяет заказ перед сохранением. Те же правила применяет
+// сервис к сообщениям из NATS и orderctl перед публикацией.
+func Validate(order Order) error {
+	if order.OrderUID == "" {
+		return errors.New("отсутствует order_uid")
+	}
+	if len(order.OrderUID) > 100 {
+		return errors.New("order_uid слишком длинный")
+	}
+	if order.Delivery.Name == "" {
+		return errors.New("отсутствует имя получателя")
+	}
+	if len(order.Items) == 0 {
+		return errors.New("заказ без товаров")
+	}
+	if _, ok := LookupCurrency(order.Payment.Currency); !ok {
+		return fmt.Errorf("неизвестная валюта %q (нужен код ISO 4217)", order.Payment.Currency)
+	}
+	// Сумма без валюты — не удалось перевести в валюту оплаты при разборе
+	for _, p := range order.Amounts() {
+		m := *p // Items общий с вызывающим, не меняем его
+		if err := m.SetCurrency(order.Payment.Currency); err != nil {
+			return err
+		}
+		if m.Minor < 0 {
+			return fmt.Errorf("отрицательная сумма %s", m)
+		}
+	}
+	if order.Payment.Amount.Minor <= 0 {
+		return errors.New("некорректная сумма оплаты")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"order-service-demo/model"
+)
+
+// === Суммы в БД ===
+// Суммы хранятся в минимальных единицах валюты (BIGINT), валюта — в
+// payments.currency, одна на заказ.
+
+type Money = model.Money
+
+// setOrderCurrency проставляет валюту оплаты суммам, прочитанным из БД:
+// там они уже в минимальных единицах.
+func setOrderCurrency(o *Order) {
+	for _, m := range o.Amounts() {
+		m.Currency = o.Payment.Currency
+	}
+}
+
+// currencyScaleSQL — выражение SQL с множителем минимальных единиц для
+// валюты в колонке col: 100 для RUB, 1 для JPY. Незнакомые валюты считаются
+// двухзнаковыми.
+func currencyScaleSQL(col string) string {
+	byDigits := map[int][]string{}
+	for _, c := range model.Currencies() {
+		if c.Digits != 2 {
+			byDigits[c.Digits] = append(byDigits[c.Digits], "'"+c.Code+"'")
+		}
+	}
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, d := range []int{0, 3, 4} {
+		if codes := byDigits[d]; len(codes) > 0 {
+			fmt.Fprintf(&b, " WHEN %s IN (%s) THEN %d", col, strings.Join(codes, ", "), pow10(d))
+		}
+	}
+	b.WriteString(" ELSE 100 END")
+	return b.String()
+}
+
+func pow10(n int) int64 {
+	v := int64(1)
+	for range n {
+		v *= 10
+	}
+	return v
+}
+
+// migrateMoneyColumns переводит суммы из целых единиц валюты (INTEGER,
+// как было до типа Money) в минимальные единицы (BIGINT). Признак старой
+// схемы — тип payments.amount; таблица блокируется, чтобы два экземпляра
+// сервиса не умножили суммы дважды.
+func migrateMoneyColumns() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("LOCK TABLE payments, items IN ACCESS EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+	var typ string
+	err = tx.QueryRow(`
+		SELECT data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'payments' AND column_name = 'amount'`).Scan(&typ)
+	if err == sql.ErrNoRows || typ == "bigint" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	scale := currencyScaleSQL("currency")
+	stmts := []string{
+		`ALTER TABLE payments ALTER COLUMN amount TYPE BIGINT, ALTER COLUMN delivery_cost TYPE BIGINT,
+			ALTER COLUMN goods_total TYPE BIGINT, ALTER COLUMN custom_fee TYPE BIGINT`,
+		`ALTER TABLE items ALTER COLUMN price TYPE BIGINT, ALTER COLUMN total_price TYPE BIGINT`,
+		`UPDATE items i SET price = i.price * s.k, total_price = i.total_price * s.k
+			FROM (SELECT order_uid, ` + scale + ` AS k FROM payments) s WHERE s.order_uid = i.order_uid`,
+		`UPDATE payments SET amount = amount * ` + scale + `, delivery_cost = delivery_cost * ` + scale + `,
+			goods_total = goods_total * ` + scale + `, custom_fee = custom_fee * ` + scale,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Println(" Суммы в БД переведены в минимальные единицы валюты")
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCurrencyScaleSQL(t *testing.T) {
+	got := currencyScaleSQL("p.currency")
+	for _, want := range []string{"'JPY'", "THEN 1 ", "'KWD'", "THEN 1000 ", "'CLF'", "THEN 10000 ", "ELSE 100 END"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("нет %q в %s", want, got)
+		}
+	}
+	if strings.Contains(got, "'RUB'") || strings.Contains(got, "'USD'") {
+		t.Errorf("двухзнаковые валюты перечислены отдельно: %s", got)
+	}
+}
+
+// TestMigrateMoneyColumns переводит старую схему (суммы INTEGER в целых
+// единицах валюты) в отдельной схеме PostgreSQL.
+func TestMigrateMoneyColumns(t *testing.T) {
+	needDB(t)
+	if _, err := db.Exec(`DROP SCHEMA IF EXISTS money_old CASCADE; CREATE SCHEMA money_old`); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec(`DROP SCHEMA IF EXISTS money_old CASCADE`) })
+
+	dsn := testDSN + " search_path=money_old"
+	if u, err := url.Parse(testDSN); err == nil && u.Scheme != "" {
+		q := u.Query()
+		q.Set("search_path", "money_old")
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	}
+	old, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := db
+	db = old
+	t.Cleanup(func() { db = prev; old.Close() })
+
+	_, err = db.Exec(`
+		CREATE TABLE payments (order_uid TEXT, currency TEXT, amount INTEGER, delivery_cost INTEGER,
+			goods_total INTEGER, custom_fee INTEGER);
+		CREATE TABLE items (order_uid TEXT, price INTEGER, total_price INTEGER);
+		INSERT INTO payments VALUES ('rub', 'RUB', 1817, 1500, 317, 0), ('jpy', 'JPY', 2000, 500, 1500, 0),
+			('kwd', 'KWD', 3, 1, 2, 0), ('xyz', 'XYZ', 5, 0, 5, 0);
+		INSERT INTO items VALUES ('rub', 453, 317), ('jpy', 1500, 1500), ('kwd', 2, 2), ('xyz', 5, 5)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][3]int64{ // amount, delivery_cost, items.total_price
+		"rub": {181700, 150000, 31700},
+		"jpy": {2000, 500, 1500},
+		"kwd": {3000, 1000, 2000},
+		"xyz": {500, 0, 500}, // незнакомая валюта — как двухзнаковая
+	}
+	// Второй запуск (другой экземпляр, перезапуск) суммы не трогает
+	for run := 1; run <= 2; run++ {
+		if err := migrateMoneyColumns(); err != nil {
+			t.Fatalf("запуск %d: %v", run, err)
+		}
+		rows, err := db.Query(`
+			SELECT p.order_uid, p.amount, p.delivery_cost, i.total_price
+			FROM payments p JOIN items i USING (order_uid)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var uid string
+			var got [3]int64
+			if err := rows.Scan(&uid, &got[0], &got[1], &got[2]); err != nil {
+				t.Fatal(err)
+			}
+			if got != want[uid] {
+				t.Errorf("запуск %d, %s: %v, ожидалось %v", run, uid, got, want[uid])
+			}
+		}
+		rows.Close()
+	}
+}
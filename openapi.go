@@ -0,0 +1,696 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// === Спецификация OpenAPI 3 ===
+
+// Схемы моделей строятся отражением по тем же структурам, которые кодируют
+// обработчики, поэтому описание полей не может разойтись с реальным JSON.
+// Пути и параметры описаны вручную ниже.
+
+type obj = map[string]any
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	moneyType  = reflect.TypeOf(Money{})
+	numberType = reflect.TypeOf(json.Number(""))
+)
+
+// schemaRegistry собирает components/schemas: каждая именованная структура
+// описывается один раз и дальше подставляется ссылкой $ref.
+type schemaRegistry struct {
+	names   map[reflect.Type]string
+	schemas obj
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{names: make(map[reflect.Type]string), schemas: obj{}}
+}
+
+// register добавляет структуру под публичным именем (Order, Delivery, ...).
+func (r *schemaRegistry) register(name string, v any) {
+	t := reflect.TypeOf(v)
+	r.names[t] = name
+	r.schemas[name] = r.structSchema(t)
+}
+
+func (r *schemaRegistry) ref(name string) obj {
+	return obj{"$ref": "#/components/schemas/" + name}
+}
+
+func (r *schemaRegistry) schema(t reflect.Type) obj {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if name, ok := r.names[t]; ok {
+		return r.ref(name)
+	}
+	switch {
+	case t == timeType:
+		return obj{"type": "string", "format": "date-time"}
+	case t == moneyType:
+		return obj{"type": "number", "example": 1817.5,
+			"description": "Сумма в единицах валюты заказа (payment.currency, ISO 4217), не точнее её минимальной единицы"}
+	case t == numberType:
+		return obj{"type": "number"}
+	case t.Kind() == reflect.Struct:
+		return r.structSchema(t)
+	case t.Kind() == reflect.Slice:
+		return obj{"type": "array", "items": r.schema(t.Elem())}
+	case t.Kind() == reflect.String:
+		return obj{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return obj{"type": "boolean"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return obj{"type": "number"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s := obj{"type": "integer"}
+		if t.Size() == 8 {
+			s["format"] = "int64"
+		}
+		return s
+	}
+	return obj{}
+}
+
+func (r *schemaRegistry) structSchema(t reflect.Type) obj {
+	props := obj{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			// Встроенная структура: её поля поднимаются на уровень выше
+			embedded := r.structSchema(f.Type)
+			for k, v := range embedded["properties"].(obj) {
+				props[k] = v
+			}
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := r.schema(f.Type)
+		if f.Type.Kind() == reflect.Pointer {
+			s = obj{"allOf": []any{s}, "nullable": true}
+		}
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+		props[name] = s
+	}
+	sort.Strings(required)
+	s := obj{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// --- помощники для описания путей ---
+
+func queryParam(name, typ, desc string) obj {
+	return obj{"name": name, "in": "query", "required": false, "description": desc, "schema": obj{"type": typ}}
+}
+
+func enumQueryParam(name, desc string, values ...string) obj {
+	return obj{"name": name, "in": "query", "required": false, "description": desc,
+		"schema": obj{"type": "string", "enum": values}}
+}
+
+func pathParam(name, desc string, values ...string) obj {
+	s := obj{"type": "string"}
+	if len(values) > 0 {
+		s["enum"] = values
+	}
+	return obj{"name": name, "in": "path", "required": true, "description": desc, "schema": s}
+}
+
+func jsonResponse(desc string, schema obj) obj {
+	return obj{"description": desc, "content": obj{"application/json": obj{"schema": schema}}}
+}
+
+func htmlResponse(desc string) obj {
+	return obj{"description": desc, "content": obj{"text/html": obj{"schema": obj{"type": "string"}}}}
+}
+
+// Все ошибки отдаются через http.Error: текст в text/plain.
+func errorResponse(desc string) obj {
+	return obj{"description": desc, "content": obj{"text/plain": obj{"schema": obj{"$ref": "#/components/schemas/Error"}}}}
+}
+
+// adminOnly помечает операцию как требующую токена администратора.
+func adminOnly(op obj) obj {
+	op["security"] = []any{obj{"adminToken": []any{}}}
+	op["responses"].(obj)["403"] = errorResponse("Нет токена администратора")
+	return op
+}
+
+// staffOnly помечает операцию, доступную только с токеном роли.
+func staffOnly(op obj) obj {
+	op["security"] = []any{obj{"roleToken": []any{}}}
+	op["responses"].(obj)["403"] = errorResponse("Нет токена роли support, manager или admin")
+	return op
+}
+
+// withPII помечает операцию, в ответе которой есть контакты получателя:
+// без токена manager или admin они замаскированы.
+func withPII(op obj) obj {
+	op["security"] = []any{obj{}, obj{"roleToken": []any{}}}
+	op["description"] = "Имя, телефон, email, адрес и индекс получателя маскируются по правилам PII_MASK, " +
+		"если запрос без токена роли manager или admin."
+	return op
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func filterParams() []any {
+	return []any{
+		queryParam("q", "string", "Поиск подстроки в order_uid, track_number, customer_id, а для ролей manager и admin — и в имени, телефоне и email получателя"),
+		queryParam("date_from", "string", "Начало периода по date_created: YYYY-MM-DD или RFC 3339"),
+		queryParam("date_to", "string", "Конец периода; дата без времени включает весь день"),
+		queryParam("customer_id", "string", "Точное совпадение customer_id"),
+		queryParam("delivery_service", "string", "Точное совпадение delivery_service"),
+		queryParam("currency", "string", "Код валюты оплаты, например RUB"),
+	}
+}
+
+// reportParams — фильтры и валюта отчёта для статистики и выгрузки.
+func reportParams() []any {
+	return append(filterParams(), queryParam("report_currency", "string",
+		"Пересчитать суммы в эту валюту (ISO 4217) по курсу ЦБ на дату оплаты; заказы без курса не входят в выручку. Статистика по умолчанию считается в RUB"))
+}
+
+func buildOpenAPI() obj {
+	reg := newSchemaRegistry()
+	reg.register("Delivery", Delivery{})
+	reg.register("Payment", Payment{})
+	reg.register("Item", Item{})
+	reg.register("Order", Order{})
+	reg.register("OrderSummary", orderSummary{})
+	reg.register("OrderList", orderList{})
+	reg.register("StatsRow", statsRow{})
+	reg.register("StatsReport", statsReport{})
+	reg.register("LiveWindow", liveWindowStats{})
+	reg.register("LiveMinute", liveMinute{})
+	reg.register("LiveSnapshot", liveSnapshot{})
+	reg.register("Rejection", rejectionEvent{})
+	reg.register("CacheStats", cacheStats{})
+	reg.register("DeadLetter", deadLetter{})
+	reg.register("DeadLetterList", deadLetterList{})
+	reg.register("ImportResult", importResult{})
+	reg.register("ImportReport", importReport{})
+	reg.register("ExchangeRate", exchangeRate{})
+	reg.register("RateList", rateList{})
+	reg.register("RatesLoadReport", ratesLoadReport{})
+	reg.register("KeyStatus", keyStatus{})
+	reg.register("KeyRotationReport", keyRotationReport{})
+	reg.register("ErasureReport", erasureReport{})
+	reg.register("AuditEntry", auditEntry{})
+	reg.register("ArchiveReport", archiveReport{})
+	reg.register("OutboxStats", outboxStats{})
+	reg.register("Webhook", webhook{})
+	reg.register("WebhookRequest", webhookRequest{})
+	reg.register("WebhookDelivery", webhookDelivery{})
+	reg.register("WebhookTestResult", webhookTestResult{})
+	reg.register("ShardInfo", shardInfo{})
+	reg.register("RebalanceReport", rebalanceReport{})
+	reg.schemas["Error"] = obj{"type": "string", "description": "Текст ошибки"}
+
+	listParams := append(filterParams(),
+		enumQueryParam("sort", "Поле сортировки; amount — по сумме внутри валюты, валюты по коду", sortedKeys(sortColumns)...),
+		enumQueryParam("order", "Направление сортировки (по умолчанию desc)", "asc", "desc"),
+		obj{"name": "page", "in": "query", "required": false, "schema": obj{"type": "integer", "minimum": 1, "default": 1},
+			"description": fmt.Sprintf("Номер страницы; page×limit — не больше %d", maxListDepth)},
+		obj{"name": "limit", "in": "query", "required": false,
+			"schema": obj{"type": "integer", "minimum": 1, "maximum": maxPageLimit, "default": defaultPageLimit}},
+	)
+
+	groups := sortedKeys(statsGroups)
+
+	paths := obj{
+		"/orders": obj{"get": obj{
+			"operationId": "listOrders",
+			"summary":     "Страница списка заказов с фильтрами и сортировкой",
+			"parameters":  listParams,
+			"responses": obj{
+				"200": jsonResponse("Страница списка", reg.ref("OrderList")),
+				"400": errorResponse("Некорректные параметры"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		}, "post": adminOnly(obj{
+			"operationId": "createOrder",
+			"summary":     "Принять заказ так же, как из NATS",
+			"requestBody": obj{"required": true, "content": obj{"application/json": obj{"schema": reg.ref("Order")}}},
+			"responses": obj{
+				"201": jsonResponse("Заказ сохранён и виден в /order/{order_uid}", reg.ref("OrderSummary")),
+				"409": errorResponse("Заказ с таким order_uid уже есть, ничего не сохранено"),
+				"413": errorResponse("Тело больше 1 МиБ"),
+				"422": errorResponse("Заказ отклонён: невалидный JSON или не прошёл проверку"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/export": obj{"get": staffOnly(withPII(obj{
+			"operationId": "exportOrders",
+			"summary":     "Выгрузка заказов по фильтрам списка, без страниц; ответ пишется потоком",
+			"parameters": append(reportParams(),
+				enumQueryParam("format", "Формат файла (по умолчанию csv)", sortedKeys(exportFormats)...),
+				enumQueryParam("layout", "order — строка на заказ, item — строка на товар (по умолчанию order)", exportLayouts...),
+				enumQueryParam("sort", "Поле сортировки; amount — по сумме внутри валюты, валюты по коду", sortedKeys(sortColumns)...),
+				enumQueryParam("order", "Направление сортировки (по умолчанию desc)", "asc", "desc"),
+			),
+			"responses": obj{
+				"200": obj{"description": "Файл выгрузки (Content-Disposition: attachment)", "content": obj{
+					"text/csv":                        obj{"schema": obj{"type": "string"}},
+					"application/x-ndjson":            obj{"schema": obj{"type": "string"}},
+					exportFormats["xlsx"].contentType: obj{"schema": obj{"type": "string", "format": "binary"}},
+				}},
+				"400": errorResponse("Некорректные параметры"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		}))},
+		"/order/{order_uid}": obj{"get": withPII(obj{
+			"operationId": "getOrder",
+			"summary":     "Заказ целиком (из кэша; заказы старше срока хранения — из архива)",
+			"parameters":  []any{pathParam("order_uid", "Идентификатор заказа")},
+			"responses": obj{
+				"200": jsonResponse("Заказ; из архива — с заголовком X-Order-Source: archive", reg.ref("Order")),
+				"404": errorResponse("Заказ не найден"),
+				"500": errorResponse("Ошибка чтения архива"),
+			},
+		}), "delete": adminOnly(obj{
+			"operationId": "deleteOrder",
+			"summary":     "Удалить заказ из БД и кэша",
+			"parameters":  []any{pathParam("order_uid", "Идентификатор заказа")},
+			"responses": obj{
+				"204": obj{"description": "Заказ удалён"},
+				"404": errorResponse("Заказ не найден"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/cache": obj{"get": adminOnly(obj{
+			"operationId": "cacheStats",
+			"summary":     "Размер кэша, попадания и промахи, время последней загрузки",
+			"responses":   obj{"200": jsonResponse("Статистика кэша", reg.ref("CacheStats"))},
+		})},
+		"/admin/cache/reload": obj{"post": adminOnly(obj{
+			"operationId": "cacheReload",
+			"summary":     "Перечитать кэш из БД",
+			"responses": obj{
+				"200": jsonResponse("Статистика после загрузки", reg.ref("CacheStats")),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/import": obj{"post": adminOnly(obj{
+			"operationId": "importOrders",
+			"summary":     "Массовый импорт исторических заказов; известные order_uid пропускаются",
+			"parameters": []any{
+				obj{"name": "batch", "in": "query", "required": false, "description": "Заказов в одной транзакции",
+					"schema": obj{"type": "integer", "minimum": 1, "maximum": maxImportBatch, "default": defaultImportBatch}},
+				enumQueryParam("cache", "0 — не добавлять заказы в кэш (видны после POST /admin/cache/reload)", "0", "1"),
+			},
+			"requestBody": obj{"required": true, "content": obj{
+				"application/x-ndjson": obj{"schema": obj{"type": "string"}},
+				"application/json":     obj{"schema": obj{"type": "array", "items": reg.ref("Order")}},
+			}},
+			"responses": obj{
+				"200": jsonResponse("Отчёт: сохранённые, пропущенные и отклонённые заказы", reg.ref("ImportReport")),
+				"400": errorResponse("Некорректные параметры или тело"),
+				"413": errorResponse("Тело больше 256 МиБ"),
+			},
+		})},
+		"/admin/rates": obj{"post": adminOnly(obj{
+			"operationId": "loadRates",
+			"summary":     "Загрузить курсы валют: XML ЦБ (XML_daily.asp) или CSV date,currency,nominal,value",
+			"requestBody": obj{"required": true, "content": obj{
+				"application/xml": obj{"schema": obj{"type": "string"}},
+				"text/csv":        obj{"schema": obj{"type": "string"}},
+			}},
+			"responses": obj{
+				"200": jsonResponse("Загружено; курс на ту же дату заменён", reg.ref("RatesLoadReport")),
+				"400": errorResponse("Файл не разобран"),
+				"413": errorResponse("Тело больше 32 МиБ"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/rates": obj{"get": obj{
+			"operationId": "listRates",
+			"summary":     "Курсы ЦБ, действующие на дату: рублей за nominal единиц валюты",
+			"parameters":  []any{queryParam("date", "string", "Дата YYYY-MM-DD, по умолчанию сегодня")},
+			"responses": obj{
+				"200": jsonResponse("Курсы", reg.ref("RateList")),
+				"400": errorResponse("Некорректная дата"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		}},
+		"/admin/keys": obj{"get": adminOnly(obj{
+			"operationId": "keyStatus",
+			"summary":     "Ключи шифрования контактов и число строк deliveries по версии ключа",
+			"responses": obj{
+				"200": jsonResponse("Состояние шифрования", reg.ref("KeyStatus")),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/keys/rotate": obj{"post": adminOnly(obj{
+			"operationId": "rotateKeys",
+			"summary":     "Перешифровать активным ключом строки, записанные старыми ключами или открытым текстом",
+			"responses": obj{
+				"200": jsonResponse("Перешифровано; failed — строки, которые не удалось расшифровать", reg.ref("KeyRotationReport")),
+				"409": errorResponse("Сервис запущен без PII_KEYFILE"),
+				"500": errorResponse("Ошибка БД; уже перешифрованные пачки сохранены"),
+			},
+		})},
+		"/admin/customers/{customer_id}/erase": obj{"post": adminOnly(obj{
+			"operationId": "eraseCustomer",
+			"summary":     "Стереть контакты получателя во всех заказах покупателя; суммы и товары сохраняются",
+			"parameters": []any{
+				pathParam("customer_id", "Идентификатор покупателя"),
+				enumQueryParam("dry_run", "1 — только показать затронутые заказы, ничего не менять", "1"),
+				queryParam("reason", "string", "Основание (номер обращения), записывается в журнал аудита; обязателен без dry_run"),
+			},
+			"responses": obj{
+				"200": jsonResponse("Отчёт; без dry_run — с номером записи аудита", reg.ref("ErasureReport")),
+				"400": errorResponse("Не указан reason"),
+				"404": errorResponse("Заказов покупателя нет"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/audit": obj{"get": adminOnly(obj{
+			"operationId": "listAudit",
+			"summary":     "Журнал аудита, новые записи сначала",
+			"parameters": []any{
+				queryParam("action", "string", "Действие, например customer.erase"),
+				queryParam("subject", "string", "Объект действия, например customer_id"),
+				obj{"name": "limit", "in": "query", "required": false,
+					"schema": obj{"type": "integer", "minimum": 1, "maximum": maxAuditLimit, "default": defaultAuditLimit}},
+			},
+			"responses": obj{
+				"200": jsonResponse("Записи", obj{"type": "array", "items": reg.ref("AuditEntry")}),
+				"400": errorResponse("Некорректный limit"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/archive/run": obj{"post": adminOnly(obj{
+			"operationId": "runArchive",
+			"summary":     "Перенести в архив заказы старше RETENTION_DAYS, не дожидаясь расписания",
+			"responses": obj{
+				"200": jsonResponse("Перенесено; busy — архивацию выполнял другой экземпляр", reg.ref("ArchiveReport")),
+				"409": errorResponse("Архивация выключена"),
+				"500": errorResponse("Ошибка БД; уже перенесённые пачки сохранены"),
+			},
+		})},
+		"/admin/archive/{month}": obj{"get": adminOnly(obj{
+			"operationId": "archiveMonth",
+			"summary":     "Заказы из архива за месяц (по date_created в UTC) одним NDJSON.gz",
+			"parameters":  []any{pathParam("month", "Месяц YYYY-MM")},
+			"responses": obj{
+				"200": obj{"description": "Заказы, по одному JSON в строке",
+					"content": obj{"application/gzip": obj{"schema": obj{"type": "string", "format": "binary"}}}},
+				"400": errorResponse("Некорректный месяц"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/outbox": obj{"get": adminOnly(obj{
+			"operationId": "outboxStats",
+			"summary":     "Очередь событий order.* для NATS: сколько ждут публикации и почему",
+			"responses": obj{
+				"200": jsonResponse("Состояние outbox", reg.ref("OutboxStats")),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/webhooks": obj{"post": adminOnly(obj{
+			"operationId": "createWebhook",
+			"summary":     "Подписать URL на события о заказах; пустой фильтр — любые значения",
+			"requestBody": obj{"required": true, "content": obj{"application/json": obj{"schema": reg.ref("WebhookRequest")}}},
+			"responses": obj{
+				"201": jsonResponse("Подписка создана; secret для проверки подписи показывается только здесь", reg.ref("Webhook")),
+				"400": errorResponse("Невалидный JSON, URL или тип события"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		}), "get": adminOnly(obj{
+			"operationId": "listWebhooks",
+			"summary":     "Подписки на события о заказах",
+			"responses": obj{
+				"200": jsonResponse("Подписки без секретов", obj{"type": "array", "items": reg.ref("Webhook")}),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/webhooks/{id}": obj{"delete": adminOnly(obj{
+			"operationId": "deleteWebhook",
+			"summary":     "Удалить подписку вместе с журналом доставок",
+			"parameters":  []any{pathParam("id", "Номер подписки")},
+			"responses": obj{
+				"204": obj{"description": "Подписка удалена"},
+				"400": errorResponse("Некорректный id"),
+				"404": errorResponse("Подписка не найдена"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/webhooks/{id}/enable": obj{"post": adminOnly(obj{
+			"operationId": "enableWebhook",
+			"summary":     "Включить подписку, выключенную после неудачных доставок; отложенные доставки продолжаются",
+			"parameters":  []any{pathParam("id", "Номер подписки")},
+			"responses": obj{
+				"204": obj{"description": "Подписка включена"},
+				"400": errorResponse("Некорректный id"),
+				"404": errorResponse("Подписка не найдена"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/webhooks/{id}/test": obj{"post": adminOnly(obj{
+			"operationId": "testWebhook",
+			"summary":     "Отправить подписанное событие ping и вернуть ответ получателя",
+			"parameters":  []any{pathParam("id", "Номер подписки")},
+			"responses": obj{
+				"200": jsonResponse("Ответ получателя; error — если не 2xx", reg.ref("WebhookTestResult")),
+				"400": errorResponse("Некорректный id"),
+				"404": errorResponse("Подписка не найдена"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/webhooks/{id}/deliveries": obj{"get": adminOnly(obj{
+			"operationId": "webhookDeliveries",
+			"summary":     "Журнал доставок подписки, новые сначала",
+			"parameters": []any{
+				pathParam("id", "Номер подписки"),
+				enumQueryParam("status", "Состояние доставки", "pending", "delivered", "failed"),
+				obj{"name": "limit", "in": "query", "required": false,
+					"schema": obj{"type": "integer", "minimum": 1, "maximum": maxDLQLimit, "default": defaultDLQLimit}},
+			},
+			"responses": obj{
+				"200": jsonResponse("Доставки", obj{"type": "array", "items": reg.ref("WebhookDelivery")}),
+				"400": errorResponse("Некорректный id, status или limit"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/shards": obj{"get": adminOnly(obj{
+			"operationId": "shardStatus",
+			"summary":     "Шарды из SHARD_MAP: сколько в них заказов и сколько лежит не по текущей карте",
+			"responses": obj{
+				"200": jsonResponse("Шарды, первым — основная БД", obj{"type": "array", "items": reg.ref("ShardInfo")}),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/shards/rebalance": obj{"post": adminOnly(obj{
+			"operationId": "rebalanceShards",
+			"summary":     "Перенести заказы и архив в шарды по текущей карте",
+			"responses": obj{
+				"200": jsonResponse("Перенесено; failed — заказы, которые перенести не удалось", reg.ref("RebalanceReport")),
+				"409": errorResponse("Перенос уже выполняет другой экземпляр"),
+				"500": errorResponse("Ошибка БД; уже перенесённые заказы остаются на новом месте"),
+			},
+		})},
+		"/admin/dlq": obj{"get": adminOnly(obj{
+			"operationId": "listDeadLetters",
+			"summary":     "Сообщения из NATS, которые не удалось принять",
+			"parameters": []any{
+				obj{"name": "page", "in": "query", "required": false, "schema": obj{"type": "integer", "minimum": 1, "default": 1}},
+				obj{"name": "limit", "in": "query", "required": false,
+					"schema": obj{"type": "integer", "minimum": 1, "maximum": maxDLQLimit, "default": defaultDLQLimit}},
+				enumQueryParam("all", "1 — вместе с уже переотправленными", "1"),
+			},
+			"responses": obj{
+				"200": jsonResponse("Страница списка, новые сначала", reg.ref("DeadLetterList")),
+				"400": errorResponse("Некорректные параметры"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/admin/dlq/{id}/resubmit": obj{"post": adminOnly(obj{
+			"operationId": "resubmitDeadLetter",
+			"summary":     "Принять сообщение повторно; непустое тело заменяет сохранённое",
+			"parameters":  []any{pathParam("id", "Идентификатор сообщения")},
+			"requestBody": obj{"required": false, "content": obj{"application/json": obj{"schema": reg.ref("Order")}}},
+			"responses": obj{
+				"200": jsonResponse("Заказ принят", reg.ref("OrderSummary")),
+				"400": errorResponse("Некорректный id"),
+				"404": errorResponse("Сообщение не найдено"),
+				"409": errorResponse("Сообщение уже переотправлено"),
+				"422": errorResponse("Заказ снова отклонён"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		})},
+		"/events": obj{"get": obj{
+			"operationId": "streamEvents",
+			"summary":     "Поток Server-Sent Events: order — сохранённый заказ (OrderSummary), rejected — отказ (Rejection, только для админов)",
+			"parameters": []any{
+				obj{"name": "Last-Event-ID", "in": "header", "required": false, "schema": obj{"type": "string"},
+					"description": "ID последнего полученного события для догоняющей выдачи"},
+				queryParam("last_event_id", "string", "То же, что Last-Event-ID, для нового EventSource"),
+			},
+			"security": []any{obj{}, obj{"adminToken": []any{}}, obj{"adminCookie": []any{}}},
+			"responses": obj{
+				"200": obj{"description": "Поток событий", "content": obj{"text/event-stream": obj{"schema": obj{"type": "string"}}}},
+				"400": errorResponse("Некорректный Last-Event-ID"),
+			},
+		}},
+		"/stats/summary": obj{"get": obj{
+			"operationId": "statsSummary",
+			"summary":     "Итоги продаж за период",
+			"parameters":  reportParams(),
+			"responses": obj{
+				"200": jsonResponse("Итоги в поле total", reg.ref("StatsReport")),
+				"400": errorResponse("Некорректные параметры"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		}},
+		"/stats/{group}": obj{"get": obj{
+			"operationId": "statsByGroup",
+			"summary":     "Продажи в разрезе периода или атрибута заказа",
+			"parameters":  append([]any{pathParam("group", "Разрез", groups...)}, reportParams()...),
+			"responses": obj{
+				"200": jsonResponse("Строки по разрезу и итог", reg.ref("StatsReport")),
+				"400": errorResponse("Неизвестный разрез или некорректные параметры"),
+				"500": errorResponse("Ошибка БД"),
+			},
+		}},
+		"/stats/live": obj{"get": obj{
+			"operationId": "statsLive",
+			"summary":     "Оперативная статистика приёма за 5/15/60 минут",
+			"responses": obj{
+				"200": jsonResponse("Снимок счётчиков", reg.ref("LiveSnapshot")),
+			},
+		}},
+		"/openapi.json": obj{"get": obj{
+			"operationId": "openapi",
+			"summary":     "Этот документ",
+			"responses":   obj{"200": jsonResponse("Спецификация OpenAPI 3", obj{"type": "object"})},
+		}},
+		"/": obj{"get": obj{
+			"operationId": "homePage",
+			"summary":     "HTML: список заказов",
+			"parameters":  listParams,
+			"responses":   obj{"200": htmlResponse("Страница")},
+		}},
+		"/ui/{order_uid}": obj{"get": obj{
+			"operationId": "orderPage",
+			"summary":     "HTML: карточка заказа",
+			"parameters":  []any{pathParam("order_uid", "Идентификатор заказа")},
+			"responses":   obj{"200": htmlResponse("Страница")},
+		}},
+		"/ui/dashboard": obj{"get": obj{
+			"operationId": "dashboardPage",
+			"summary":     "HTML: аналитика продаж",
+			"responses":   obj{"200": htmlResponse("Страница")},
+		}},
+		"/docs": obj{"get": obj{
+			"operationId": "docsPage",
+			"summary":     "HTML: документация по этой спецификации",
+			"responses":   obj{"200": htmlResponse("Страница")},
+		}},
+	}
+
+	return obj{
+		"openapi": "3.0.3",
+		"info": obj{
+			"title":       "Сервис заказов",
+			"version":     "1.0.0",
+			"description": "Заказы из NATS Streaming, сохранённые в PostgreSQL и закэшированные в памяти.",
+		},
+		"servers": []any{obj{"url": "/"}},
+		"paths":   paths,
+		"components": obj{
+			"schemas": reg.schemas,
+			"securitySchemes": obj{
+				"adminToken": obj{"type": "http", "scheme": "bearer", "description": "Значение ADMIN_TOKEN сервиса"},
+				"adminCookie": obj{"type": "apiKey", "in": "cookie", "name": "admin_token",
+					"description": "ADMIN_TOKEN в cookie — только для GET /events, где EventSource не может передать заголовок"},
+				"roleToken": obj{"type": "http", "scheme": "bearer",
+					"description": "ADMIN_TOKEN, MANAGER_TOKEN или SUPPORT_TOKEN сервиса; определяет, видны ли контакты получателя"},
+			},
+		},
+	}
+}
+
+// checkOpenAPIRoutes предупреждает в логе о маршрутах роутера, которых нет
+// в спецификации, чтобы новый эндпоинт не остался без описания. Тесты
+// (openapi_test.go) на таких маршрутах падают.
+func checkOpenAPIRoutes(r chi.Routes) {
+	for _, route := range undeclaredRoutes(r) {
+		log.Printf(" Маршрут %s не описан в openapi.json", route)
+	}
+}
+
+// undeclaredRoutes возвращает маршруты роутера («GET /path»), которых нет
+// в спецификации. Раздача статики (/*) не описывается.
+func undeclaredRoutes(r chi.Routes) []string {
+	paths := buildOpenAPI()["paths"].(obj)
+	var missing []string
+	chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if strings.HasSuffix(route, "/*") {
+			return nil
+		}
+		ops, ok := paths[route].(obj)
+		if !ok || ops[strings.ToLower(method)] == nil {
+			missing = append(missing, method+" "+route)
+		}
+		return nil
+	})
+	return missing
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+// === HTTP: GET /openapi.json ===
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIJSON, _ = json.MarshalIndent(buildOpenAPI(), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIJSON)
+}
+
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	ui.render(w, "docs", nil)
+}
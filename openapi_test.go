@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// === Контракт HTTP API ===
+// Ответы настоящих обработчиков сверяются со спецификацией buildOpenAPI():
+// статус и Content-Type должны быть объявлены у операции, а JSON — подходить
+// под схему, без полей, которых в схеме нет.
+
+// testSpec — спецификация в том виде, в каком её получает клиент.
+func testSpec(t *testing.T) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(buildOpenAPI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec map[string]any
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+// checkResponse проверяет ответ на запрос method к маршруту route (шаблон
+// chi, как в paths спецификации) и возвращает тело.
+func checkResponse(t *testing.T, spec map[string]any, method, route string, resp *http.Response) []byte {
+	t.Helper()
+	body := readBody(t, resp)
+	op, _ := spec["paths"].(map[string]any)[route].(map[string]any)[strings.ToLower(method)].(map[string]any)
+	if op == nil {
+		t.Fatalf("%s %s нет в спецификации", method, route)
+	}
+	status := strconv.Itoa(resp.StatusCode)
+	declared, _ := op["responses"].(map[string]any)[status].(map[string]any)
+	if declared == nil {
+		t.Fatalf("%s %s: статус %s не объявлен (тело: %.200s)", method, route, status, body)
+	}
+	content, _ := declared["content"].(map[string]any)
+	if content == nil {
+		if len(body) > 0 {
+			t.Errorf("%s %s %s: у ответа без content тело %.200s", method, route, status, body)
+		}
+		return body
+	}
+	media, _ := content[mediaType(resp)].(map[string]any)
+	if media == nil {
+		t.Fatalf("%s %s %s: Content-Type %q не объявлен", method, route, status, resp.Header.Get("Content-Type"))
+	}
+	schema, _ := media["schema"].(map[string]any)
+	if mediaType(resp) != "application/json" {
+		if len(body) == 0 {
+			t.Errorf("%s %s %s: пустое тело", method, route, status)
+		}
+		return body
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("%s %s %s: невалидный JSON: %v", method, route, status, err)
+	}
+	for _, problem := range validateSchema(spec, schema, v, "$") {
+		t.Errorf("%s %s %s: %s", method, route, status, problem)
+	}
+	return body
+}
+
+// validateSchema проверяет значение по подмножеству JSON Schema, которое
+// использует buildOpenAPI: $ref, allOf, nullable, type, properties,
+// required, items, enum и format date-time.
+func validateSchema(spec, schema map[string]any, v any, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		target, _ := spec["components"].(map[string]any)["schemas"].(map[string]any)[name].(map[string]any)
+		if target == nil {
+			return []string{fmt.Sprintf("%s: нет схемы %s", path, ref)}
+		}
+		return validateSchema(spec, target, v, path)
+	}
+	if v == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{path + ": null там, где он не разрешён"}
+	}
+	var problems []string
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			problems = append(problems, validateSchema(spec, sub.(map[string]any), v, path)...)
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, v) {
+		problems = append(problems, fmt.Sprintf("%s: %v не из %v", path, v, enum))
+	}
+
+	switch schema["type"] {
+	case "object":
+		m, ok := v.(map[string]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: ожидался объект, получено %T", path, v))
+		}
+		props, hasProps := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := m[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: нет обязательного поля %s", path, name))
+			}
+		}
+		if !hasProps {
+			return problems
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub, ok := props[k].(map[string]any)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: поле %s не описано в схеме", path, k))
+				continue
+			}
+			problems = append(problems, validateSchema(spec, sub, m[k], path+"."+k)...)
+		}
+	case "array":
+		a, ok := v.([]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: ожидался массив, получено %T", path, v))
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, el := range a {
+			problems = append(problems, validateSchema(spec, items, el, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: ожидалась строка, получено %T", path, v))
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q не date-time", path, s))
+			}
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s: ожидалось число, получено %T", path, v))
+		}
+	case "integer":
+		if f, ok := v.(float64); !ok || f != float64(int64(f)) {
+			problems = append(problems, fmt.Sprintf("%s: ожидалось целое, получено %v", path, v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: ожидалось boolean, получено %T", path, v))
+		}
+	}
+	return problems
+}
+
+func TestOpenAPIDescribesAllRoutes(t *testing.T) {
+	if missing := undeclaredRoutes(newRouter()); len(missing) > 0 {
+		t.Errorf("маршруты без описания в openapi.json: %s", strings.Join(missing, ", "))
+	}
+}
+
+func TestOpenAPIValidatorRejectsDrift(t *testing.T) {
+	spec := testSpec(t)
+	ref := map[string]any{"$ref": "#/components/schemas/OrderSummary"}
+	cases := map[string]any{
+		"лишнее поле":      map[string]any{"order_uid": "x", "extra": 1},
+		"нет обязательных": map[string]any{"order_uid": "x"},
+		"не тот тип":       []any{},
+	}
+	for name, v := range cases {
+		if len(validateSchema(spec, ref, v, "$")) == 0 {
+			t.Errorf("%s: расхождение со схемой не найдено", name)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	srv := newTestServer(t)
+	spec := testSpec(t)
+	body := checkResponse(t, spec, "GET", "/openapi.json", doRequest(t, srv, "GET", "/openapi.json", "", nil))
+
+	var served map[string]any
+	if err := json.Unmarshal(body, &served); err != nil {
+		t.Fatal(err)
+	}
+	if served["openapi"] != "3.0.3" || len(served["paths"].(map[string]any)) != len(spec["paths"].(map[string]any)) {
+		t.Errorf("/openapi.json отдаёт не ту спецификацию")
+	}
+}
+
+func TestOpenAPIOrderFromCache(t *testing.T) {
+	resetCache(t)
+	order := loadFixture(t, "basic")
+	cachePut(order, 1)
+	srv := newTestServer(t)
+	spec := testSpec(t)
+
+	for _, token := range []string{"", testSupportToken, testManagerToken, testAdminToken} {
+		resp := doRequest(t, srv, "GET", "/order/"+order.OrderUID, token, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("токен %q: статус %d", token, resp.StatusCode)
+		}
+		body := checkResponse(t, spec, "GET", "/order/{order_uid}", resp)
+
+		var got Order
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatal(err)
+		}
+		masked := got.Delivery.Phone != order.Delivery.Phone
+		if sees := tokenRole(token).seesPII(); masked == sees {
+			t.Errorf("токен %q: телефон %q, контакты должны быть видны: %v", token, got.Delivery.Phone, sees)
+		}
+	}
+}
+
+func TestOpenAPILiveStats(t *testing.T) {
+	srv := newTestServer(t)
+	resp := doRequest(t, srv, "GET", "/stats/live", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("статус %d", resp.StatusCode)
+	}
+	checkResponse(t, testSpec(t), "GET", "/stats/live", resp)
+}
+
+func TestOpenAPIErrorResponses(t *testing.T) {
+	srv := newTestServer(t)
+	spec := testSpec(t)
+	cases := []struct {
+		method, path, route, token string
+		status                     int
+	}{
+		{"GET", "/orders?limit=0", "/orders", "", http.StatusBadRequest},
+		{"GET", "/orders?date_from=вчера", "/orders", "", http.StatusBadRequest},
+		{"GET", "/stats/summary?report_currency=XYZ", "/stats/summary", "", http.StatusBadRequest},
+		{"GET", "/stats/colour", "/stats/{group}", "", http.StatusBadRequest},
+		{"GET", "/export", "/export", "", http.StatusForbidden},
+		{"GET", "/export?format=doc", "/export", testSupportToken, http.StatusBadRequest},
+		{"POST", "/orders", "/orders", testManagerToken, http.StatusForbidden},
+		{"DELETE", "/order/x", "/order/{order_uid}", "", http.StatusForbidden},
+		{"GET", "/admin/cache", "/admin/cache", testSupportToken, http.StatusForbidden},
+		{"GET", "/admin/webhooks", "/admin/webhooks", "", http.StatusForbidden},
+		{"GET", "/admin/webhooks/abc/deliveries", "/admin/webhooks/{id}/deliveries", testAdminToken, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		resp := doRequest(t, srv, c.method, c.path, c.token, nil)
+		if resp.StatusCode != c.status {
+			t.Errorf("%s %s: статус %d, ожидался %d", c.method, c.path, resp.StatusCode, c.status)
+			continue
+		}
+		checkResponse(t, spec, c.method, c.route, resp)
+	}
+
+	// Некорректный Last-Event-ID — до подписки, поток не открывается
+	req, _ := http.NewRequest("GET", srv.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "вчера")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("/events: статус %d", resp.StatusCode)
+	}
+	checkResponse(t, spec, "GET", "/events", resp)
+}
+
+func TestOpenAPIDatabaseErrors(t *testing.T) {
+	resetCache(t)
+	brokenDB(t)
+	srv := newTestServer(t)
+	spec := testSpec(t)
+	cases := []struct{ path, route string }{
+		{"/orders", "/orders"},
+		{"/order/unknown", "/order/{order_uid}"},
+		{"/stats/summary", "/stats/summary"},
+		{"/stats/month", "/stats/{group}"},
+	}
+	for _, c := range cases {
+		resp := doRequest(t, srv, "GET", c.path, "", nil)
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("GET %s: статус %d, ожидался 500", c.path, resp.StatusCode)
+			continue
+		}
+		checkResponse(t, spec, "GET", c.route, resp)
+	}
+}
+
+func TestOpenAPIOrdersFromDB(t *testing.T) {
+	needDB(t)
+	orders := saveFixtures(t, "basic", "clothes", "kids")
+	srv := newTestServer(t)
+	spec := testSpec(t)
+
+	resp := doRequest(t, srv, "GET", "/orders?sort=amount&order=asc&limit=2", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/orders: статус %d", resp.StatusCode)
+	}
+	var list orderList
+	if err := json.Unmarshal(checkResponse(t, spec, "GET", "/orders", resp), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != len(orders) || len(list.Orders) != 2 {
+		t.Errorf("/orders: total %d, строк %d", list.Total, len(list.Orders))
+	}
+
+	resp = doRequest(t, srv, "GET", "/orders?q="+url.QueryEscape(orders[0].TrackNumber), "", nil)
+	if err := json.Unmarshal(checkResponse(t, spec, "GET", "/orders", resp), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 || list.Orders[0].OrderUID != orders[0].OrderUID {
+		t.Errorf("поиск по трек-номеру: %+v", list)
+	}
+
+	resp = doRequest(t, srv, "GET", "/order/"+orders[1].OrderUID, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/order: статус %d", resp.StatusCode)
+	}
+	checkResponse(t, spec, "GET", "/order/{order_uid}", resp)
+
+	resp = doRequest(t, srv, "GET", "/order/unknown", "", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("/order/unknown: статус %d", resp.StatusCode)
+	}
+	checkResponse(t, spec, "GET", "/order/{order_uid}", resp)
+
+	resp = doRequest(t, srv, "GET", "/export?format=ndjson", testSupportToken, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/export: статус %d", resp.StatusCode)
+	}
+	if lines := strings.Count(string(checkResponse(t, spec, "GET", "/export", resp)), "\n"); lines != len(orders) {
+		t.Errorf("/export: %d строк, ожидалось %d", lines, len(orders))
+	}
+}
+
+func TestOpenAPIStatsFromDB(t *testing.T) {
+	needDB(t)
+	orders := saveFixtures(t, "basic", "clothes", "kids")
+	srv := newTestServer(t)
+	spec := testSpec(t)
+
+	resp := doRequest(t, srv, "GET", "/stats/summary", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/stats/summary: статус %d", resp.StatusCode)
+	}
+	var rep statsReport
+	if err := json.Unmarshal(checkResponse(t, spec, "GET", "/stats/summary", resp), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Total.Orders != len(orders) || rep.Currency != ratesBase {
+		t.Errorf("/stats/summary: заказов %d, валюта %q", rep.Total.Orders, rep.Currency)
+	}
+
+	for group := range statsGroups {
+		resp := doRequest(t, srv, "GET", "/stats/"+group, "", nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("/stats/%s: статус %d", group, resp.StatusCode)
+			continue
+		}
+		checkResponse(t, spec, "GET", "/stats/{group}", resp)
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// === Список заказов: фильтры, сортировка, пагинация ===
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 200
+
+	// maxListDepth — сколько заказов от начала списка можно пролистать
+	// (page*limit). Каждый шард отдаёт все заказы до нужной страницы, так
+	// что глубже — дорого; весь список отдаёт выгрузка /export.
+	maxListDepth = 10000
+)
+
+// sortColumns — допустимые значения параметра sort и соответствующие им
+// выражения SQL. Всё, чего нет в карте, отклоняется.
+var sortColumns = map[string]string{
+	"date_created":     "o.date_created",
+	"customer_id":      "o.customer_id",
+	"delivery_service": "o.delivery_service",
+	"item_count":       "item_count",
+	"amount":           "p.amount",
+	"currency":         "p.currency",
+}
+
+// textSortColumns сравниваются как строки. При слиянии страниц из
+// нескольких шардов они сортируются в БД с COLLATE "C" — побайтно, как
+// strings.Compare, — иначе порядок в шардах и при слиянии мог бы разойтись.
+var textSortColumns = map[string]bool{"customer_id": true, "delivery_service": true, "currency": true}
+
+type orderFilter struct {
+	Query           string
+	CustomerID      string
+	DeliveryService string
+	Currency        string
+	From            time.Time
+	To              time.Time
+	ReportCurrency  string // валюта отчёта для статистики и выгрузки
+	Sort            string
+	Desc            bool
+	Page            int
+	Limit           int
+	Contacts        bool // q ищет и по контактам получателя — только для ролей, которые их видят
+}
+
+type orderSummary struct {
+	OrderUID        string    `json:"order_uid"`
+	TrackNumber     string    `json:"track_number"`
+	DateCreated     time.Time `json:"date_created"`
+	CustomerID      string    `json:"customer_id"`
+	DeliveryService string    `json:"delivery_service"`
+	ItemCount       int       `json:"item_count"`
+	Amount          Money     `json:"amount"`
+	Currency        string    `json:"currency"`
+}
+
+type orderList struct {
+	Orders []orderSummary `json:"orders"`
+	Total  int            `json:"total"`
+	Page   int            `json:"page"`
+	Limit  int            `json:"limit"`
+}
+
+// parseDateParam принимает как дату (2006-01-02), так и RFC 3339.
+func parseDateParam(v string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// parseOrderFilter разбирает параметры списка; ro — роль того, кто
+// спрашивает: по контактам получателя ищут только роли, которым они видны
+// без маски, иначе поиск стал бы способом их подобрать.
+func parseOrderFilter(q url.Values, ro role) (orderFilter, error) {
+	f := orderFilter{
+		Contacts:        ro.seesPII(),
+		Query:           strings.TrimSpace(q.Get("q")),
+		CustomerID:      strings.TrimSpace(q.Get("customer_id")),
+		DeliveryService: strings.TrimSpace(q.Get("delivery_service")),
+		Currency:        strings.ToUpper(strings.TrimSpace(q.Get("currency"))),
+		Sort:            "date_created",
+		Desc:            true,
+		Page:            1,
+		Limit:           defaultPageLimit,
+	}
+
+	rc, err := parseReportCurrency(q.Get("report_currency"))
+	if err != nil {
+		return f, err
+	}
+	f.ReportCurrency = rc
+
+	if v := q.Get("sort"); v != "" {
+		if _, ok := sortColumns[v]; !ok {
+			return f, fmt.Errorf("неизвестное поле сортировки %q", v)
+		}
+		f.Sort = v
+	}
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		f.Desc = false
+	default:
+		return f, errors.New("order должен быть asc или desc")
+	}
+
+	if v := q.Get("date_from"); v != "" {
+		t, err := parseDateParam(v)
+		if err != nil {
+			return f, fmt.Errorf("некорректный date_from: %q", v)
+		}
+		f.From = t
+	}
+	if v := q.Get("date_to"); v != "" {
+		t, err := parseDateParam(v)
+		if err != nil {
+			return f, fmt.Errorf("некорректный date_to: %q", v)
+		}
+		// Дата без времени включает весь день
+		if len(v) == len("2006-01-02") {
+			t = t.AddDate(0, 0, 1)
+		}
+		f.To = t
+	}
+
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return f, fmt.Errorf("некорректный page: %q", v)
+		}
+		f.Page = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return f, fmt.Errorf("limit должен быть от 1 до %d", maxPageLimit)
+		}
+		f.Limit = n
+	}
+	if f.Page*f.Limit > maxListDepth {
+		return f, fmt.Errorf("страница %d слишком далеко: листать можно первые %d заказов, сузьте фильтр или используйте выгрузку", f.Page, maxListDepth)
+	}
+	return f, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// where собирает условие WHERE и аргументы для фильтра.
+func (f orderFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Query != "" && !f.Contacts {
+		add("(o.order_uid ILIKE $%[1]d OR o.track_number ILIKE $%[1]d OR o.customer_id ILIKE $%[1]d)",
+			"%"+likeEscaper.Replace(f.Query)+"%")
+	} else if f.Query != "" {
+		// Поиск подстроки по идентификаторам заказа и контактам получателя.
+		// Зашифрованные контакты ищутся только по точному телефону или email
+		// через слепые индексы (encryption.go).
+		blind := ""
+		if keyring != nil {
+			args = append(args, keyring.phoneIndex(f.Query), keyring.emailIndex(f.Query))
+			blind = fmt.Sprintf(" OR ds.phone_bidx = $%d OR ds.email_bidx = $%d", len(args)-1, len(args))
+		}
+		add(`(o.order_uid ILIKE $%[1]d OR o.track_number ILIKE $%[1]d OR o.customer_id ILIKE $%[1]d
+			OR EXISTS (SELECT 1 FROM deliveries ds WHERE ds.order_uid = o.order_uid
+				AND ((ds.key_version IS NULL AND (ds.name ILIKE $%[1]d OR ds.phone ILIKE $%[1]d OR ds.email ILIKE $%[1]d))`+blind+`)))`,
+			"%"+likeEscaper.Replace(f.Query)+"%")
+	}
+	if f.CustomerID != "" {
+		add("o.customer_id = $%d", f.CustomerID)
+	}
+	if f.DeliveryService != "" {
+		add("o.delivery_service = $%d", f.DeliveryService)
+	}
+	if f.Currency != "" {
+		add("p.currency = $%d", f.Currency)
+	}
+	if !f.From.IsZero() {
+		add("o.date_created >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("o.date_created < $%d", f.To)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// orderBy — ORDER BY для сортировки фильтра; порядок совпадает с
+// compareSortKeys, если collateC (см. textSortColumns). Суммы в разных
+// валютах не сравниваются: sort=amount упорядочивает по сумме внутри
+// валюты, а сами валюты идут по коду, в каком бы направлении ни шла сумма.
+func (f orderFilter) orderBy(collateC bool) string {
+	col, uid, cur := sortColumns[f.Sort], "o.order_uid", sortColumns["currency"]
+	if collateC {
+		uid += ` COLLATE "C"`
+		cur += ` COLLATE "C"`
+		if textSortColumns[f.Sort] {
+			col += ` COLLATE "C"`
+		}
+	}
+	dir := "ASC"
+	if f.Desc {
+		dir = "DESC"
+	}
+	if f.Sort == "amount" {
+		return fmt.Sprintf("%s ASC NULLS LAST, %s %s NULLS LAST, %s", cur, col, dir, uid)
+	}
+	return fmt.Sprintf("%s %s NULLS LAST, %s", col, dir, uid)
+}
+
+// orderSortKey — значения, по которым сортируется список; нужны, чтобы
+// слить уже отсортированные выборки из разных шардов.
+type orderSortKey struct {
+	OrderUID        string
+	DateCreated     time.Time
+	CustomerID      string
+	DeliveryService string
+	Currency        string
+	ItemCount       int
+	Amount          int64
+}
+
+func (s orderSummary) sortKey() orderSortKey {
+	return orderSortKey{s.OrderUID, s.DateCreated, s.CustomerID, s.DeliveryService, s.Currency, s.ItemCount, s.Amount.Minor}
+}
+
+// compareSortKeys сравнивает заказы в порядке сортировки фильтра.
+func (f orderFilter) compareSortKeys(a, b orderSortKey) int {
+	if f.Sort == "amount" {
+		if c := strings.Compare(a.Currency, b.Currency); c != 0 {
+			return c
+		}
+	}
+	var c int
+	switch f.Sort {
+	case "date_created":
+		c = a.DateCreated.Compare(b.DateCreated)
+	case "customer_id":
+		c = strings.Compare(a.CustomerID, b.CustomerID)
+	case "delivery_service":
+		c = strings.Compare(a.DeliveryService, b.DeliveryService)
+	case "currency":
+		c = strings.Compare(a.Currency, b.Currency)
+	case "item_count":
+		c = cmp.Compare(a.ItemCount, b.ItemCount)
+	case "amount":
+		c = cmp.Compare(a.Amount, b.Amount)
+	}
+	if f.Desc {
+		c = -c
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a.OrderUID, b.OrderUID)
+}
+
+// === Загрузка страницы списка из БД ===
+// С одним шардом страница читается из БД как есть. С несколькими каждый
+// шард отдаёт первые page*limit заказов (не больше maxListDepth), а
+// страница вырезается после слияния. Пока rebalance переносит заказ, он
+// есть в двух шардах одинаковыми копиями: такие копии оказываются в
+// слиянии рядом и считаются один раз. Из итога Total вычитаются только
+// копии, попавшие в выборку, — на дальних страницах он может быть больше
+// на число переносимых в этот момент заказов.
+func listOrdersFromDB(f orderFilter) (orderList, error) {
+	list := orderList{Orders: []orderSummary{}, Page: f.Page, Limit: f.Limit}
+	offset := (f.Page - 1) * f.Limit
+	if len(router.shards) == 1 {
+		var err error
+		list.Total, list.Orders, err = listOrdersFrom(db, f, f.Limit, offset, false)
+		return list, err
+	}
+
+	var merged []orderSummary
+	err := eachShard(func(s *shard) error {
+		total, orders, err := listOrdersFrom(s.db, f, offset+f.Limit, 0, true)
+		list.Total += total
+		merged = append(merged, orders...)
+		return err
+	})
+	if err != nil {
+		return list, err
+	}
+	slices.SortFunc(merged, func(a, b orderSummary) int {
+		return f.compareSortKeys(a.sortKey(), b.sortKey())
+	})
+	n := len(merged)
+	merged = slices.CompactFunc(merged, func(a, b orderSummary) bool { return a.OrderUID == b.OrderUID })
+	list.Total -= n - len(merged)
+	if offset < len(merged) {
+		list.Orders = merged[offset:min(offset+f.Limit, len(merged))]
+	}
+	return list, nil
+}
+
+// listOrdersFrom читает из одного шарда число подходящих заказов и
+// limit заказов начиная с offset.
+func listOrdersFrom(sdb *sql.DB, f orderFilter, limit, offset int, collateC bool) (int, []orderSummary, error) {
+	orders := []orderSummary{}
+	where, args := f.where()
+
+	var total int
+	err := sdb.QueryRow(`
+		SELECT COUNT(*)
+		FROM orders o LEFT JOIN payments p ON p.order_uid = o.order_uid
+		`+where, args...).Scan(&total)
+	if err != nil {
+		return 0, orders, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := sdb.Query(fmt.Sprintf(`
+		SELECT o.order_uid, o.track_number, o.date_created, o.customer_id, o.delivery_service,
+			(SELECT COUNT(*) FROM items i WHERE i.order_uid = o.order_uid) AS item_count,
+			COALESCE(p.amount, 0), COALESCE(p.currency, '')
+		FROM orders o LEFT JOIN payments p ON p.order_uid = o.order_uid
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, where, f.orderBy(collateC), len(args)-1, len(args)), args...)
+	if err != nil {
+		return total, orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s orderSummary
+		err := rows.Scan(&s.OrderUID, &s.TrackNumber, &s.DateCreated, &s.CustomerID, &s.DeliveryService,
+			&s.ItemCount, &s.Amount.Minor, &s.Currency)
+		if err != nil {
+			return total, orders, err
+		}
+		s.Amount.Currency = s.Currency
+		orders = append(orders, s)
+	}
+	return total, orders, rows.Err()
+}
+
+// === HTTP: GET /orders ===
+func listOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	f, err := parseOrderFilter(r.URL.Query(), requestRole(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := listOrdersFromDB(f)
+	if err != nil {
+		http.Error(w, "Ошибка чтения списка заказов: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// === Данные для страницы списка ===
+
+// orderListPage — модель шаблона home.html. Методы строят ссылки, сохраняя
+// текущие фильтры в query string.
+type orderListPage struct {
+	orderList
+	Filter    orderFilter
+	Query     url.Values
+	Error     string
+	CanExport bool // ссылки на выгрузку — только для ролей с токеном
+}
+
+func (p orderListPage) link(set map[string]string) string {
+	q := url.Values{}
+	for k, v := range p.Query {
+		q[k] = v
+	}
+	for k, v := range set {
+		if v == "" {
+			q.Del(k)
+		} else {
+			q.Set(k, v)
+		}
+	}
+	if len(q) == 0 {
+		return "/"
+	}
+	return "/?" + q.Encode()
+}
+
+// SortURL переключает направление, если колонка уже выбрана.
+func (p orderListPage) SortURL(col string) string {
+	order := "desc"
+	if p.Filter.Sort == col && p.Filter.Desc {
+		order = "asc"
+	}
+	return p.link(map[string]string{"sort": col, "order": order, "page": ""})
+}
+
+// SortMark возвращает стрелку для активной колонки.
+func (p orderListPage) SortMark(col string) string {
+	if p.Filter.Sort != col {
+		return ""
+	}
+	if p.Filter.Desc {
+		return "▼"
+	}
+	return "▲"
+}
+
+func (p orderListPage) PageURL(n int) string {
+	return p.link(map[string]string{"page": strconv.Itoa(n)})
+}
+
+// ExportURL — выгрузка GET /export с текущими фильтрами и сортировкой.
+func (p orderListPage) ExportURL(format string) string {
+	return "/export" + strings.TrimPrefix(p.link(map[string]string{"format": format, "page": "", "limit": ""}), "/")
+}
+
+// Pages — число страниц, до которых можно дойти (см. maxListDepth).
+func (p orderListPage) Pages() int {
+	if p.Total == 0 {
+		return 1
+	}
+	return min((p.Total+p.Limit-1)/p.Limit, maxListDepth/p.Limit)
+}
+
+func (p orderListPage) HasPrev() bool { return p.Page > 1 }
+func (p orderListPage) HasNext() bool { return p.Page < p.Pages() }
+
+// LiveInsert сообщает странице, можно ли вставлять новые заказы из /events
+// в начало таблицы: только на первой странице без фильтров при сортировке
+// по дате создания от новых к старым.
+func (p orderListPage) LiveInsert() bool {
+	f := p.Filter
+	return f.Page == 1 && f.Sort == "date_created" && f.Desc && f.Query == "" &&
+		f.CustomerID == "" && f.DeliveryService == "" && f.Currency == "" &&
+		f.From.IsZero() && f.To.IsZero()
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// === Transactional outbox: события о заказах для внешних потребителей ===
+// Изменение заказа и запись о нём в таблицу outbox делаются в одной
+// транзакции, а relay публикует записи в NATS Streaming: канал совпадает с
+// типом события (order.saved, order.updated, order.deleted). Доставка — не
+// меньше одного раза: запись помечается опубликованной только после
+// подтверждения NATS, так что после сбоя событие может прийти повторно —
+// потребитель отбрасывает повторы по id. Порядок событий одного заказа
+// сохраняется: записи идут строго по id, а при ошибке публикации relay
+// останавливается на ней и повторяет её, не забегая вперёд.
+//
+// Relay работает на всех экземплярах, но публикует в каждый момент только
+// тот, кто взял advisory lock. При шардировании (shards.go) у каждого шарда
+// свой outbox, а id событий выдаёт общая последовательность основной БД;
+// порядок сохраняется в пределах шарда. Заказ с неопубликованными
+// событиями rebalance в другой шард не переносит (rebalance.go), поэтому
+// события одного заказа тоже идут по порядку.
+
+const (
+	outboxBatch         = 100
+	outboxPollInterval  = time.Second
+	outboxRetryInterval = 5 * time.Second
+	outboxKeep          = 7 * 24 * time.Hour // сколько хранить опубликованные записи
+	outboxLockID        = 0x6f757462         // ключ advisory lock relay («outb»)
+)
+
+const (
+	eventOrderSaved   = "order.saved"
+	eventOrderUpdated = "order.updated"
+	eventOrderDeleted = "order.deleted"
+)
+
+// outboxEvent — сообщение, которое получают потребители.
+type outboxEvent struct {
+	ID              int64           `json:"id"` // растёт вместе с порядком событий; по нему отбрасываются повторы
+	Type            string          `json:"type"`
+	OrderUID        string          `json:"order_uid"`
+	Entry           string          `json:"entry,omitempty"`
+	DeliveryService string          `json:"delivery_service,omitempty"`
+	OccurredAt      time.Time       `json:"occurred_at"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// orderRef — заказ, к которому относится событие. entry и delivery_service
+// сохраняются вместе с событием: по ним фильтруют подписки (webhooks.go),
+// а после удаления заказа взять их будет неоткуда.
+type orderRef struct {
+	OrderUID        string
+	Entry           string
+	DeliveryService string
+}
+
+func refOf(o Order) orderRef {
+	return orderRef{o.OrderUID, o.Entry, o.DeliveryService}
+}
+
+// outboxUpdate — данные события order.updated.
+type outboxUpdate struct {
+	Reason string `json:"reason"` // например customer.erase
+}
+
+// outboxKick будит relay сразу после коммита, не дожидаясь опроса.
+var outboxKick = make(chan struct{}, 1)
+
+// writeOutboxTx добавляет событие в outbox в открытой транзакции.
+func writeOutboxTx(tx *sql.Tx, typ string, ref orderRef, data any) error {
+	id, err := nextOutboxID()
+	if err != nil {
+		return err
+	}
+	var payload sql.NullString // JSONB: строкой, []byte lib/pq передал бы как bytea
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		payload = sql.NullString{String: string(b), Valid: true}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO outbox (id, event_type, order_uid, entry, delivery_service, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)`, id, typ, ref.OrderUID, ref.Entry, ref.DeliveryService, payload)
+	return err
+}
+
+// kickOutbox вызывается после коммита транзакции с событиями.
+func kickOutbox() {
+	for _, ch := range []chan struct{}{outboxKick, webhookKick} {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// startOutboxRelay публикует события из outbox через соединение sc.
+func startOutboxRelay(sc stan.Conn) {
+	poll := time.NewTimer(0)
+	cleanup := time.NewTicker(time.Hour)
+	defer cleanup.Stop()
+	for {
+		select {
+		case <-poll.C:
+		case <-outboxKick:
+			poll.Stop()
+		case <-cleanup.C:
+			// События, которые ещё не разошлись по webhooks, не трогаем
+			err := eachShard(func(s *shard) error {
+				_, err := s.db.Exec(`
+					DELETE FROM outbox
+					WHERE published_at < $1 AND webhooks_at IS NOT NULL`,
+					time.Now().Add(-outboxKeep))
+				return err
+			})
+			if err != nil {
+				log.Printf(" Ошибка очистки outbox: %v", err)
+			}
+			continue
+		}
+
+		next := outboxPollInterval
+		for _, s := range router.shards {
+			for {
+				n, err := relayOutboxBatch(sc, s)
+				if err != nil {
+					log.Printf(" Публикация событий outbox (шард %s): %v", s.name, err)
+					next = outboxRetryInterval
+					break
+				}
+				if n < outboxBatch {
+					break
+				}
+			}
+		}
+		poll.Reset(next)
+	}
+}
+
+// relayOutboxBatch публикует пачку неопубликованных событий шарда по
+// порядку и возвращает, сколько опубликовано.
+func relayOutboxBatch(sc stan.Conn, s *shard) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", outboxLockID).Scan(&locked); err != nil || !locked {
+		return 0, err
+	}
+	rows, err := tx.Query(`
+		SELECT id, event_type, order_uid, entry, delivery_service, created_at, payload
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1`, outboxBatch)
+	if err != nil {
+		return 0, err
+	}
+	var batch []outboxEvent
+	for rows.Next() {
+		var ev outboxEvent
+		var payload []byte
+		if err := rows.Scan(&ev.ID, &ev.Type, &ev.OrderUID, &ev.Entry, &ev.DeliveryService, &ev.OccurredAt, &payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ev.Data = payload
+		batch = append(batch, ev)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	var pubErr error
+	for _, ev := range batch {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return 0, err
+		}
+		if pubErr = sc.Publish(ev.Type, data); pubErr != nil {
+			_, err = tx.Exec("UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1", ev.ID, pubErr.Error())
+			if err != nil {
+				return 0, err
+			}
+			break
+		}
+		if _, err := tx.Exec("UPDATE outbox SET published_at = now(), attempts = attempts + 1 WHERE id = $1", ev.ID); err != nil {
+			return 0, err
+		}
+		published++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return published, pubErr
+}
+
+// === HTTP: GET /admin/outbox (только для админа) ===
+
+type outboxStats struct {
+	Pending       int        `json:"pending"`
+	OldestPending *time.Time `json:"oldest_pending,omitempty"`
+	LastError     string     `json:"last_error,omitempty"` // ошибка публикации самого старого события
+	Published24h  int        `json:"published_24h"`
+}
+
+func outboxStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var s outboxStats
+	var oldestID int64
+	err := eachShard(func(sh *shard) error {
+		var pending, published int
+		var oldest sql.NullTime
+		var id sql.NullInt64
+		var lastError sql.NullString
+		err := sh.db.QueryRow(`
+			SELECT
+				COUNT(*) FILTER (WHERE published_at IS NULL),
+				MIN(created_at) FILTER (WHERE published_at IS NULL),
+				COUNT(*) FILTER (WHERE published_at > now() - interval '24 hours'),
+				(SELECT id FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT 1),
+				(SELECT last_error FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT 1)
+			FROM outbox`).Scan(&pending, &oldest, &published, &id, &lastError)
+		if err != nil {
+			return err
+		}
+		s.Pending += pending
+		s.Published24h += published
+		if oldest.Valid && (s.OldestPending == nil || oldest.Time.Before(*s.OldestPending)) {
+			s.OldestPending = &oldest.Time
+		}
+		// Ошибка самого старого события — среди первых событий шардов
+		if id.Valid && (oldestID == 0 || id.Int64 < oldestID) {
+			oldestID = id.Int64
+			s.LastError = lastError.String
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
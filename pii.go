@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// === Маскирование персональных данных ===
+// Контакты получателя отдаются целиком только ролям, для которых
+// role.seesPII(); остальным — по правилам piiRules. Заказ маскируется при
+// выдаче (JSON, gRPC, выгрузка), в кэше данные хранятся как есть (в БД —
+// зашифрованными, см. encryption.go).
+//
+// Правила задаются переменной PII_MASK: «поле=правило» через запятую,
+// например PII_MASK=name=partial,address=hide. Поля — name, phone, email,
+// address, zip; правила:
+//
+//	none    — без маски
+//	partial — частично: телефон — последние 4 цифры, email — первая буква
+//	          и домен, имя — имя и инициалы, адрес — без номеров, индекс —
+//	          первые 3 цифры
+//	hide    — скрыть целиком
+
+type maskRule string
+
+const (
+	maskNone    maskRule = "none"
+	maskPartial maskRule = "partial"
+	maskHide    maskRule = "hide"
+)
+
+const hiddenValue = "***"
+
+// piiField — маскируемое поле доставки и его частичная маска.
+type piiField struct {
+	name    string
+	field   func(d *Delivery) *string
+	partial func(s string) string
+}
+
+var piiFields = []piiField{
+	{"name", func(d *Delivery) *string { return &d.Name }, maskName},
+	{"phone", func(d *Delivery) *string { return &d.Phone }, maskPhone},
+	{"email", func(d *Delivery) *string { return &d.Email }, maskEmail},
+	{"address", func(d *Delivery) *string { return &d.Address }, maskAddress},
+	{"zip", func(d *Delivery) *string { return &d.Zip }, maskZip},
+}
+
+// piiRules — действующие правила; по умолчанию скрыты телефон, email и
+// номера в адресе.
+var piiRules = map[string]maskRule{
+	"name":    maskNone,
+	"phone":   maskPartial,
+	"email":   maskPartial,
+	"address": maskPartial,
+	"zip":     maskNone,
+}
+
+// parsePIIRules разбирает PII_MASK поверх правил по умолчанию.
+func parsePIIRules(spec string) (map[string]maskRule, error) {
+	rules := make(map[string]maskRule, len(piiRules))
+	for k, v := range piiRules {
+		rules[k] = v
+	}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, rule, ok := strings.Cut(part, "=")
+		name, rule = strings.TrimSpace(name), strings.TrimSpace(rule)
+		if _, known := rules[name]; !ok || !known {
+			return nil, fmt.Errorf("%q: нужно поле=правило, поля: name, phone, email, address, zip", part)
+		}
+		switch r := maskRule(rule); r {
+		case maskNone, maskPartial, maskHide:
+			rules[name] = r
+		default:
+			return nil, fmt.Errorf("%q: правило должно быть none, partial или hide", part)
+		}
+	}
+	return rules, nil
+}
+
+// maskDelivery возвращает копию доставки с замаскированными полями.
+func maskDelivery(d Delivery) Delivery {
+	for _, f := range piiFields {
+		p := f.field(&d)
+		if *p == "" {
+			continue
+		}
+		switch piiRules[f.name] {
+		case maskPartial:
+			*p = f.partial(*p)
+		case maskHide:
+			*p = hiddenValue
+		}
+	}
+	return d
+}
+
+// orderFor возвращает заказ в том виде, в каком его видит роль. Заказ из
+// кэша не меняется: Delivery копируется по значению.
+func orderFor(o Order, ro role) Order {
+	if !ro.seesPII() {
+		o.Delivery = maskDelivery(o.Delivery)
+	}
+	return o
+}
+
+// maskPhone: +79001234567 → +7******4567.
+func maskPhone(s string) string {
+	digits := 0
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	var b strings.Builder
+	seen := 0
+	for i, r := range s {
+		if !unicode.IsDigit(r) {
+			b.WriteRune(r)
+			continue
+		}
+		seen++
+		// Код страны после «+» и последние 4 цифры видны
+		keep := seen > digits-4 || (seen == 1 && strings.HasPrefix(s[:i], "+"))
+		if keep && digits > 6 {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('*')
+		}
+	}
+	return b.String()
+}
+
+// maskEmail: ivan.petrov@mail.ru → i***@mail.ru.
+func maskEmail(s string) string {
+	at := strings.LastIndexByte(s, '@')
+	if at <= 0 {
+		return hiddenValue
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	return string(first) + hiddenValue + s[at:]
+}
+
+// maskName: Иван Петров → Иван П.
+func maskName(s string) string {
+	words := strings.Fields(s)
+	for i := 1; i < len(words); i++ {
+		first, _ := utf8.DecodeRuneInString(words[i])
+		words[i] = string(first) + "."
+	}
+	return strings.Join(words, " ")
+}
+
+// maskAddress прячет номера дома, корпуса и квартиры: ул. Ленина, д. *, кв. **.
+func maskAddress(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return '*'
+		}
+		return r
+	}, s)
+}
+
+// maskZip: 101000 → 101***.
+func maskZip(s string) string {
+	if len(s) <= 3 {
+		return hiddenValue
+	}
+	return s[:3] + strings.Repeat("*", len(s)-3)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var allRoles = []role{roleAnonymous, roleSupport, roleManager, roleAdmin}
+
+func TestRoles(t *testing.T) {
+	cases := map[role]struct{ pii, staff bool }{
+		roleAnonymous: {false, false},
+		roleSupport:   {false, true},
+		roleManager:   {true, true},
+		roleAdmin:     {true, true},
+	}
+	for _, ro := range allRoles {
+		want := cases[ro]
+		if ro.seesPII() != want.pii || ro.isStaff() != want.staff {
+			t.Errorf("%s: seesPII %v, isStaff %v", ro, ro.seesPII(), ro.isStaff())
+		}
+	}
+
+	tokens := map[string]role{
+		testAdminToken: roleAdmin, testManagerToken: roleManager, testSupportToken: roleSupport,
+		"": roleAnonymous, "wrong": roleAnonymous, testAdminToken + "x": roleAnonymous,
+	}
+	for token, want := range tokens {
+		if got := tokenRole(token); got != want {
+			t.Errorf("токен %q: роль %s, ожидалась %s", token, got, want)
+		}
+	}
+}
+
+// usePIIRules задаёт PII_MASK на время теста.
+func usePIIRules(t *testing.T, spec string) {
+	t.Helper()
+	rules, err := parsePIIRules(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := piiRules
+	piiRules = rules
+	t.Cleanup(func() { piiRules = prev })
+}
+
+func TestOrderFor(t *testing.T) {
+	order := loadFixture(t, "basic")
+	orig := order.Delivery
+	masked := Delivery{
+		Name:    "Иван Иванов",
+		Phone:   "+7 (***) ***-45-67",
+		Zip:     "125009",
+		City:    "Москва",
+		Address: "ул. Тверская, д. **",
+		Region:  "Москва",
+		Email:   "i***@example.com",
+	}
+	hidden := Delivery{
+		Name:    "Иван И.",
+		Phone:   hiddenValue,
+		Zip:     "125***",
+		City:    "Москва",
+		Address: hiddenValue,
+		Region:  "Москва",
+		Email:   "ivan@example.com",
+	}
+
+	cases := []struct {
+		spec string
+		want Delivery // для ролей без доступа к контактам
+	}{
+		{"", masked},
+		{"name=partial,phone=hide,email=none,address=hide,zip=partial", hidden},
+	}
+	for _, c := range cases {
+		usePIIRules(t, c.spec)
+		for _, ro := range allRoles {
+			want := c.want
+			if ro.seesPII() {
+				want = orig
+			}
+			got := orderFor(order, ro)
+			if got.Delivery != want {
+				t.Errorf("PII_MASK=%q, %s:\n получено  %+v\n ожидалось %+v", c.spec, ro, got.Delivery, want)
+			}
+			if got.OrderUID != order.OrderUID || got.Payment != order.Payment || len(got.Items) != len(order.Items) {
+				t.Errorf("PII_MASK=%q, %s: изменено не только Delivery", c.spec, ro)
+			}
+		}
+	}
+	if order.Delivery != orig {
+		t.Errorf("исходный заказ изменён: %+v", order.Delivery)
+	}
+}
+
+func TestMaskFields(t *testing.T) {
+	cases := []struct {
+		mask     func(string) string
+		in, want string
+	}{
+		{maskPhone, "+79001234567", "+7******4567"},
+		{maskPhone, "89001234567", "*******4567"},
+		{maskPhone, "12345", "*****"}, // слишком короткий — скрыт целиком
+		{maskEmail, "ivan.petrov@mail.ru", "i***@mail.ru"},
+		{maskEmail, "Юлия@почта.рф", "Ю***@почта.рф"},
+		{maskEmail, "не email", hiddenValue},
+		{maskName, "Иван Петров", "Иван П."},
+		{maskName, "Анна Мария Сергеевна", "Анна М. С."},
+		{maskName, "Иван", "Иван"},
+		{maskAddress, "ул. Ленина, д. 5, кв. 12", "ул. Ленина, д. *, кв. **"},
+		{maskZip, "101000", "101***"},
+		{maskZip, "101", hiddenValue},
+	}
+	for _, c := range cases {
+		if got := c.mask(c.in); got != c.want {
+			t.Errorf("%q: %q, ожидалось %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParsePIIRules(t *testing.T) {
+	rules, err := parsePIIRules(" zip = hide ,, name=partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules["zip"] != maskHide || rules["name"] != maskPartial || rules["phone"] != piiRules["phone"] {
+		t.Errorf("правила %v", rules)
+	}
+	for _, spec := range []string{"city=hide", "phone", "phone=blur", "=hide"} {
+		if _, err := parsePIIRules(spec); err == nil {
+			t.Errorf("PII_MASK=%q принят", spec)
+		}
+	}
+}
+
+// TestSearchContactsByRole: по контактам ищут только роли, которые видят их
+// без маски; остальным поиск идёт лишь по идентификаторам заказа.
+func TestSearchContactsByRole(t *testing.T) {
+	for _, ro := range allRoles {
+		f, err := parseOrderFilter(url.Values{"q": {"ivan@example.com"}}, ro)
+		if err != nil {
+			t.Fatal(err)
+		}
+		where, args := f.where()
+		if f.Contacts != ro.seesPII() || strings.Contains(where, "deliveries") != ro.seesPII() {
+			t.Errorf("%s: контакты %v, условие %s", ro, f.Contacts, where)
+		}
+		if len(args) != 1 {
+			t.Errorf("%s: аргументы %v", ro, args)
+		}
+	}
+
+	// Слепые индексы тоже только для них
+	useKeyring(t, 1)
+	for _, ro := range allRoles {
+		f, _ := parseOrderFilter(url.Values{"q": {"+7 999 123-45-67"}}, ro)
+		where, args := f.where()
+		if strings.Contains(where, "phone_bidx") != ro.seesPII() || (len(args) == 3) != ro.seesPII() {
+			t.Errorf("%s: условие %s, аргументы %v", ro, where, args)
+		}
+	}
+}
+
+func TestSearchContactsByRoleDB(t *testing.T) {
+	needDB(t)
+	orders := saveFixtures(t, "basic", "clothes")
+	o := orders[0]
+	srv := newTestServer(t)
+	tokens := map[role]string{
+		roleAnonymous: "", roleSupport: testSupportToken, roleManager: testManagerToken, roleAdmin: testAdminToken,
+	}
+
+	queries := []string{o.Delivery.Email, o.Delivery.Phone, o.Delivery.Name}
+	for _, ro := range allRoles {
+		for _, q := range queries {
+			resp := doRequest(t, srv, "GET", "/orders?q="+url.QueryEscape(q), tokens[ro], nil)
+			var list orderList
+			if err := json.Unmarshal(readBody(t, resp), &list); err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if ro.seesPII() {
+				want = 1
+			}
+			if list.Total != want {
+				t.Errorf("%s, q=%q: найдено %d, ожидалось %d", ro, q, list.Total, want)
+			}
+		}
+		// По трек-номеру ищут все
+		resp := doRequest(t, srv, "GET", "/orders?q="+url.QueryEscape(o.TrackNumber), tokens[ro], nil)
+		var list orderList
+		if err := json.Unmarshal(readBody(t, resp), &list); err != nil {
+			t.Fatal(err)
+		}
+		if list.Total != 1 {
+			t.Errorf("%s: по трек-номеру найдено %d", ro, list.Total)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+
+	"order-service-demo/model"
+)
+
+// === Курсы валют ===
+// Курсы ЦБ РФ: сколько рублей стоят nominal единиц валюты на дату. Ими
+// суммы заказов пересчитываются в валюту отчёта (параметр report_currency
+// у статистики и выгрузки) по курсу на дату оплаты. ЦБ не устанавливает
+// курс на выходные и праздники, поэтому берётся последний курс не старше
+// maxRateAgeDays дней.
+
+const (
+	ratesBase      = "RUB"
+	maxRateAgeDays = 14
+	maxRatesBody   = 32 << 20
+)
+
+type exchangeRate struct {
+	Date     string      `json:"date"` // YYYY-MM-DD
+	Currency string      `json:"currency"`
+	Nominal  int         `json:"nominal"`
+	Value    json.Number `json:"value"` // рублей за nominal единиц валюты
+}
+
+type ratesLoadReport struct {
+	Loaded     int      `json:"loaded"`
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Currencies []string `json:"currencies"`
+	Skipped    []string `json:"skipped,omitempty"` // валюты вне справочника ISO 4217 (например, XDR у ЦБ)
+}
+
+type rateList struct {
+	Date  string         `json:"date"`
+	Base  string         `json:"base"`
+	Rates []exchangeRate `json:"rates"`
+}
+
+// === Разбор файлов ===
+
+// errUnknownCurrency — кода нет в справочнике model: заказов в такой валюте
+// быть не может, поэтому курс пропускается, а не валит весь файл. У ЦБ так
+// каждый день приходит XDR (СДР).
+var errUnknownCurrency = errors.New("неизвестная валюта")
+
+// ratesFile — разобранный файл курсов; Skipped — пропущенные коды валют.
+type ratesFile struct {
+	Rates   []exchangeRate
+	Skipped []string
+}
+
+func (f *ratesFile) add(r exchangeRate, err error) error {
+	if errors.Is(err, errUnknownCurrency) {
+		if !slices.Contains(f.Skipped, r.Currency) {
+			f.Skipped = append(f.Skipped, r.Currency)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f.Rates = append(f.Rates, r)
+	return nil
+}
+
+// parseRates понимает ежедневный XML ЦБ (XML_daily.asp) и CSV с колонками
+// date, currency, nominal (необязательна), value.
+func parseRates(data []byte) (ratesFile, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '<' {
+		return parseCBRXML(data)
+	}
+	return parseRatesCSV(data)
+}
+
+// parseCBRXML разбирает ответ www.cbr.ru/scripts/XML_daily.asp. Файл ЦБ
+// в windows-1251, кодировку берём из заголовка XML.
+func parseCBRXML(data []byte) (ratesFile, error) {
+	var doc struct {
+		Date    string `xml:"Date,attr"`
+		Valutes []struct {
+			CharCode string `xml:"CharCode"`
+			Nominal  string `xml:"Nominal"`
+			Value    string `xml:"Value"`
+		} `xml:"Valute"`
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charset.NewReaderLabel
+	if err := dec.Decode(&doc); err != nil {
+		return ratesFile{}, fmt.Errorf("XML ЦБ: %w", err)
+	}
+	date, err := parseRateDate(doc.Date)
+	if err != nil {
+		return ratesFile{}, fmt.Errorf("XML ЦБ: атрибут Date: %w", err)
+	}
+
+	var f ratesFile
+	for _, v := range doc.Valutes {
+		if err := f.add(newExchangeRate(date, v.CharCode, v.Nominal, v.Value)); err != nil {
+			return ratesFile{}, fmt.Errorf("XML ЦБ, %s: %w", v.CharCode, err)
+		}
+	}
+	return f, nil
+}
+
+// parseRatesCSV разбирает CSV с заголовком. Разделитель — запятая или точка
+// с запятой, дробная часть курса — через точку или запятую.
+func parseRatesCSV(data []byte) (ratesFile, error) {
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	cr := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		cr.Comma = ';'
+	}
+	cr.TrimLeadingSpace = true
+
+	head, err := cr.Read()
+	if err != nil {
+		return ratesFile{}, fmt.Errorf("CSV: заголовок: %w", err)
+	}
+	col := map[string]int{}
+	for i, name := range head {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "currency", "value"} {
+		if _, ok := col[name]; !ok {
+			return ratesFile{}, fmt.Errorf("CSV: нет колонки %s (нужны date, currency, value и, если курс не за единицу, nominal)", name)
+		}
+	}
+
+	var f ratesFile
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return f, nil
+		}
+		if err != nil {
+			return ratesFile{}, fmt.Errorf("CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		date, err := parseRateDate(field("date"))
+		if err != nil {
+			return ratesFile{}, fmt.Errorf("CSV, строка %d: %w", line, err)
+		}
+		nominal := field("nominal")
+		if nominal == "" {
+			nominal = "1"
+		}
+		if err := f.add(newExchangeRate(date, field("currency"), nominal, field("value"))); err != nil {
+			return ratesFile{}, fmt.Errorf("CSV, строка %d: %w", line, err)
+		}
+	}
+}
+
+// parseRateDate принимает 2006-01-02 и формат ЦБ 02.01.2006.
+func parseRateDate(s string) (string, error) {
+	for _, layout := range []string{"2006-01-02", "02.01.2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("некорректная дата %q", s)
+}
+
+// newExchangeRate проверяет курс из файла. Для кода вне справочника
+// возвращает errUnknownCurrency и курс с одним только Currency.
+func newExchangeRate(date, code, nominal, value string) (exchangeRate, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == ratesBase {
+		return exchangeRate{}, fmt.Errorf("курс %s к самому себе", code)
+	}
+	if _, ok := model.LookupCurrency(code); !ok {
+		return exchangeRate{Currency: code}, fmt.Errorf("%w %q", errUnknownCurrency, code)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(nominal))
+	if err != nil || n < 1 {
+		return exchangeRate{}, fmt.Errorf("некорректный номинал %q", nominal)
+	}
+	v := strings.Replace(strings.TrimSpace(value), ",", ".", 1)
+	if f, err := strconv.ParseFloat(v, 64); err != nil || f <= 0 || strings.ContainsAny(v, "eE+-") {
+		return exchangeRate{}, fmt.Errorf("некорректный курс %q", value)
+	}
+	return exchangeRate{Date: date, Currency: code, Nominal: n, Value: json.Number(v)}, nil
+}
+
+// === Курсы в БД ===
+
+// saveRates записывает курсы одной транзакцией; курс на ту же дату
+// заменяется. Курсы нужны в каждом шарде: пересчёт идёт в SQL рядом с
+// заказами (shards.go).
+func saveRates(rates []exchangeRate) error {
+	return eachShard(func(s *shard) error {
+		return saveRatesTo(s.db, rates)
+	})
+}
+
+func saveRatesTo(sdb *sql.DB, rates []exchangeRate) error {
+	tx, err := sdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO exchange_rates (rate_date, currency, nominal, value) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (currency, rate_date) DO UPDATE SET nominal = EXCLUDED.nominal, value = EXCLUDED.value`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range rates {
+		if _, err := stmt.Exec(r.Date, r.Currency, r.Nominal, string(r.Value)); err != nil {
+			return fmt.Errorf("%s на %s: %w", r.Currency, r.Date, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// copyRates переносит в новый шард все курсы основной БД.
+func copyRates(s *shard) error {
+	rows, err := db.Query(`
+		SELECT to_char(rate_date, 'YYYY-MM-DD'), currency, nominal, value::text FROM exchange_rates`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var rates []exchangeRate
+	for rows.Next() {
+		var r exchangeRate
+		var value string
+		if err := rows.Scan(&r.Date, &r.Currency, &r.Nominal, &value); err != nil {
+			return err
+		}
+		r.Value = json.Number(value)
+		rates = append(rates, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return saveRatesTo(s.db, rates)
+}
+
+// ratesOn возвращает курсы, действующие на дату: по каждой валюте последний
+// установленный не позже неё.
+func ratesOn(date string) ([]exchangeRate, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (currency) to_char(rate_date, 'YYYY-MM-DD'), currency, nominal, value::text
+		FROM exchange_rates
+		WHERE rate_date <= $1 AND rate_date > $1::date - $2::int
+		ORDER BY currency, rate_date DESC`, date, maxRateAgeDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []exchangeRate{}
+	for rows.Next() {
+		var r exchangeRate
+		var value string
+		if err := rows.Scan(&r.Date, &r.Currency, &r.Nominal, &value); err != nil {
+			return nil, err
+		}
+		r.Value = json.Number(value)
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// === Пересчёт в SQL ===
+
+// paymentDateSQL — дата оплаты заказа по московскому времени: на неё ЦБ
+// устанавливает курс.
+const paymentDateSQL = `(to_timestamp(p.payment_dt) AT TIME ZONE 'Europe/Moscow')::date`
+
+// rubRateSQL — рублей за единицу валюты cur на дату оплаты; NULL, если
+// курса нет.
+func rubRateSQL(cur string) string {
+	return fmt.Sprintf(`CASE WHEN %[1]s = '%[2]s' THEN 1 ELSE (
+			SELECT r.value / r.nominal FROM exchange_rates r
+			WHERE r.currency = %[1]s AND r.rate_date <= %[3]s AND r.rate_date > %[3]s - %[4]d
+			ORDER BY r.rate_date DESC LIMIT 1) END`, cur, ratesBase, paymentDateSQL, maxRateAgeDays)
+}
+
+// fxJoinSQL добавляет к запросу по orders o и payments p колонку fx.rate —
+// курс пересчёта валюты оплаты в валюту отчёта to. Код to проверен по
+// справочнику ISO 4217, поэтому подставляется в текст запроса.
+func fxJoinSQL(to string) string {
+	return fmt.Sprintf(`LEFT JOIN LATERAL (SELECT %s / %s AS rate) fx ON true`,
+		rubRateSQL("p.currency"), rubRateSQL("'"+to+"'"))
+}
+
+// parseReportCurrency проверяет параметр report_currency.
+func parseReportCurrency(v string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(v))
+	if code == "" {
+		return "", nil
+	}
+	if _, ok := model.LookupCurrency(code); !ok {
+		return "", fmt.Errorf("неизвестная валюта отчёта %q (нужен код ISO 4217)", v)
+	}
+	return code, nil
+}
+
+// parseRate разбирает курс из колонки fx.rate; nil — курса нет.
+func parseRate(s string) *big.Rat {
+	if s == "" {
+		return nil
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+// === HTTP: POST /admin/rates (только для админа) ===
+// Тело — XML ЦБ или CSV; формат определяется по содержимому.
+func loadRatesHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRatesBody))
+	if err != nil {
+		http.Error(w, "Слишком большой или оборванный запрос: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	file, err := parseRates(data)
+	if err == nil && len(file.Rates) == 0 {
+		err = errors.New("в файле нет курсов")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rates := file.Rates
+	if err := saveRates(rates); err != nil {
+		http.Error(w, "Ошибка сохранения курсов: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rep := ratesLoadReport{Loaded: len(rates), From: rates[0].Date, To: rates[0].Date, Skipped: file.Skipped}
+	for _, rate := range rates {
+		rep.From = min(rep.From, rate.Date)
+		rep.To = max(rep.To, rate.Date)
+		if !slices.Contains(rep.Currencies, rate.Currency) {
+			rep.Currencies = append(rep.Currencies, rate.Currency)
+		}
+	}
+	slices.Sort(rep.Currencies)
+	log.Printf(" Загружено курсов: %d за %s — %s", rep.Loaded, rep.From, rep.To)
+	if len(rep.Skipped) > 0 {
+		log.Printf(" Пропущены курсы валют вне справочника: %s", strings.Join(rep.Skipped, ", "))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
+
+// === HTTP: GET /rates?date=YYYY-MM-DD ===
+func ratesHandler(w http.ResponseWriter, r *http.Request) {
+	date := time.Now().Format("2006-01-02")
+	if v := r.URL.Query().Get("date"); v != "" {
+		d, err := parseRateDate(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		date = d
+	}
+
+	rates, err := ratesOn(date)
+	if err != nil {
+		http.Error(w, "Ошибка чтения курсов: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rateList{Date: date, Base: ratesBase, Rates: rates})
+}
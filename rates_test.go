@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testdata/cbr_XML_daily.xml — ответ XML_daily.asp в том виде, в каком его
+// отдаёт ЦБ: windows-1251, дробная часть через запятую, номинал 100 у
+// иены, тенге, форинта и драма, СДР (XDR) среди валют.
+
+func readCBRSample(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/cbr_XML_daily.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseCBRXML(t *testing.T) {
+	file, err := parseRates(readCBRSample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Rates) != 10 || !slices.Equal(file.Skipped, []string{"XDR"}) {
+		t.Fatalf("курсов %d, пропущены %v", len(file.Rates), file.Skipped)
+	}
+	want := map[string]exchangeRate{
+		"USD": {Date: "2024-03-02", Currency: "USD", Nominal: 1, Value: "91.1883"},
+		"JPY": {Date: "2024-03-02", Currency: "JPY", Nominal: 100, Value: "60.6898"},
+		"AMD": {Date: "2024-03-02", Currency: "AMD", Nominal: 100, Value: "22.5574"},
+	}
+	for _, r := range file.Rates {
+		if w, ok := want[r.Currency]; ok && r != w {
+			t.Errorf("%s: %+v, ожидалось %+v", r.Currency, r, w)
+		}
+		delete(want, r.Currency)
+	}
+	if len(want) > 0 {
+		t.Errorf("нет курсов %v", want)
+	}
+}
+
+func TestParseCBRXMLErrors(t *testing.T) {
+	cases := map[string]string{
+		"нет даты":        `<ValCurs><Valute><CharCode>USD</CharCode><Nominal>1</Nominal><Value>91,1883</Value></Valute></ValCurs>`,
+		"нулевой номинал": `<ValCurs Date="02.03.2024"><Valute><CharCode>USD</CharCode><Nominal>0</Nominal><Value>91,1883</Value></Valute></ValCurs>`,
+		"курс не число":   `<ValCurs Date="02.03.2024"><Valute><CharCode>USD</CharCode><Nominal>1</Nominal><Value>91,18,83</Value></Valute></ValCurs>`,
+		"курс рубля":      `<ValCurs Date="02.03.2024"><Valute><CharCode>RUB</CharCode><Nominal>1</Nominal><Value>1</Value></Valute></ValCurs>`,
+		"обрыв":           `<ValCurs Date="02.03.2024"><Valute>`,
+	}
+	for name, doc := range cases {
+		if _, err := parseRates([]byte(doc)); err == nil {
+			t.Errorf("%s: ошибки нет", name)
+		}
+	}
+}
+
+func TestParseRatesCSV(t *testing.T) {
+	cases := map[string]string{
+		"точка с запятой, запятая в курсе": "\ufeffdate;currency;nominal;value\n" +
+			"02.03.2024;USD;1;91,1883\n2024-03-02;jpy;100;60,6898\n02.03.2024;XDR;1;121,2136\n",
+		"запятая, точка в курсе, без номинала": "Date, Currency, Value\n" +
+			"2024-03-02, USD, 91.1883\n2024-03-02, JPY, 0.606898\n2024-03-02, XDR, 121.2136\n",
+	}
+	for name, data := range cases {
+		file, err := parseRates([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(file.Rates) != 2 || !slices.Equal(file.Skipped, []string{"XDR"}) {
+			t.Errorf("%s: курсы %+v, пропущены %v", name, file.Rates, file.Skipped)
+			continue
+		}
+		usd, jpy := file.Rates[0], file.Rates[1]
+		if usd != (exchangeRate{Date: "2024-03-02", Currency: "USD", Nominal: 1, Value: "91.1883"}) {
+			t.Errorf("%s: USD %+v", name, usd)
+		}
+		if jpy.Currency != "JPY" || jpy.Date != "2024-03-02" {
+			t.Errorf("%s: JPY %+v", name, jpy)
+		}
+	}
+
+	_, err := parseRates([]byte("date;currency;value\n02.03.2024;USD;91,1883\n02.03.2024;EUR;-1\n"))
+	if err == nil || !strings.Contains(err.Error(), "строка 3") {
+		t.Errorf("отрицательный курс: %v", err)
+	}
+	if _, err := parseRates([]byte("date;code;value\n02.03.2024;USD;91,1883\n")); err == nil {
+		t.Error("файл без колонки currency разобран")
+	}
+}
+
+func TestLoadRatesHandler(t *testing.T) {
+	needDB(t)
+	srv := newTestServer(t)
+	resp := doRequest(t, srv, "POST", "/admin/rates", testAdminToken, bytes.NewReader(readCBRSample(t)))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("статус %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var rep ratesLoadReport
+	if err := json.Unmarshal(checkResponse(t, testSpec(t), "POST", "/admin/rates", resp), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Loaded != 10 || rep.From != "2024-03-02" || !slices.Equal(rep.Skipped, []string{"XDR"}) {
+		t.Errorf("отчёт %+v", rep)
+	}
+
+	rates, err := ratesOn("2024-03-04")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 10 {
+		t.Errorf("на понедельник действует %d курсов", len(rates))
+	}
+}
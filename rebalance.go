@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// === Перенос заказов между шардами ===
+// После смены карты шардов (shards.go) заказы, записанные по старой карте,
+// лежат не там, где их будут искать новые правила. Чтение от этого не
+// ломается — заказ ищется во всех шардах, — но новая запись и прежняя
+// копия разъехались бы. POST /admin/shards/rebalance переносит такие
+// заказы, в том числе из архива.
+//
+// Заказ переносится так: в исходном шарде строки заказа блокируются, заказ
+// записывается в целевой шард с новой версией (остальные экземпляры
+// перечитают его по NOTIFY) и только после коммита там удаляется из
+// исходного — без уведомления об удалении, ведь заказ не исчез. Сбой между
+// коммитами оставляет две одинаковые копии; повторный запуск увидит копию
+// в целевом шарде и просто удалит исходную. Rebalance выполняет только
+// один экземпляр за раз (advisory lock в основной БД).
+//
+// События outbox публикуются по порядку только в пределах шарда, поэтому
+// заказ с неопубликованными событиями (в NATS или webhooks) не переносится:
+// иначе его новые события из целевого шарда могли бы обогнать старые. Такой
+// заказ попадает в Failed, и его перенесёт следующий запуск.
+
+const (
+	rebalanceBatch  = 500
+	rebalanceLockID = 0x72626c6e // ключ advisory lock переноса («rbln»)
+)
+
+type shardInfo struct {
+	Name      string `json:"name"`
+	Orders    int    `json:"orders"`
+	Archived  int    `json:"archived"`
+	Misplaced int    `json:"misplaced"` // заказы и архив, которым по карте место в другом шарде
+}
+
+type rebalanceReport struct {
+	Moved         int      `json:"moved"`
+	MovedArchived int      `json:"moved_archived"`
+	Failed        []string `json:"failed"` // order_uid заказов, которые перенести не удалось
+	DurationMs    int64    `json:"duration_ms"`
+}
+
+// shardStatus считает заказы в шардах и сколько из них не на своём месте.
+// Архив, записанный до появления колонок shardkey и oof_shard, в Misplaced
+// не попадает: его шард по самому заказу проверит rebalance.
+func shardStatus() ([]shardInfo, error) {
+	infos := make([]shardInfo, 0, len(router.shards))
+	err := eachShard(func(s *shard) error {
+		info := shardInfo{Name: s.name}
+		for _, table := range []string{"orders", "archived_orders"} {
+			rows, err := s.db.Query(`
+				SELECT shardkey IS NULL, COALESCE(shardkey, ''), COALESCE(oof_shard, ''), COUNT(*)
+				FROM ` + table + ` GROUP BY 1, 2, 3`)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var unknown bool
+				var shardkey, oofShard string
+				var n int
+				if err := rows.Scan(&unknown, &shardkey, &oofShard, &n); err != nil {
+					rows.Close()
+					return err
+				}
+				if table == "orders" {
+					info.Orders += n
+				} else {
+					info.Archived += n
+				}
+				if !unknown && router.route(shardkey, oofShard) != s {
+					info.Misplaced += n
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+		infos = append(infos, info)
+		return nil
+	})
+	return infos, err
+}
+
+var (
+	// errRebalanceBusy — перенос уже выполняет другой экземпляр.
+	errRebalanceBusy = errors.New("перенос заказов уже выполняется")
+	// errOutboxPending — у заказа есть неопубликованные события outbox.
+	errOutboxPending = errors.New("у заказа есть неопубликованные события, перенос отложен")
+)
+
+// outboxPendingTx сообщает, что у заказа в шарде транзакции tx есть
+// события, которые relay или рассылка webhooks ещё не обработали.
+func outboxPendingTx(tx *sql.Tx, uid string) (bool, error) {
+	var pending bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM outbox
+			WHERE order_uid = $1 AND (published_at IS NULL OR webhooks_at IS NULL))`, uid).Scan(&pending)
+	return pending, err
+}
+
+// rebalanceShards переносит все заказы, которые лежат не в своём шарде.
+func rebalanceShards(ctx context.Context) (rep rebalanceReport, err error) {
+	rep.Failed = []string{}
+	start := time.Now()
+	defer func() { rep.DurationMs = time.Since(start).Milliseconds() }()
+
+	// Блокировка сессии держится на отдельном соединении до конца переноса
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return rep, err
+	}
+	defer conn.Close()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", rebalanceLockID).Scan(&locked); err != nil {
+		return rep, err
+	}
+	if !locked {
+		return rep, errRebalanceBusy
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", rebalanceLockID)
+
+	err = eachShard(func(s *shard) error {
+		if err := rebalanceOrders(s, &rep); err != nil {
+			return err
+		}
+		return rebalanceArchive(s, &rep)
+	})
+	return rep, err
+}
+
+// rebalanceOrders переносит заказы шарда src, которым место в другом.
+func rebalanceOrders(src *shard, rep *rebalanceReport) error {
+	after := ""
+	for {
+		rows, err := src.db.Query(`
+			SELECT order_uid, COALESCE(shardkey, ''), COALESCE(oof_shard, '')
+			FROM orders
+			WHERE order_uid > $1
+			ORDER BY order_uid
+			LIMIT $2`, after, rebalanceBatch)
+		if err != nil {
+			return err
+		}
+		type move struct {
+			uid string
+			dst *shard
+		}
+		var moves []move
+		n := 0
+		for rows.Next() {
+			var shardkey, oofShard string
+			if err := rows.Scan(&after, &shardkey, &oofShard); err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+			if dst := router.route(shardkey, oofShard); dst != src {
+				moves = append(moves, move{after, dst})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, m := range moves {
+			err := moveOrder(src, m.dst, m.uid)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue // заказ успели удалить
+			}
+			if err != nil {
+				log.Printf(" Перенос заказа %s из шарда %s в %s: %v", m.uid, src.name, m.dst.name, err)
+				rep.Failed = append(rep.Failed, m.uid)
+				continue
+			}
+			rep.Moved++
+		}
+		if n < rebalanceBatch {
+			return nil
+		}
+	}
+}
+
+// moveOrder переносит один заказ из src в dst.
+func moveOrder(src, dst *shard, uid string) error {
+	stx, err := src.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer stx.Rollback()
+
+	var anonymizedAt sql.NullTime
+	err = stx.QueryRow(`
+		SELECT d.anonymized_at FROM orders o
+		JOIN deliveries d ON d.order_uid = o.order_uid
+		WHERE o.order_uid = $1
+		FOR UPDATE`, uid).Scan(&anonymizedAt)
+	if err != nil {
+		return err
+	}
+	if pending, err := outboxPendingTx(stx, uid); err != nil || pending {
+		if pending {
+			return errOutboxPending
+		}
+		return err
+	}
+	order, err := getOrderFrom(stx, uid)
+	if err != nil {
+		return err
+	}
+
+	dtx, err := dst.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer dtx.Rollback()
+	version, err := insertOrderTx(dtx, order)
+	if err != nil {
+		return err
+	}
+	// version == 0 — копия уже в dst после прерванного переноса
+	if version != 0 {
+		if anonymizedAt.Valid {
+			_, err := dtx.Exec("UPDATE deliveries SET anonymized_at = $2 WHERE order_uid = $1", uid, anonymizedAt.Time)
+			if err != nil {
+				return err
+			}
+		}
+		if err := notifyOrderTx(dtx, uid, version, false); err != nil {
+			return err
+		}
+	}
+	if err := dtx.Commit(); err != nil {
+		return err
+	}
+
+	if _, err := stx.Exec("DELETE FROM orders WHERE order_uid = $1", uid); err != nil {
+		return fmt.Errorf("заказ уже в шарде %s, но не удалён из %s: %w", dst.name, src.name, err)
+	}
+	return stx.Commit()
+}
+
+// rebalanceArchive переносит архив шарда src пачками: пачка удаляется из
+// src одной транзакцией после коммита записи в целевые шарды.
+func rebalanceArchive(src *shard, rep *rebalanceReport) error {
+	after := ""
+	for {
+		n, moved, last, err := rebalanceArchiveBatch(src, after, rep)
+		if err != nil {
+			return err
+		}
+		rep.MovedArchived += moved
+		if n < rebalanceBatch {
+			return nil
+		}
+		after = last
+	}
+}
+
+func rebalanceArchiveBatch(src *shard, after string, rep *rebalanceReport) (n, moved int, last string, err error) {
+	stx, err := src.db.Begin()
+	if err != nil {
+		return 0, 0, "", err
+	}
+	defer stx.Rollback()
+
+	rows, err := stx.Query(`
+		SELECT order_uid, key_version, dek, data, anonymized_at IS NOT NULL, shardkey, oof_shard
+		FROM archived_orders
+		WHERE order_uid > $1
+		ORDER BY order_uid
+		LIMIT $2
+		FOR UPDATE`, after, rebalanceBatch)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	type row struct {
+		uid                string
+		version            sql.NullInt64
+		dek, data          []byte
+		anonymized         bool
+		shardkey, oofShard sql.NullString
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.uid, &r.version, &r.dek, &r.data, &r.anonymized, &r.shardkey, &r.oofShard); err != nil {
+			rows.Close()
+			return 0, 0, "", err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, "", err
+	}
+	if len(batch) == 0 {
+		return 0, 0, "", nil
+	}
+
+	dtxs := make(map[*shard]*sql.Tx)
+	defer func() {
+		for _, tx := range dtxs {
+			tx.Rollback()
+		}
+	}()
+	var movedUIDs []string
+	for _, r := range batch {
+		dst := router.route(r.shardkey.String, r.oofShard.String)
+		if r.shardkey.Valid && dst == src {
+			continue
+		}
+		// После удаления персональных данных у архивного заказа тоже бывают
+		// события в outbox
+		if pending, err := outboxPendingTx(stx, r.uid); err != nil {
+			return 0, 0, "", err
+		} else if pending {
+			log.Printf(" Перенос архива: заказ %s: %v", r.uid, errOutboxPending)
+			rep.Failed = append(rep.Failed, r.uid)
+			continue
+		}
+		// Для записи в другой шард заказ нужен целиком; у архива без колонок
+		// shardkey и oof_shard из него же узнаём и шард
+		order, err := decodeArchived(r.uid, r.version, r.dek, r.data)
+		if err != nil {
+			log.Printf(" Перенос архива: %v", err)
+			rep.Failed = append(rep.Failed, r.uid)
+			continue
+		}
+		dst = router.routeOrder(order)
+		if dst == src {
+			_, err := stx.Exec("UPDATE archived_orders SET shardkey = $2, oof_shard = $3 WHERE order_uid = $1",
+				r.uid, order.Shardkey, order.OofShard)
+			if err != nil {
+				return 0, 0, "", err
+			}
+			continue
+		}
+		dtx := dtxs[dst]
+		if dtx == nil {
+			if dtx, err = dst.db.Begin(); err != nil {
+				return 0, 0, "", err
+			}
+			dtxs[dst] = dtx
+		}
+		if err := writeArchivedTx(dtx, order, r.anonymized); err != nil {
+			return 0, 0, "", fmt.Errorf("заказ %s: %w", r.uid, err)
+		}
+		movedUIDs = append(movedUIDs, r.uid)
+	}
+
+	for dst, dtx := range dtxs {
+		if err := dtx.Commit(); err != nil {
+			return 0, 0, "", fmt.Errorf("шард %s: %w", dst.name, err)
+		}
+	}
+	for _, uid := range movedUIDs {
+		if _, err := stx.Exec("DELETE FROM archived_orders WHERE order_uid = $1", uid); err != nil {
+			return 0, 0, "", err
+		}
+	}
+	return len(batch), len(movedUIDs), batch[len(batch)-1].uid, stx.Commit()
+}
+
+// === HTTP: GET /admin/shards и POST /admin/shards/rebalance (только для админа) ===
+func shardStatusHandler(w http.ResponseWriter, r *http.Request) {
+	infos, err := shardStatus()
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+func rebalanceShardsHandler(w http.ResponseWriter, r *http.Request) {
+	rep, err := rebalanceShards(r.Context())
+	if errors.Is(err, errRebalanceBusy) {
+		http.Error(w, "Перенос заказов уже выполняет другой экземпляр", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf(" Перенос заказов между шардами прерван после %d заказов: %v", rep.Moved+rep.MovedArchived, err)
+		http.Error(w, fmt.Sprintf("Перенос прерван после %d заказов: %v", rep.Moved+rep.MovedArchived, err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf(" Перенос заказов между шардами: %d заказов, %d из архива, ошибок %d за %d мс",
+		rep.Moved, rep.MovedArchived, len(rep.Failed), rep.DurationMs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// === Хранение и архивация старых заказов ===
+// Заказы старше RETENTION_DAYS дней (по date_created) переносятся из
+// рабочих таблиц в archived_orders: одна строка на заказ, JSON в gzip,
+// зашифрованный так же, как контакты (см. sealBlob). Из кэша они уходят,
+// но GET /order/{uid} и gRPC GetOrder находят их в архиве — медленнее, чем
+// из памяти. Месяц архива целиком выгружается одним NDJSON.gz.
+//
+// Задание запускается каждые RETENTION_INTERVAL на всех экземплярах
+// сервиса. Пачка заказов переносится в одной транзакции под
+// pg_try_advisory_xact_lock: пока её держит один экземпляр, остальные
+// пропускают запуск, а строки берутся FOR UPDATE SKIP LOCKED. Архив
+// лежит в том же шарде, что и заказ (shards.go), и шарды архивируются по
+// очереди, каждый под своей блокировкой.
+
+const (
+	archiveBatch             = 500
+	defaultRetentionInterval = time.Hour
+	retentionLockID          = 0x61726368 // ключ advisory lock задания архивации («arch»)
+)
+
+var (
+	retentionDays     int // 0 — архивация выключена
+	retentionInterval = defaultRetentionInterval
+)
+
+// parseRetention читает RETENTION_DAYS и RETENTION_INTERVAL.
+func parseRetention(days, interval string) error {
+	if days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("RETENTION_DAYS=%q: нужно целое число дней", days)
+		}
+		retentionDays = n
+	}
+	if interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("RETENTION_INTERVAL=%q: нужна длительность не меньше 1m, например 6h", interval)
+		}
+		retentionInterval = d
+	}
+	return nil
+}
+
+type archiveReport struct {
+	Cutoff     time.Time `json:"cutoff"`
+	Archived   int       `json:"archived"`
+	Busy       bool      `json:"busy,omitempty"` // архивацию (хотя бы одного шарда) в этот момент выполнял другой экземпляр
+	DurationMs int64     `json:"duration_ms"`
+}
+
+func retentionCutoff() time.Time {
+	return time.Now().AddDate(0, 0, -retentionDays)
+}
+
+// startRetention периодически архивирует старые заказы.
+func startRetention() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		cutoff := retentionCutoff()
+		rep, err := archiveOldOrders(cutoff)
+		if err != nil {
+			log.Printf(" Архивация прервана после %d заказов: %v", rep.Archived, err)
+		} else if rep.Archived > 0 {
+			log.Printf(" В архив перенесено %d заказов старше %s за %d мс",
+				rep.Archived, cutoff.Format("2006-01-02"), rep.DurationMs)
+		}
+		// Заказы, которые перенёс другой экземпляр, из своего кэша убираем сами
+		if n := cacheEvictBefore(cutoff); n > 0 {
+			log.Printf(" Из кэша убрано %d заказов старше срока хранения", n)
+		}
+	}
+}
+
+// archiveOldOrders переносит в архив все заказы старше cutoff пачками по
+// archiveBatch; прерванную архивацию можно просто запустить снова.
+func archiveOldOrders(cutoff time.Time) (rep archiveReport, err error) {
+	rep.Cutoff = cutoff
+	start := time.Now()
+	defer func() { rep.DurationMs = time.Since(start).Milliseconds() }()
+	err = eachShard(func(s *shard) error {
+		for {
+			uids, versions, locked, err := archiveBatchTx(s, cutoff)
+			if err != nil {
+				return err
+			}
+			if !locked {
+				rep.Busy = true
+				return nil
+			}
+			for i, uid := range uids {
+				cacheDelete(uid, versions[i])
+			}
+			rep.Archived += len(uids)
+			if len(uids) < archiveBatch {
+				return nil
+			}
+		}
+	})
+	return rep, err
+}
+
+func archiveBatchTx(s *shard, cutoff time.Time) (uids []string, versions []int64, locked bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", retentionLockID).Scan(&locked); err != nil || !locked {
+		return nil, nil, false, err
+	}
+	rows, err := tx.Query(`
+		SELECT order_uid FROM orders
+		WHERE date_created < $1
+		ORDER BY date_created
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`, cutoff, archiveBatch)
+	if err != nil {
+		return nil, nil, true, err
+	}
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return nil, nil, true, err
+		}
+		uids = append(uids, uid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, true, err
+	}
+
+	for _, uid := range uids {
+		order, err := getOrderFrom(tx, uid)
+		if err != nil {
+			return nil, nil, true, fmt.Errorf("заказ %s: %w", uid, err)
+		}
+		if err := writeArchivedTx(tx, order, false); err != nil {
+			return nil, nil, true, fmt.Errorf("заказ %s: %w", uid, err)
+		}
+		version, err := nextVersion()
+		if err != nil {
+			return nil, nil, true, err
+		}
+		if _, err := tx.Exec("DELETE FROM orders WHERE order_uid = $1", uid); err != nil {
+			return nil, nil, true, err
+		}
+		if err := notifyOrderTx(tx, uid, version, true); err != nil {
+			return nil, nil, true, err
+		}
+		versions = append(versions, version)
+	}
+	return uids, versions, true, tx.Commit()
+}
+
+// writeArchivedTx записывает заказ в архив; anonymized — контакты в нём
+// уже стёрты (см. erasure.go). Поверх обезличенной записи пишется только
+// обезличенная: неполная копия заказа не вернёт стёртые контакты.
+func writeArchivedTx(tx *sql.Tx, order Order, anonymized bool) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(order); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	version, dek, data, err := sealBlob(order.OrderUID, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("шифрование архива: %w", err)
+	}
+	// shardkey и oof_shard — открыто, чтобы rebalance выбирал шард без расшифровки
+	_, err = tx.Exec(`
+		INSERT INTO archived_orders (order_uid, customer_id, date_created, key_version, dek, data, anonymized_at, shardkey, oof_shard)
+		VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $7::boolean THEN now() END, $8, $9)
+		ON CONFLICT (order_uid) DO UPDATE SET customer_id = $2, date_created = $3,
+			key_version = $4, dek = $5, data = $6, anonymized_at = COALESCE(archived_orders.anonymized_at, EXCLUDED.anonymized_at),
+			shardkey = $8, oof_shard = $9
+		WHERE archived_orders.anonymized_at IS NULL OR $7::boolean`,
+		order.OrderUID, order.CustomerID, order.DateCreated, version, dek, data, anonymized, order.Shardkey, order.OofShard)
+	return err
+}
+
+// decodeArchived расшифровывает и распаковывает заказ из архива.
+func decodeArchived(uid string, version sql.NullInt64, dek, data []byte) (Order, error) {
+	var order Order
+	plain, err := openBlob(uid, version, dek, data)
+	if err != nil {
+		return order, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return order, fmt.Errorf("архив заказа %s: %w", uid, err)
+	}
+	if err := json.NewDecoder(zr).Decode(&order); err != nil {
+		return order, fmt.Errorf("архив заказа %s: %w", uid, err)
+	}
+	return order, nil
+}
+
+// findArchivedOrder ищет заказ в архивах всех шардов; нет такого —
+// sql.ErrNoRows.
+func findArchivedOrder(uid string) (Order, error) {
+	for _, s := range router.shards {
+		var version sql.NullInt64
+		var dek, data []byte
+		err := s.db.QueryRow("SELECT key_version, dek, data FROM archived_orders WHERE order_uid = $1", uid).
+			Scan(&version, &dek, &data)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return Order{}, err
+		}
+		return decodeArchived(uid, version, dek, data)
+	}
+	return Order{}, sql.ErrNoRows
+}
+
+// rotateArchiveBatchTx — пачка ротации ключей для архива шарда (см.
+// rotateDataKeys).
+func rotateArchiveBatchTx(s *shard, after string, rep *keyRotationReport) (n int, last string, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT order_uid, key_version, dek, data, anonymized_at IS NOT NULL
+		FROM archived_orders
+		WHERE key_version IS DISTINCT FROM $1 AND order_uid > $2
+		ORDER BY order_uid
+		LIMIT $3
+		FOR UPDATE`, keyring.active, after, rotateBatch)
+	if err != nil {
+		return 0, "", err
+	}
+	type row struct {
+		uid        string
+		version    sql.NullInt64
+		dek, data  []byte
+		anonymized bool
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.uid, &r.version, &r.dek, &r.data, &r.anonymized); err != nil {
+			rows.Close()
+			return 0, "", err
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+
+	for _, r := range batch {
+		order, err := decodeArchived(r.uid, r.version, r.dek, r.data)
+		if err != nil {
+			log.Printf(" Ротация ключей архива: %v", err)
+			rep.Failed = append(rep.Failed, r.uid)
+			continue
+		}
+		if err := writeArchivedTx(tx, order, r.anonymized); err != nil {
+			return 0, "", err
+		}
+		rep.Rotated++
+	}
+	if len(batch) == 0 {
+		return 0, "", nil
+	}
+	return len(batch), batch[len(batch)-1].uid, tx.Commit()
+}
+
+// === HTTP: POST /admin/archive/run (только для админа) ===
+// Запустить архивацию сейчас, не дожидаясь расписания.
+func runArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if retentionDays == 0 {
+		http.Error(w, "Архивация выключена: RETENTION_DAYS не задан", http.StatusConflict)
+		return
+	}
+	rep, err := archiveOldOrders(retentionCutoff())
+	if err != nil {
+		log.Printf(" Архивация прервана после %d заказов: %v", rep.Archived, err)
+		http.Error(w, fmt.Sprintf("Архивация прервана после %d заказов: %v", rep.Archived, err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf(" Архивация по запросу: перенесено %d заказов за %d мс", rep.Archived, rep.DurationMs)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
+
+// === HTTP: GET /admin/archive/{month} (только для админа) ===
+// Заказы из архива за месяц YYYY-MM (по date_created в UTC) одним NDJSON.gz
+// — тот же формат, что понимают import и publish. При шардировании заказы
+// идут по шардам, внутри шарда — по дате.
+func archiveMonthHandler(w http.ResponseWriter, r *http.Request) {
+	month := chi.URLParam(r, "month")
+	from, err := time.Parse("2006-01", month)
+	if err != nil {
+		http.Error(w, "Месяц нужен в виде YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	var shardRows []*sql.Rows
+	defer func() {
+		for _, rows := range shardRows {
+			rows.Close()
+		}
+	}()
+	err = eachShard(func(s *shard) error {
+		rows, err := s.db.Query(`
+			SELECT order_uid, key_version, dek, data FROM archived_orders
+			WHERE date_created >= $1 AND date_created < $2
+			ORDER BY date_created, order_uid`, from, from.AddDate(0, 1, 0))
+		if err == nil {
+			shardRows = append(shardRows, rows)
+		}
+		return err
+	})
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="orders-`+month+`.ndjson.gz"`)
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	n := 0
+	for _, rows := range shardRows {
+		for rows.Next() && err == nil {
+			var uid string
+			var version sql.NullInt64
+			var dek, data []byte
+			if err = rows.Scan(&uid, &version, &dek, &data); err != nil {
+				break
+			}
+			var order Order
+			if order, err = decodeArchived(uid, version, dek, data); err == nil {
+				err = enc.Encode(order)
+				n++
+			}
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		// Заголовки уже отправлены: обрываем поток без закрывающего блока
+		// gzip, чтобы получатель увидел ошибку распаковки, а не тихо урезанный файл.
+		log.Printf(" Выгрузка архива за %s оборвана после %d заказов: %v", month, n, err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf(" Выгрузка архива за %s: %v", month, err)
+	}
+}
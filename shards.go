@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// === Шардирование заказов по shardkey ===
+// Заказы (orders, deliveries, payments, items), их архив и outbox могут
+// лежать в нескольких базах Postgres — шардах. Шард заказа выбирается по
+// shardkey, а если он пуст — по oof_shard, по правилам из файла SHARD_MAP.
+// Основная БД (main) — всегда шард, и только в ней живёт остальное:
+// очередь DLQ, журнал аудита, webhooks, курсы валют (они копируются во все
+// шарды для пересчёта в валюту отчёта). Без SHARD_MAP шард один — main.
+//
+// Запись идёт в шард по правилам, а чтение заказа по order_uid, списки,
+// статистика и выгрузка опрашивают все шарды: после смены карты заказ
+// может ещё лежать в прежнем шарде, пока его не перенесёт rebalance
+// (rebalance.go). Версии заказов и id событий outbox выдают
+// последовательности основной БД, чтобы они были сравнимы между шардами.
+//
+// Файл карты:
+//
+//	# шард и строка подключения; у main она не указывается
+//	shard main
+//	shard east user=orderuser password=... dbname=orders_east host=db-east port=5432
+//	# shardkey (значения и диапазоны через запятую) → шард
+//	route 0-4 main
+//	route 5-9 east
+//	route * main
+
+const mainShardName = "main"
+
+type shard struct {
+	name string
+	dsn  string
+	db   *sql.DB
+}
+
+// shardRule — правило карты: точные значения и диапазоны чисел.
+type shardRule struct {
+	values map[string]bool
+	ranges [][2]int64
+	shard  *shard
+}
+
+type shardMap struct {
+	shards   []*shard // shards[0] — основная БД
+	rules    []shardRule
+	fallback *shard // для ключей, не попавших ни в одно правило
+}
+
+// router — текущая карта шардов; задаётся при старте.
+var router *shardMap
+
+// singleShard — карта без шардирования: всё в основной БД.
+func singleShard() *shardMap {
+	primary := &shard{name: mainShardName, dsn: connStr, db: db}
+	return &shardMap{shards: []*shard{primary}, fallback: primary}
+}
+
+// loadShardMap читает файл карты и подключается к шардам.
+func loadShardMap(path string) (*shardMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := parseShardMap(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range m.shards[1:] {
+		if s.db, err = sql.Open("postgres", s.dsn); err != nil {
+			return nil, fmt.Errorf("шард %s: %w", s.name, err)
+		}
+		if err := s.db.Ping(); err != nil {
+			return nil, fmt.Errorf("шард %s: %w", s.name, err)
+		}
+		if err := migrateSchema(s.db); err != nil {
+			return nil, fmt.Errorf("шард %s: создание таблиц: %w", s.name, err)
+		}
+		if err := copyRates(s); err != nil {
+			return nil, fmt.Errorf("шард %s: копирование курсов валют: %w", s.name, err)
+		}
+	}
+	return m, nil
+}
+
+// parseShardMap разбирает карту; к шардам, кроме main, не подключается.
+// path нужен только для сообщений об ошибках.
+func parseShardMap(r io.Reader, path string) (*shardMap, error) {
+	m := singleShard()
+	byName := map[string]*shard{mainShardName: m.shards[0]}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		switch {
+		case fields[0] == "shard" && len(fields) >= 2:
+			name, dsn, _ := strings.Cut(strings.TrimSpace(text[len("shard"):]), " ")
+			dsn = strings.TrimSpace(dsn)
+			if name == mainShardName {
+				if dsn != "" {
+					return nil, fmt.Errorf("%s:%d: шард main — основная БД сервиса, строка подключения не нужна", path, line)
+				}
+				continue
+			}
+			if dsn == "" {
+				return nil, fmt.Errorf("%s:%d: нужна строка «shard имя строка-подключения»", path, line)
+			}
+			if _, dup := byName[name]; dup {
+				return nil, fmt.Errorf("%s:%d: шард %s повторяется", path, line, name)
+			}
+			s := &shard{name: name, dsn: dsn}
+			byName[name] = s
+			m.shards = append(m.shards, s)
+		case fields[0] == "route" && len(fields) == 3:
+			s, ok := byName[fields[2]]
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: шард %s не объявлен выше", path, line, fields[2])
+			}
+			rule := shardRule{values: map[string]bool{}, shard: s}
+			for _, key := range strings.Split(fields[1], ",") {
+				if key == "*" {
+					m.fallback = s
+					continue
+				}
+				if lo, hi, ok := strings.Cut(key, "-"); ok {
+					from, err1 := strconv.ParseInt(lo, 10, 64)
+					to, err2 := strconv.ParseInt(hi, 10, 64)
+					if err1 == nil && err2 == nil {
+						if from > to {
+							return nil, fmt.Errorf("%s:%d: пустой диапазон %s", path, line, key)
+						}
+						rule.ranges = append(rule.ranges, [2]int64{from, to})
+						continue
+					}
+				}
+				rule.values[key] = true
+			}
+			m.rules = append(m.rules, rule)
+		default:
+			return nil, fmt.Errorf("%s:%d: нужна строка «shard имя строка-подключения» или «route ключи шард»", path, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// route выбирает шард по shardkey, а если он пуст — по oof_shard. Правила
+// проверяются по порядку.
+func (m *shardMap) route(shardkey, oofShard string) *shard {
+	key := shardkey
+	if key == "" {
+		key = oofShard
+	}
+	n, numErr := strconv.ParseInt(key, 10, 64)
+	for _, rule := range m.rules {
+		if rule.values[key] {
+			return rule.shard
+		}
+		for _, r := range rule.ranges {
+			if numErr == nil && n >= r[0] && n <= r[1] {
+				return rule.shard
+			}
+		}
+	}
+	return m.fallback
+}
+
+func (m *shardMap) routeOrder(o Order) *shard {
+	return m.route(o.Shardkey, o.OofShard)
+}
+
+func (m *shardMap) names() []string {
+	names := make([]string, len(m.shards))
+	for i, s := range m.shards {
+		names[i] = s.name
+	}
+	return names
+}
+
+// storedElsewhere сообщает, что заказ уже сохранён вне рабочих таблиц
+// target: лежит в другом шарде (карта сменилась, а rebalance его ещё не
+// перенёс) или в архиве любого шарда. Повтор такого заказа не должен
+// создать вторую копию или вернуть из архива заказ с контактами.
+func (m *shardMap) storedElsewhere(uid string, target *shard) (bool, error) {
+	for _, s := range m.shards {
+		var found bool
+		err := s.db.QueryRow(`
+			SELECT ($2 AND EXISTS (SELECT 1 FROM orders WHERE order_uid = $1))
+				OR EXISTS (SELECT 1 FROM archived_orders WHERE order_uid = $1)`,
+			uid, s != target).Scan(&found)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// eachShard вызывает fn для каждого шарда по очереди; первая ошибка
+// прерывает обход и возвращается с именем шарда.
+func eachShard(fn func(s *shard) error) error {
+	for _, s := range router.shards {
+		if err := fn(s); err != nil {
+			if len(router.shards) == 1 {
+				return err
+			}
+			return fmt.Errorf("шард %s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// nextVersion выдаёт новую версию заказа (см. coherence.go). Вызывается
+// после блокировки строки заказа, чтобы версии шли в порядке изменений.
+func nextVersion() (int64, error) {
+	var v int64
+	err := db.QueryRow("SELECT nextval('order_version_seq')").Scan(&v)
+	return v, err
+}
+
+// nextOutboxID выдаёт id события outbox, единый для всех шардов.
+func nextOutboxID() (int64, error) {
+	var id int64
+	err := db.QueryRow("SELECT nextval('outbox_id_seq')").Scan(&id)
+	return id, err
+}
+
+// querier — то общее, что есть у *sql.DB и *sql.Tx для чтения.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testShardMap = `
+# основная БД и два шарда
+shard main
+shard east user=orderuser dbname=orders_east host=db-east
+shard west  user=orderuser dbname=orders_west host=db-west
+
+route 0-4,10 main
+route 5-9,vip east
+route * west
+`
+
+func TestParseShardMap(t *testing.T) {
+	m, err := parseShardMap(strings.NewReader(testShardMap), "shards.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(m.names(), []string{"main", "east", "west"}) || m.shards[0].db != db {
+		t.Errorf("шарды %v", m.names())
+	}
+	if dsn := m.shards[2].dsn; dsn != "user=orderuser dbname=orders_west host=db-west" {
+		t.Errorf("строка подключения west: %q", dsn)
+	}
+	if len(m.rules) != 3 || m.fallback.name != "west" {
+		t.Errorf("правил %d, по умолчанию %s", len(m.rules), m.fallback.name)
+	}
+
+	bad := map[string]string{
+		"строка подключения у main": "shard main host=x\n",
+		"шард без подключения":      "shard east\n",
+		"шард повторяется":          "shard east host=a\nshard east host=b\n",
+		"маршрут к необъявленному":  "route 1 east\nshard east host=a\n",
+		"пустой диапазон":           "shard east host=a\nroute 9-5 east\n",
+		"маршрут без шарда":         "route 1-5\n",
+		"неизвестная строка":        "shards east host=a\n",
+	}
+	for name, conf := range bad {
+		if _, err := parseShardMap(strings.NewReader(conf), "shards.conf"); err == nil {
+			t.Errorf("%s: карта принята", name)
+		} else if !strings.HasPrefix(err.Error(), "shards.conf:") {
+			t.Errorf("%s: в ошибке нет места: %v", name, err)
+		}
+	}
+
+	// Без правил всё идёт в main
+	m, err = parseShardMap(strings.NewReader("shard main\n"), "shards.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := m.route("7", ""); s.name != "main" {
+		t.Errorf("без правил: %s", s.name)
+	}
+}
+
+func TestRouteOrder(t *testing.T) {
+	m, err := parseShardMap(strings.NewReader(testShardMap), "shards.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		shardkey, oofShard, want string
+	}{
+		{"0", "", "main"},
+		{"4", "9", "main"}, // shardkey важнее oof_shard
+		{"10", "", "main"},
+		{"5", "", "east"},
+		{"09", "", "east"}, // число, а не строка
+		{"vip", "", "east"},
+		{"", "7", "east"}, // пустой shardkey — по oof_shard
+		{"", "", "west"},
+		{"11", "", "west"},
+		{"VIP", "", "west"},
+		{"5a", "", "west"},
+	}
+	for _, c := range cases {
+		o := loadFixture(t, "basic")
+		o.Shardkey, o.OofShard = c.shardkey, c.oofShard
+		if got := m.routeOrder(o).name; got != c.want {
+			t.Errorf("shardkey %q, oof_shard %q: %s, ожидался %s", c.shardkey, c.oofShard, got, c.want)
+		}
+	}
+}
+
+func TestListDepthLimit(t *testing.T) {
+	srv := newTestServer(t)
+	for _, q := range []string{"page=51&limit=200", "page=501", "page=10001&limit=1"} {
+		resp := doRequest(t, srv, "GET", "/orders?"+q, "", nil)
+		if resp.StatusCode != 400 {
+			t.Errorf("%s: статус %d", q, resp.StatusCode)
+		}
+	}
+	if _, err := parseOrderFilter(map[string][]string{"page": {"50"}, "limit": {"200"}}, roleAnonymous); err != nil {
+		t.Errorf("последняя допустимая страница: %v", err)
+	}
+	p := orderListPage{orderList: orderList{Total: 1 << 20, Limit: 20}}
+	if p.Pages() != maxListDepth/20 {
+		t.Errorf("страниц %d", p.Pages())
+	}
+}
+
+// TestSortAmountWithinCurrency: суммы сравниваются только в одной валюте,
+// валюты идут по коду в любом направлении — и в SQL, и при слиянии шардов.
+func TestSortAmountWithinCurrency(t *testing.T) {
+	keys := []orderSortKey{
+		{OrderUID: "a", Currency: "USD", Amount: 5000},  // 50 $
+		{OrderUID: "b", Currency: "JPY", Amount: 10000}, // 10 000 ¥
+		{OrderUID: "c", Currency: "USD", Amount: 100},
+		{OrderUID: "d", Currency: "JPY", Amount: 100},
+	}
+	want := map[bool]string{false: "dbca", true: "bdac"}
+	for desc, order := range want {
+		f := orderFilter{Sort: "amount", Desc: desc}
+		sorted := slices.Clone(keys)
+		slices.SortFunc(sorted, f.compareSortKeys)
+		var got string
+		for _, k := range sorted {
+			got += k.OrderUID
+		}
+		if got != order {
+			t.Errorf("desc=%v: %s, ожидалось %s", desc, got, order)
+		}
+		if by := f.orderBy(true); !strings.HasPrefix(by, `p.currency COLLATE "C" ASC NULLS LAST, p.amount`) {
+			t.Errorf("desc=%v: ORDER BY %s", desc, by)
+		}
+	}
+}
+
+// TestListOrdersAcrossShards: два «шарда» на одной БД — каждый заказ
+// лежит в обоих, как во время rebalance, и должен попасть в список один раз.
+// Total точен, когда в выборку попали все копии, — здесь на второй странице.
+func TestListOrdersAcrossShards(t *testing.T) {
+	needDB(t)
+	orders := saveFixtures(t, "basic", "clothes", "kids")
+	prev := router
+	router = singleShard()
+	router.shards = append(router.shards, &shard{name: "copy", db: db})
+	t.Cleanup(func() { router = prev })
+
+	f, err := parseOrderFilter(map[string][]string{"limit": {"2"}, "sort": {"customer_id"}}, roleAnonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	for f.Page = 1; f.Page <= 2; f.Page++ {
+		list, err := listOrdersFromDB(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Page == 2 && list.Total != len(orders) || list.Total < len(orders) {
+			t.Errorf("страница %d: всего %d, заказов %d", f.Page, list.Total, len(orders))
+		}
+		for _, o := range list.Orders {
+			seen = append(seen, o.OrderUID)
+		}
+	}
+	uniq := slices.Clone(seen)
+	slices.Sort(uniq)
+	if len(seen) != len(orders) || len(slices.Compact(uniq)) != len(orders) {
+		t.Errorf("заказы на страницах: %v", seen)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// === Аналитика продаж ===
+
+// statsGroups — допустимые разрезы для GET /stats/{group} и выражения
+// ключа группировки. Время группируется в UTC.
+var statsGroups = map[string]string{
+	"day":              `to_char(date_trunc('day', o.date_created AT TIME ZONE 'UTC'), 'YYYY-MM-DD')`,
+	"week":             `to_char(date_trunc('week', o.date_created AT TIME ZONE 'UTC'), 'YYYY-MM-DD')`,
+	"month":            `to_char(date_trunc('month', o.date_created AT TIME ZONE 'UTC'), 'YYYY-MM')`,
+	"delivery_service": "o.delivery_service",
+	"provider":         "p.provider",
+	"bank":             "p.bank",
+	"region":           "d.region",
+	"brand":            "i.brand",
+}
+
+func isTimeGroup(group string) bool {
+	return group == "day" || group == "week" || group == "month"
+}
+
+type statsRow struct {
+	Key         string  `json:"key"`
+	Orders      int     `json:"orders"`
+	Revenue     float64 `json:"revenue"` // в единицах валюты
+	AvgBasket   float64 `json:"avg_basket"`
+	Items       int     `json:"items"`
+	Unconverted int     `json:"unconverted,omitempty"` // заказы без курса на дату оплаты: в выручку не вошли
+}
+
+type statsReport struct {
+	GroupBy  string     `json:"group_by,omitempty"`
+	Currency string     `json:"currency,omitempty"` // валюта выручки: report_currency, по умолчанию RUB
+	From     *time.Time `json:"from,omitempty"`
+	To       *time.Time `json:"to,omitempty"`
+	Rows     []statsRow `json:"rows,omitempty"`
+	Total    statsRow   `json:"total"`
+}
+
+func (r *statsRow) finish() {
+	if n := r.Orders - r.Unconverted; n > 0 {
+		r.AvgBasket = r.Revenue / float64(n)
+	}
+}
+
+// statsQuery строит запрос для разреза. По бренду выручка считается по
+// total_price позиций, иначе — по payments.amount заказа. Суммы в БД — в
+// минимальных единицах, выручка — в единицах валюты: валюты оплаты или,
+// если задана reportCurrency, валюты отчёта по курсу на дату оплаты.
+// statsFromDB задаёт её всегда.
+func statsQuery(group, where, reportCurrency string) string {
+	scale := currencyScaleSQL("p.currency")
+	rate, fxJoin := "1", ""
+	if reportCurrency != "" {
+		rate, fxJoin = "fx.rate", fxJoinSQL(reportCurrency)
+	}
+	if group == "brand" {
+		return fmt.Sprintf(`
+			SELECT COALESCE(i.brand, ''), COUNT(DISTINCT o.order_uid), COALESCE(SUM(i.total_price::numeric / %[1]s * %[2]s), 0)::float8, COUNT(*),
+				COUNT(DISTINCT o.order_uid) FILTER (WHERE %[2]s IS NULL)
+			FROM orders o
+			JOIN items i ON i.order_uid = o.order_uid
+			LEFT JOIN payments p ON p.order_uid = o.order_uid
+			%[3]s
+			%[4]s
+			GROUP BY 1
+			ORDER BY 3 DESC`, scale, rate, fxJoin, where)
+	}
+
+	key := "''"
+	groupBy, orderBy := "", ""
+	if group != "" {
+		key = "COALESCE(" + statsGroups[group] + ", '')"
+		groupBy = "GROUP BY 1"
+		orderBy = "ORDER BY 3 DESC"
+		if isTimeGroup(group) {
+			orderBy = "ORDER BY 1"
+		}
+	}
+	return fmt.Sprintf(`
+		SELECT %s, COUNT(*), COALESCE(SUM(p.amount::numeric / %s * %s), 0)::float8, COALESCE(SUM(ic.cnt), 0),
+			COUNT(*) FILTER (WHERE %[3]s IS NULL)
+		FROM orders o
+		LEFT JOIN payments p ON p.order_uid = o.order_uid
+		LEFT JOIN deliveries d ON d.order_uid = o.order_uid
+		LEFT JOIN (SELECT order_uid, COUNT(*) AS cnt FROM items GROUP BY order_uid) ic ON ic.order_uid = o.order_uid
+		%s
+		%s
+		%s
+		%s`, key, scale, rate, fxJoin, where, groupBy, orderBy)
+}
+
+// add прибавляет к строке те же суммы из другого шарда.
+func (r *statsRow) add(o statsRow) {
+	r.Orders += o.Orders
+	r.Revenue += o.Revenue
+	r.Items += o.Items
+	r.Unconverted += o.Unconverted
+}
+
+// === Расчёт отчёта в БД ===
+// Каждый шард считает свои суммы, а строки с одним ключом складываются;
+// среднюю корзину и порядок строк приходится считать заново.
+func statsFromDB(group string, f orderFilter) (statsReport, error) {
+	// Без валюты отчёта суммы в разных валютах сложились бы как есть
+	if f.ReportCurrency == "" {
+		f.ReportCurrency = ratesBase
+	}
+	rep := statsReport{GroupBy: group, Currency: f.ReportCurrency}
+	if !f.From.IsZero() {
+		rep.From = &f.From
+	}
+	if !f.To.IsZero() {
+		rep.To = &f.To
+	}
+	where, args := f.where()
+
+	byKey := map[string]*statsRow{}
+	err := eachShard(func(s *shard) error {
+		var total statsRow
+		err := s.db.QueryRow(statsQuery("", where, f.ReportCurrency), args...).
+			Scan(new(string), &total.Orders, &total.Revenue, &total.Items, &total.Unconverted)
+		if err != nil {
+			return err
+		}
+		rep.Total.add(total)
+		if group == "" {
+			return nil
+		}
+
+		rows, err := s.db.Query(statsQuery(group, where, f.ReportCurrency), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var row statsRow
+			if err := rows.Scan(&row.Key, &row.Orders, &row.Revenue, &row.Items, &row.Unconverted); err != nil {
+				return err
+			}
+			if sum, ok := byKey[row.Key]; ok {
+				sum.add(row)
+			} else {
+				byKey[row.Key] = &row
+			}
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return rep, err
+	}
+	rep.Total.finish()
+	if group == "" {
+		return rep, nil
+	}
+
+	rep.Rows = []statsRow{}
+	for _, row := range byKey {
+		row.finish()
+		rep.Rows = append(rep.Rows, *row)
+	}
+	slices.SortFunc(rep.Rows, func(a, b statsRow) int {
+		if !isTimeGroup(group) {
+			if c := cmp.Compare(b.Revenue, a.Revenue); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return rep, nil
+}
+
+// === HTTP: GET /stats/summary и GET /stats/{group} ===
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	group := chi.URLParam(r, "group")
+	if _, ok := statsGroups[group]; !ok && group != "" {
+		http.Error(w, fmt.Sprintf("неизвестный разрез %q", group), http.StatusBadRequest)
+		return
+	}
+
+	f, err := parseOrderFilter(r.URL.Query(), requestRole(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rep, err := statsFromDB(group, f)
+	if err != nil {
+		http.Error(w, "Ошибка расчёта статистики: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rep)
+}
+
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	ui.render(w, "dashboard", nil)
+}
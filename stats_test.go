@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// TestStatsReportCurrency: заказы в рублях, долларах и иенах. Без
+// report_currency выручка считается в рублях; заказ без курса на дату оплаты
+// в выручку и среднюю корзину не входит.
+func TestStatsReportCurrency(t *testing.T) {
+	needDB(t)
+	basic, usd, jpy := loadFixture(t, "basic"), loadFixture(t, "clothes"), loadFixture(t, "kids")
+	for _, m := range usd.Amounts() {
+		m.Currency = "USD" // 3250.00 $, оплата 2024-04-05
+	}
+	for _, m := range jpy.Amounts() {
+		m.Currency = "JPY"
+	}
+	for _, o := range []Order{basic, usd, jpy} {
+		if _, err := saveOrderToDB(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := saveRates([]exchangeRate{{Date: "2024-04-04", Currency: "USD", Nominal: 1, Value: "92"}}); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t)
+
+	cases := []struct {
+		query, currency string
+		revenue         float64
+	}{
+		{"", "RUB", 1817 + 3250*92},
+		{"?report_currency=usd", "USD", 1817.0/92 + 3250},
+		{"?report_currency=RUB", "RUB", 1817 + 3250*92},
+	}
+	for _, c := range cases {
+		resp := doRequest(t, srv, "GET", "/stats/summary"+c.query, "", nil)
+		var rep statsReport
+		if err := json.Unmarshal(readBody(t, resp), &rep); err != nil {
+			t.Fatal(err)
+		}
+		tot := rep.Total
+		if rep.Currency != c.currency || tot.Orders != 3 || tot.Unconverted != 1 {
+			t.Errorf("%s: валюта %q, итог %+v", c.query, rep.Currency, tot)
+		}
+		if math.Abs(tot.Revenue-c.revenue) > 0.01 || math.Abs(tot.AvgBasket-c.revenue/2) > 0.01 {
+			t.Errorf("%s: выручка %v, корзина %v, ожидалось %v", c.query, tot.Revenue, tot.AvgBasket, c.revenue)
+		}
+	}
+
+	// Разрезы складываются в тот же итог
+	resp := doRequest(t, srv, "GET", "/stats/month", "", nil)
+	var rep statsReport
+	if err := json.Unmarshal(readBody(t, resp), &rep); err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for _, row := range rep.Rows {
+		sum += row.Revenue
+	}
+	if rep.Currency != ratesBase || len(rep.Rows) != 2 || math.Abs(sum-rep.Total.Revenue) > 0.01 {
+		t.Errorf("по месяцам: %+v", rep)
+	}
+}
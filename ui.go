@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// === Шаблоны и статика веб-интерфейса ===
+
+//go:embed web
+var webFS embed.FS
+
+// Статика с актуальным ?v= кэшируется браузером на год: при изменении файла
+// меняется хэш, а с ним и URL.
+const staticCacheControl = "public, max-age=31536000, immutable"
+
+// webUI хранит разобранные страницы и хэши статических файлов. В dev-режиме
+// всё перечитывается с диска на каждый запрос.
+type webUI struct {
+	fsys fs.FS
+	dev  bool
+
+	mu     sync.RWMutex
+	pages  map[string]*template.Template
+	hashes map[string]string
+}
+
+var ui *webUI
+
+// newWebUI использует встроенные файлы, а если задан devDir — каталог на диске.
+func newWebUI(devDir string) (*webUI, error) {
+	u := &webUI{dev: devDir != ""}
+	if u.dev {
+		u.fsys = os.DirFS(devDir)
+	} else {
+		sub, err := fs.Sub(webFS, "web")
+		if err != nil {
+			return nil, err
+		}
+		u.fsys = sub
+	}
+	if err := u.load(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (u *webUI) load() error {
+	hashes := make(map[string]string)
+	err := fs.WalkDir(u.fsys, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(u.fsys, p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hashes[strings.TrimPrefix(p, "static/")] = hex.EncodeToString(sum[:])[:12]
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("статика: %w", err)
+	}
+
+	funcs := template.FuncMap{
+		"pathEscape": url.PathEscape,
+		"money":      func(m Money) string { return m.Format("ru") },
+		"inc":        func(n int) int { return n + 1 },
+		"dec":        func(n int) int { return n - 1 },
+		"slice":      func(v ...int) []int { return v },
+		"asset": func(name string) (string, error) {
+			h, ok := hashes[name]
+			if !ok {
+				return "", fmt.Errorf("неизвестный файл статики %q", name)
+			}
+			return "/static/" + name + "?v=" + h, nil
+		},
+	}
+
+	files, err := fs.Glob(u.fsys, "templates/*.html")
+	if err != nil {
+		return err
+	}
+	pages := make(map[string]*template.Template)
+	for _, f := range files {
+		name := strings.TrimSuffix(path.Base(f), ".html")
+		if name == "layout" {
+			continue
+		}
+		t, err := template.New(name).Funcs(funcs).ParseFS(u.fsys, "templates/layout.html", f)
+		if err != nil {
+			return fmt.Errorf("шаблон %s: %w", name, err)
+		}
+		pages[name] = t
+	}
+
+	u.mu.Lock()
+	u.pages, u.hashes = pages, hashes
+	u.mu.Unlock()
+	return nil
+}
+
+func (u *webUI) render(w http.ResponseWriter, name string, data any) {
+	if u.dev {
+		if err := u.load(); err != nil {
+			log.Printf(" Ошибка перезагрузки шаблонов: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	u.mu.RLock()
+	tmpl, ok := u.pages[name]
+	u.mu.RUnlock()
+	if !ok {
+		log.Printf(" Шаблон %s не найден", name)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout", data); err != nil {
+		log.Printf(" Ошибка рендеринга шаблона %s: %v", name, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// staticHandler отдаёт /static/*. Долгий кэш ставится, только если ?v=
+// совпадает с текущим хэшем файла, иначе браузер обязан перепроверить.
+func (u *webUI) staticHandler() http.Handler {
+	static, err := fs.Sub(u.fsys, "static")
+	if err != nil {
+		log.Fatal(" Каталог статики недоступен:", err)
+	}
+	files := http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/static/")
+		if name == "" || strings.HasSuffix(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		u.mu.RLock()
+		h := u.hashes[name]
+		u.mu.RUnlock()
+
+		if !u.dev && h != "" && r.URL.Query().Get("v") == h {
+			w.Header().Set("Cache-Control", staticCacheControl)
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+// Простые SVG-графики без сторонних библиотек. Подписи выводятся через
+// textContent, как и всё остальное на страницах.
+const svgNS = 'http://www.w3.org/2000/svg';
+
+function svg(tag, attrs, text) {
+    const node = document.createElementNS(svgNS, tag);
+    for (const [k, v] of Object.entries(attrs || {})) node.setAttribute(k, v);
+    if (text !== undefined) node.textContent = text;
+    return node;
+}
+
+function formatNumber(v) {
+    return Number(v).toLocaleString('ru-RU', {maximumFractionDigits: 2});
+}
+
+// columnChart рисует столбцы по времени: points — [{label, value}].
+function columnChart(container, points) {
+    container.replaceChildren();
+    if (!points.length) {
+        container.append(el('div', 'empty', 'Нет данных за период'));
+        return;
+    }
+    const width = 1000, height = 260, pad = {top: 16, right: 10, bottom: 40, left: 70};
+    const max = Math.max(...points.map(p => p.value), 1);
+    const innerW = width - pad.left - pad.right;
+    const innerH = height - pad.top - pad.bottom;
+    const step = innerW / points.length;
+    const chart = svg('svg', {viewBox: `0 0 ${width} ${height}`, class: 'chart-svg'});
+
+    for (let i = 0; i <= 4; i++) {
+        const y = pad.top + innerH - innerH * i / 4;
+        chart.append(svg('line', {x1: pad.left, x2: width - pad.right, y1: y, y2: y, class: 'grid-line'}));
+        chart.append(svg('text', {x: pad.left - 6, y: y + 4, 'text-anchor': 'end', class: 'axis'}, formatNumber(max * i / 4)));
+    }
+
+    const labelEvery = Math.ceil(points.length / 12);
+    points.forEach((p, i) => {
+        const h = innerH * p.value / max;
+        const x = pad.left + i * step;
+        const bar = svg('rect', {x: x + step * 0.1, y: pad.top + innerH - h, width: step * 0.8, height: h, class: 'bar'});
+        bar.append(svg('title', {}, p.label + ': ' + formatNumber(p.value)));
+        chart.append(bar);
+        if (i % labelEvery === 0) {
+            chart.append(svg('text', {x: x + step / 2, y: height - pad.bottom + 16, 'text-anchor': 'middle', class: 'axis'}, p.label));
+        }
+    });
+    container.append(chart);
+}
+
+// barChart рисует горизонтальные полосы для категорий, не больше limit штук.
+function barChart(container, points, limit) {
+    container.replaceChildren();
+    points = points.slice(0, limit || 10);
+    if (!points.length) {
+        container.append(el('div', 'empty', 'Нет данных за период'));
+        return;
+    }
+    const max = Math.max(...points.map(p => p.value), 1);
+    for (const p of points) {
+        const row = el('div', 'hbar');
+        const fill = el('div', 'hbar-fill');
+        fill.style.width = (100 * p.value / max).toFixed(1) + '%';
+        const track = el('div', 'hbar-track');
+        track.append(fill);
+        row.append(el('div', 'hbar-label', p.label || '—'), track, el('div', 'hbar-value', formatNumber(p.value)));
+        container.append(row);
+    }
+}
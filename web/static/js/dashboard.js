@@ -0,0 +1,73 @@
+const form = document.getElementById('stats-filters');
+const dimensions = ['delivery_service', 'provider', 'bank', 'region', 'brand'];
+
+function statsQuery() {
+    const q = new URLSearchParams();
+    for (const name of ['date_from', 'date_to', 'currency', 'report_currency']) {
+        const v = form.elements[name].value.trim();
+        if (v) q.set(name, v);
+    }
+    return q.toString();
+}
+
+function fetchStats(path, query) {
+    return fetch('/stats/' + path + (query ? '?' + query : '')).then(res => {
+        if (!res.ok) return res.text().then(t => { throw new Error(t.trim() || res.statusText); });
+        return res.json();
+    });
+}
+
+function points(report, metric) {
+    return (report.rows || []).map(r => ({label: r.key, value: r[metric]}));
+}
+
+function load() {
+    const query = statsQuery();
+    const metric = form.elements.metric.value;
+    const period = form.elements.period.value;
+    const errorBox = document.getElementById('stats-error');
+    errorBox.hidden = true;
+
+    // Выбор показателя и периода сохраняем в адресе, чтобы ссылкой можно было поделиться
+    const state = new URLSearchParams(query);
+    state.set('metric', metric);
+    state.set('period', period);
+    history.replaceState(null, '', '?' + state.toString());
+
+    Promise.all([
+        fetchStats('summary', query),
+        fetchStats(period, query),
+        ...dimensions.map(d => fetchStats(d, query)),
+    ]).then(([summary, timeline, ...byDim]) => {
+        for (const key of ['revenue', 'orders', 'avg_basket', 'items']) {
+            document.getElementById('total-' + key).textContent = formatNumber(summary.total[key]);
+        }
+        const unconverted = document.getElementById('stats-unconverted');
+        unconverted.hidden = !summary.total.unconverted;
+        unconverted.textContent = 'Заказов без курса ' + summary.currency + ' на дату оплаты: ' +
+            formatNumber(summary.total.unconverted) + '. В выручку и средний чек они не вошли — загрузите курсы ЦБ.';
+        columnChart(document.getElementById('chart-period'), points(timeline, metric));
+        dimensions.forEach((d, i) => {
+            const pts = points(byDim[i], metric).sort((a, b) => b.value - a.value);
+            barChart(document.getElementById('chart-' + d), pts, 10);
+        });
+    }).catch(err => {
+        errorBox.textContent = '❌ ' + err.message;
+        errorBox.hidden = false;
+    });
+}
+
+// Восстанавливаем форму из адресной строки
+const initial = new URLSearchParams(location.search);
+for (const name of ['date_from', 'date_to', 'currency', 'report_currency', 'metric', 'period']) {
+    if (initial.has(name)) form.elements[name].value = initial.get(name);
+}
+
+form.addEventListener('submit', e => {
+    e.preventDefault();
+    load();
+});
+form.elements.metric.addEventListener('change', load);
+form.elements.period.addEventListener('change', load);
+
+load();
@@ -0,0 +1,111 @@
+// Рендер OpenAPI-документа в духе Swagger UI: операции, параметры,
+// ответы и схемы моделей.
+const docsRoot = document.getElementById('docs');
+
+function refName(ref) {
+    return ref.split('/').pop();
+}
+
+function schemaLabel(s) {
+    if (!s) return '';
+    if (s.$ref) return refName(s.$ref);
+    if (s.allOf) return s.allOf.map(schemaLabel).join(' & ') + (s.nullable ? ' | null' : '');
+    if (s.type === 'array') return schemaLabel(s.items) + '[]';
+    let label = s.type || 'any';
+    if (s.format) label += ' (' + s.format + ')';
+    if (s.enum) label += ': ' + s.enum.join(' | ');
+    return label;
+}
+
+function schemaLink(s) {
+    const inner = s && (s.$ref ? s : s.items && s.items.$ref ? s.items : null);
+    if (!inner) return el('code', '', schemaLabel(s));
+    const a = el('a', '', schemaLabel(s));
+    a.href = '#schema-' + refName(inner.$ref);
+    return a;
+}
+
+function table(headers, rows) {
+    const t = el('table', 'orders-table');
+    const head = el('tr');
+    head.append(...headers.map(h => el('th', '', h)));
+    const thead = el('thead');
+    thead.append(head);
+    const tbody = el('tbody');
+    for (const cells of rows) {
+        const tr = el('tr');
+        tr.append(...cells.map(c => {
+            const td = el('td');
+            td.append(c);
+            return td;
+        }));
+        tbody.append(tr);
+    }
+    t.append(thead, tbody);
+    return t;
+}
+
+function renderOperation(path, method, op) {
+    const box = el('details', 'op');
+    const summary = el('summary');
+    summary.append(el('span', 'op-method ' + method, method.toUpperCase()), ' ', el('code', '', path), ' — ', op.summary || '');
+    box.append(summary);
+    if (op.description) box.append(el('p', '', op.description));
+
+    if (op.parameters && op.parameters.length) {
+        box.append(el('h4', '', 'Параметры'));
+        box.append(table(['Имя', 'Где', 'Тип', 'Описание'], op.parameters.map(p => [
+            p.name + (p.required ? ' *' : ''), p.in, schemaLabel(p.schema), p.description || '',
+        ])));
+    }
+
+    box.append(el('h4', '', 'Ответы'));
+    box.append(table(['Код', 'Описание', 'Тип', 'Схема'], Object.entries(op.responses).map(([code, r]) => {
+        const [type, media] = Object.entries(r.content || {})[0] || ['', {}];
+        return [code, r.description, type, media.schema ? schemaLink(media.schema) : ''];
+    })));
+    return box;
+}
+
+function renderSchema(name, s) {
+    const box = el('div', 'section');
+    box.id = 'schema-' + name;
+    box.append(el('h3', '', name));
+    if (!s.properties) {
+        box.append(el('p', '', schemaLabel(s) + (s.description ? ' — ' + s.description : '')));
+        return box;
+    }
+    const required = new Set(s.required || []);
+    box.append(table(['Поле', 'Тип', 'Обязательное'], Object.keys(s.properties).sort().map(k => [
+        k, schemaLink(s.properties[k]), required.has(k) ? 'да' : '',
+    ])));
+    return box;
+}
+
+fetch('/openapi.json')
+    .then(res => res.json())
+    .then(spec => {
+        const frag = document.createDocumentFragment();
+        frag.append(el('p', '', spec.info.title + ' ' + spec.info.version + '. ' + (spec.info.description || '')));
+
+        const ops = el('div', 'section');
+        ops.append(el('h2', '', 'Операции'));
+        for (const path of Object.keys(spec.paths).sort()) {
+            for (const [method, op] of Object.entries(spec.paths[path])) {
+                ops.append(renderOperation(path, method, op));
+            }
+        }
+        frag.append(ops);
+
+        const schemas = el('div', 'section');
+        schemas.append(el('h2', '', 'Модели'));
+        for (const name of Object.keys(spec.components.schemas).sort()) {
+            schemas.append(renderSchema(name, spec.components.schemas[name]));
+        }
+        frag.append(schemas);
+
+        docsRoot.replaceChildren(frag);
+    })
+    .catch(err => {
+        docsRoot.replaceChildren(el('div', 'error', '❌ ' + err.message));
+    });
@@ -0,0 +1,18 @@
+// Общие помощники для построения DOM. Значения из заказов попадают
+// на страницу только через textContent.
+function el(tag, cls, text) {
+    const node = document.createElement(tag);
+    if (cls) node.className = cls;
+    if (text !== undefined) node.textContent = text;
+    return node;
+}
+
+// Сумма в единицах валюты по правилам русской локали: «1 817,50 ₽».
+// Число знаков после запятой Intl берёт из ISO 4217, как и сервис.
+function formatMoney(value, currency) {
+    try {
+        return new Intl.NumberFormat('ru-RU', {style: 'currency', currency}).format(value);
+    } catch (e) {
+        return value + ' ' + currency;
+    }
+}
@@ -0,0 +1,98 @@
+function goToOrder() {
+    const id = document.getElementById('manualId').value.trim();
+    if (id) {
+        window.location.href = '/ui/' + encodeURIComponent(id);
+    }
+}
+document.getElementById('goButton').addEventListener('click', goToOrder);
+document.getElementById('refreshButton').addEventListener('click', () => location.reload());
+document.getElementById('manualId').addEventListener('keypress', function(e) {
+    if (e.key === 'Enter') goToOrder();
+});
+
+// === Живая лента новых заказов (GET /events) ===
+const liveStatus = document.getElementById('live-status');
+const ordersTable = document.querySelector('.orders-table');
+const ordersBody = document.getElementById('orders-body');
+const maxRejections = 20;
+
+let lastEventId = '';
+let retryDelay = 1000;
+let newOrders = 0;
+
+function setStatus(state, title) {
+    liveStatus.className = 'live-status ' + state;
+    liveStatus.title = title;
+}
+
+function orderRow(o) {
+    const tr = el('tr', 'fresh');
+    const link = el('a', 'uid', o.order_uid);
+    link.href = '/ui/' + encodeURIComponent(o.order_uid);
+    const uid = el('td');
+    uid.append(link);
+    tr.append(
+        uid,
+        el('td', '', new Date(o.date_created).toLocaleString('ru-RU', {dateStyle: 'short', timeStyle: 'short'})),
+        el('td', '', o.customer_id),
+        el('td', '', o.delivery_service),
+        el('td', 'num', String(o.item_count)),
+        el('td', 'num', formatMoney(o.amount, o.currency)),
+        el('td', '', o.currency),
+    );
+    return tr;
+}
+
+function onOrder(e) {
+    lastEventId = e.lastEventId;
+    const o = JSON.parse(e.data);
+    if (ordersTable.dataset.live === 'true') {
+        const empty = ordersBody.querySelector('.empty-row');
+        if (empty) empty.remove();
+        ordersBody.prepend(orderRow(o));
+        const total = document.getElementById('orders-total');
+        total.textContent = String(Number(total.textContent) + 1);
+    } else {
+        // На отфильтрованной или не первой странице только сообщаем о новых заказах
+        newOrders++;
+        document.getElementById('new-orders-count').textContent = String(newOrders);
+        document.getElementById('new-orders').hidden = false;
+    }
+}
+
+function onRejected(e) {
+    lastEventId = e.lastEventId;
+    const r = JSON.parse(e.data);
+    const list = document.getElementById('rejections-list');
+    const when = new Date(r.at).toLocaleTimeString('ru-RU');
+    list.prepend(el('li', '', when + ' ' + (r.order_uid || '(без order_uid)') + ': ' + r.reason));
+    while (list.children.length > maxRejections) list.lastChild.remove();
+    document.getElementById('rejections').hidden = false;
+}
+
+// EventSource сам переподключается и шлёт Last-Event-ID. Если поток закрыт
+// окончательно (например, сервер был недоступен), создаём новый и передаём
+// последний ID параметром, чтобы догнать пропущенное.
+function connect() {
+    setStatus('connecting', 'Подключение…');
+    const url = '/events' + (lastEventId ? '?last_event_id=' + encodeURIComponent(lastEventId) : '');
+    const source = new EventSource(url);
+
+    source.addEventListener('open', () => {
+        retryDelay = 1000;
+        setStatus('online', 'Лента подключена');
+    });
+    source.addEventListener('order', onOrder);
+    source.addEventListener('rejected', onRejected);
+    source.addEventListener('error', () => {
+        if (source.readyState === EventSource.CLOSED) {
+            setStatus('offline', 'Нет соединения, повтор через ' + retryDelay / 1000 + ' с');
+            setTimeout(connect, retryDelay);
+            retryDelay = Math.min(retryDelay * 2, 30000);
+        } else {
+            setStatus('connecting', 'Переподключение…');
+        }
+    });
+}
+
+connect();
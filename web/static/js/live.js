@@ -0,0 +1,41 @@
+// Оперативная статистика из памяти сервиса (GET /stats/live), без запросов к БД.
+const livePollMs = 10000;
+
+function percent(v) {
+    return (v * 100).toLocaleString('ru-RU', {maximumFractionDigits: 1}) + '%';
+}
+
+function loadLive() {
+    fetch('/stats/live')
+        .then(res => {
+            if (!res.ok) throw new Error(res.statusText);
+            return res.json();
+        })
+        .then(snap => {
+            const body = document.getElementById('live-body');
+            body.replaceChildren(...snap.windows.map(w => {
+                const tr = el('tr');
+                tr.append(
+                    el('td', '', w.minutes + ' мин'),
+                    el('td', 'num', formatNumber(w.accepted)),
+                    el('td', 'num', formatNumber(w.rejected)),
+                    el('td', 'num', formatNumber(w.orders_per_minute)),
+                    el('td', 'num', percent(w.rejection_rate)),
+                    el('td', 'num', formatNumber(w.avg_amount)),
+                );
+                return tr;
+            }));
+            columnChart(document.getElementById('chart-live'), snap.per_minute.map(m => ({
+                label: new Date(m.minute).toLocaleTimeString('ru-RU', {hour: '2-digit', minute: '2-digit'}),
+                value: m.accepted,
+            })));
+            document.getElementById('live-updated').textContent =
+                'обновлено ' + new Date(snap.at).toLocaleTimeString('ru-RU');
+        })
+        .catch(err => {
+            document.getElementById('live-updated').textContent = 'ошибка обновления: ' + err.message;
+        });
+}
+
+loadLive();
+setInterval(loadLive, livePollMs);
@@ -0,0 +1,77 @@
+const root = document.getElementById('order-data');
+
+fetch('/order/' + encodeURIComponent(root.dataset.orderUid))
+    .then(res => {
+        if (!res.ok) throw new Error('Заказ не найден');
+        return res.json();
+    })
+    .then(order => {
+        root.replaceChildren(renderOrder(order));
+    })
+    .catch(err => {
+        const box = el('div', 'error');
+        box.append(el('h3', '', '❌ ' + err.message), el('p', '', 'Проверьте правильность ID заказа.'));
+        root.replaceChildren(box);
+    });
+
+function section(title, bodyClass, children) {
+    const s = el('div', 'section');
+    const body = el('div', bodyClass);
+    body.append(...children);
+    s.append(el('h2', '', title), body);
+    return s;
+}
+
+function field(label, value) {
+    const f = el('div', 'field');
+    f.append(el('div', 'field-label', label), el('div', 'field-value', String(value || '—')));
+    return f;
+}
+
+function renderOrder(o) {
+    const frag = document.createDocumentFragment();
+    const money = v => formatMoney(v, o.payment.currency);
+
+    frag.append(section('Общее', 'grid', [
+        field('ID заказа', o.order_uid),
+        field('Трек-номер', o.track_number),
+        field('Точка входа', o.entry),
+        field('Язык', o.locale),
+        field('ID клиента', o.customer_id),
+        field('Служба доставки', o.delivery_service),
+        field('Создан', new Date(o.date_created).toLocaleString('ru-RU')),
+    ]));
+
+    frag.append(section('Доставка', 'grid', [
+        field('Имя', o.delivery.name),
+        field('Телефон', o.delivery.phone),
+        field('Email', o.delivery.email),
+        field('Адрес', [o.delivery.address, o.delivery.city, o.delivery.region, o.delivery.zip].join(', ')),
+    ]));
+
+    frag.append(section('Оплата', 'grid', [
+        field('Сумма', money(o.payment.amount)),
+        field('Провайдер', o.payment.provider),
+        field('Банк', o.payment.bank),
+        field('Стоимость доставки', money(o.payment.delivery_cost)),
+        field('Стоимость товаров', money(o.payment.goods_total)),
+        field('Оплачено', new Date(o.payment.payment_dt * 1000).toLocaleString('ru-RU')),
+    ]));
+
+    const items = o.items || [];
+    frag.append(section('Товары (' + items.length + ')', 'items-list', items.map(item => {
+        const card = el('div', 'item-card');
+        card.append(
+            el('strong', '', item.name), ' (' + item.brand + ')', el('br'),
+            'Цена: ' + money(item.price) + ' → Итого: ' + money(item.total_price) + ' (' + item.sale + '% скидка)', el('br'),
+            'Размер: ' + item.size + ' | Статус: ' + item.status,
+        );
+        return card;
+    })));
+
+    const raw = el('details');
+    raw.append(el('summary', '', '🔍 Показать исходный JSON'), el('pre', '', JSON.stringify(o, null, 2)));
+    frag.append(raw);
+
+    return frag;
+}
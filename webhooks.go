@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lib/pq"
+)
+
+// === Webhooks: события о заказах по HTTP ===
+// Партнёр регистрирует URL и фильтры (типы событий, entry,
+// delivery_service; пустой фильтр — любые). События берутся из outbox
+// (outbox.go): каждое раскладывается в webhook_deliveries по подходящим
+// включённым подпискам, а доставщик отправляет их POST-запросом с JSON
+// события (тот же, что уходит в NATS). Ответ 2xx — доставлено; иначе
+// повтор с экспоненциальной задержкой, после webhookMaxAttempts попыток
+// доставка считается неудачной. После webhookDisableAfter неудач подряд
+// подписка выключается; включить её снова — POST /admin/webhooks/{id}/enable.
+// Пока подписка выключена, новые события для неё не копятся.
+//
+// Подпись: X-Webhook-Signature: sha256=<hex HMAC-SHA256(secret,
+// X-Webhook-Timestamp + "." + тело)>. Секрет выдаётся один раз при
+// создании подписки.
+//
+// Доставка — не меньше одного раза, порядок не гарантируется: у события
+// есть id и occurred_at. Раскладка идёт под advisory lock, а доставки
+// экземпляры сервиса разбирают через FOR UPDATE SKIP LOCKED.
+
+const (
+	webhookBatch        = 20
+	webhookFanOutBatch  = 500
+	webhookTimeout      = 10 * time.Second
+	webhookLease        = time.Minute // на столько доставка закрепляется за экземпляром
+	webhookMaxAttempts  = 8
+	webhookBaseBackoff  = 10 * time.Second
+	webhookMaxBackoff   = time.Hour
+	webhookDisableAfter = 20
+	webhookPoll         = time.Second
+	webhookLockID       = 0x77686f6b // ключ advisory lock раскладки («whok»)
+	webhookPing         = "ping"
+)
+
+var webhookEvents = []string{eventOrderSaved, eventOrderUpdated, eventOrderDeleted}
+
+// webhookKick будит доставщика после коммита событий (см. kickOutbox).
+var webhookKick = make(chan struct{}, 1)
+
+// Редиректы не выполняются: 3xx — неудачная попытка.
+var webhookHTTP = &http.Client{
+	Timeout: webhookTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+type webhook struct {
+	ID                  int64      `json:"id"`
+	URL                 string     `json:"url"`
+	Events              []string   `json:"events"`            // пусто — все
+	Entries             []string   `json:"entries"`           // пусто — любой entry
+	DeliveryServices    []string   `json:"delivery_services"` // пусто — любая служба
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	Secret              string     `json:"secret,omitempty"` // только в ответе на создание
+}
+
+type webhookRequest struct {
+	URL              string   `json:"url"`
+	Events           []string `json:"events,omitempty"`
+	Entries          []string `json:"entries,omitempty"`
+	DeliveryServices []string `json:"delivery_services,omitempty"`
+}
+
+type webhookDelivery struct {
+	ID            int64      `json:"id"`
+	EventID       int64      `json:"event_id"` // id события outbox
+	EventType     string     `json:"event_type"`
+	OrderUID      string     `json:"order_uid"`
+	Status        string     `json:"status"` // pending, delivered, failed
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatus    int        `json:"last_status,omitempty"` // HTTP-статус последней попытки
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+type webhookTestResult struct {
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+func (req *webhookRequest) validate() error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url: нужен абсолютный http(s)-адрес")
+	}
+	for _, e := range req.Events {
+		if !slices.Contains(webhookEvents, e) {
+			return fmt.Errorf("events: неизвестное событие %q, есть %s", e, strings.Join(webhookEvents, ", "))
+		}
+	}
+	return nil
+}
+
+// webhookSignature — подпись тела: hex HMAC-SHA256(secret, "ts.body").
+func webhookSignature(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook выполняет одну попытку доставки; ошибка — всё, кроме 2xx.
+func sendWebhook(client *http.Client, target, secret, eventType string, deliveryID int64, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "order-service-webhooks")
+	req.Header.Set("X-Webhook-Event", eventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(deliveryID, 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+	req.Header.Set("X-Webhook-Signature", webhookSignature(secret, ts, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookBackoff — задержка перед следующей попыткой после attempts неудачных.
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookBaseBackoff << (attempts - 1)
+	if d <= 0 || d > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return d
+}
+
+// === Доставщик ===
+
+func startWebhookWorker() {
+	poll := time.NewTimer(0)
+	for {
+		select {
+		case <-poll.C:
+		case <-webhookKick:
+			poll.Stop()
+		}
+		for _, s := range router.shards {
+			for {
+				n, err := fanOutWebhooks(s)
+				if err != nil {
+					log.Printf(" Раскладка событий по webhooks (шард %s): %v", s.name, err)
+					break
+				}
+				if n < webhookFanOutBatch {
+					break
+				}
+			}
+		}
+		for {
+			n, err := deliverWebhooks()
+			if err != nil {
+				log.Printf(" Доставка webhooks: %v", err)
+				break
+			}
+			if n < webhookBatch {
+				break
+			}
+		}
+		poll.Reset(webhookPoll)
+	}
+}
+
+// fanOutWebhooks раскладывает ещё не разобранные события outbox шарда по
+// подпискам и возвращает, сколько событий разобрано. Подписки и доставки
+// живут в основной БД; если шард другой, сначала фиксируются доставки, а
+// потом отметка в outbox шарда — при сбое между ними событие разложится
+// повторно, что допустимо при доставке не меньше одного раза.
+func fanOutWebhooks(s *shard) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	if err := tx.QueryRow("SELECT pg_try_advisory_xact_lock($1)", webhookLockID).Scan(&locked); err != nil || !locked {
+		return 0, err
+	}
+	stx := tx
+	if s.db != db {
+		if stx, err = s.db.Begin(); err != nil {
+			return 0, err
+		}
+		defer stx.Rollback()
+	}
+	rows, err := stx.Query(`
+		SELECT id, event_type, order_uid, entry, delivery_service, created_at, payload
+		FROM outbox
+		WHERE webhooks_at IS NULL
+		ORDER BY id
+		LIMIT $1`, webhookFanOutBatch)
+	if err != nil {
+		return 0, err
+	}
+	var batch []outboxEvent
+	for rows.Next() {
+		var ev outboxEvent
+		var payload []byte
+		if err := rows.Scan(&ev.ID, &ev.Type, &ev.OrderUID, &ev.Entry, &ev.DeliveryService, &ev.OccurredAt, &payload); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ev.Data = payload
+		batch = append(batch, ev)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, ev := range batch {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return 0, err
+		}
+		res, err := tx.Exec(`
+			INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, order_uid, payload)
+			SELECT id, $1, $2, $3, $6 FROM webhooks
+			WHERE enabled
+				AND (cardinality(events) = 0 OR $2 = ANY(events))
+				AND (cardinality(entries) = 0 OR $4 = ANY(entries))
+				AND (cardinality(delivery_services) = 0 OR $5 = ANY(delivery_services))`,
+			ev.ID, ev.Type, ev.OrderUID, ev.Entry, ev.DeliveryService, body)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		queued += int(n)
+		if _, err := stx.Exec("UPDATE outbox SET webhooks_at = now() WHERE id = $1", ev.ID); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if stx != tx {
+		if err := stx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	if queued > 0 {
+		log.Printf(" Для webhooks поставлено в очередь доставок: %d", queued)
+	}
+	return len(batch), nil
+}
+
+type claimedDelivery struct {
+	id, webhookID int64
+	eventType     string
+	payload       []byte
+	attempts      int
+	url, secret   string
+}
+
+// deliverWebhooks забирает доставки, которым пора, отправляет их
+// параллельно и записывает результат. Возвращает число взятых доставок.
+func deliverWebhooks() (int, error) {
+	rows, err := db.Query(`
+		UPDATE webhook_deliveries d SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM webhooks w
+		WHERE w.id = d.webhook_id AND d.id IN (
+			SELECT d2.id FROM webhook_deliveries d2
+			JOIN webhooks w2 ON w2.id = d2.webhook_id AND w2.enabled
+			WHERE d2.status = 'pending' AND d2.next_attempt_at <= now()
+			ORDER BY d2.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d2 SKIP LOCKED)
+		RETURNING d.id, d.webhook_id, d.event_type, d.payload, d.attempts, w.url, w.secret`,
+		webhookBatch, webhookLease.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	var batch []claimedDelivery
+	for rows.Next() {
+		var c claimedDelivery
+		if err := rows.Scan(&c.id, &c.webhookID, &c.eventType, &c.payload, &c.attempts, &c.url, &c.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, sendErr := sendWebhook(webhookHTTP, c.url, c.secret, c.eventType, c.id, c.payload)
+			if err := recordWebhookAttempt(c, status, sendErr); err != nil {
+				log.Printf(" Не удалось записать результат доставки %d: %v", c.id, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return len(batch), nil
+}
+
+// recordWebhookAttempt сохраняет итог попытки и при необходимости
+// выключает подписку.
+func recordWebhookAttempt(c claimedDelivery, status int, sendErr error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	attempts := c.attempts + 1
+	if sendErr == nil {
+		_, err = tx.Exec(`
+			UPDATE webhook_deliveries SET status = 'delivered', attempts = $2, last_status = $3,
+				last_error = NULL, next_attempt_at = NULL, delivered_at = now()
+			WHERE id = $1`, c.id, attempts, status)
+		if err == nil {
+			_, err = tx.Exec("UPDATE webhooks SET consecutive_failures = 0 WHERE id = $1", c.webhookID)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	state, next := "pending", sql.NullTime{Time: time.Now().Add(webhookBackoff(attempts)), Valid: true}
+	if attempts >= webhookMaxAttempts {
+		state, next = "failed", sql.NullTime{}
+	}
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries SET status = $2, attempts = $3, last_status = NULLIF($4, 0),
+			last_error = $5, next_attempt_at = $6
+		WHERE id = $1`, c.id, state, attempts, status, sendErr.Error(), next)
+	if err != nil {
+		return err
+	}
+	var disabled bool
+	err = tx.QueryRow(`
+		UPDATE webhooks SET consecutive_failures = consecutive_failures + 1,
+			enabled = enabled AND consecutive_failures + 1 < $2,
+			disabled_at = CASE WHEN enabled AND consecutive_failures + 1 >= $2 THEN now() ELSE disabled_at END
+		WHERE id = $1
+		RETURNING NOT enabled AND disabled_at = now()`,
+		c.webhookID, webhookDisableAfter).Scan(&disabled)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if disabled {
+		log.Printf(" Webhook %d выключен после %d неудачных доставок подряд: %v", c.webhookID, webhookDisableAfter, sendErr)
+	}
+	return nil
+}
+
+// === HTTP: /admin/webhooks (только для админа) ===
+
+func webhookID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "некорректный id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "Невалидный JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		http.Error(w, "Не удалось создать секрет", http.StatusInternalServerError)
+		return
+	}
+
+	hook := webhook{
+		URL: req.URL, Events: nonNil(req.Events), Entries: nonNil(req.Entries),
+		DeliveryServices: nonNil(req.DeliveryServices), Enabled: true, Secret: hex.EncodeToString(secret),
+	}
+	err := db.QueryRow(`
+		INSERT INTO webhooks (url, secret, events, entries, delivery_services)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		hook.URL, hook.Secret, pq.Array(hook.Events), pq.Array(hook.Entries), pq.Array(hook.DeliveryServices)).
+		Scan(&hook.ID, &hook.CreatedAt)
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf(" Зарегистрирован webhook %d: %s", hook.ID, hook.URL)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/admin/webhooks/"+strconv.FormatInt(hook.ID, 10))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`
+		SELECT id, url, events, entries, delivery_services, enabled, consecutive_failures, disabled_at, created_at
+		FROM webhooks ORDER BY id`)
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	hooks := []webhook{}
+	for rows.Next() {
+		var h webhook
+		err := rows.Scan(&h.ID, &h.URL, pq.Array(&h.Events), pq.Array(&h.Entries), pq.Array(&h.DeliveryServices),
+			&h.Enabled, &h.ConsecutiveFailures, &h.DisabledAt, &h.CreatedAt)
+		if err != nil {
+			http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.Events, h.Entries, h.DeliveryServices = nonNil(h.Events), nonNil(h.Entries), nonNil(h.DeliveryServices)
+		hooks = append(hooks, h)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	res, err := db.Exec("DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Webhook не найден", http.StatusNotFound)
+		return
+	}
+	log.Printf(" Webhook %d удалён", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// enableWebhookHandler включает подписку и сбрасывает счётчик неудач.
+// Доставки, отложенные на время выключения, продолжаются сразу.
+func enableWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	res, err := db.Exec(`
+		UPDATE webhooks SET enabled = true, consecutive_failures = 0, disabled_at = NULL WHERE id = $1`, id)
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Webhook не найден", http.StatusNotFound)
+		return
+	}
+	_, err = db.Exec(`
+		UPDATE webhook_deliveries SET next_attempt_at = now()
+		WHERE webhook_id = $1 AND status = 'pending'`, id)
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf(" Webhook %d включён", id)
+	kickOutbox()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// testWebhookHandler сразу отправляет событие ping и возвращает ответ
+// получателя. Счётчик неудач не меняется; выключенную подписку тоже можно
+// проверить.
+func testWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	var target, secret string
+	err := db.QueryRow("SELECT url, secret FROM webhooks WHERE id = $1", id).Scan(&target, &secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Webhook не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := json.Marshal(outboxEvent{Type: webhookPing, OccurredAt: time.Now().UTC()})
+	start := time.Now()
+	status, sendErr := sendWebhook(webhookHTTP, target, secret, webhookPing, 0, body)
+	res := webhookTestResult{Status: status, DurationMs: time.Since(start).Milliseconds()}
+	if sendErr != nil {
+		res.Error = sendErr.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// webhookDeliveriesHandler — журнал доставок подписки, новые сначала;
+// status — фильтр pending, delivered или failed.
+func webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	status := q.Get("status")
+	if status != "" && status != "pending" && status != "delivered" && status != "failed" {
+		http.Error(w, "status должен быть pending, delivered или failed", http.StatusBadRequest)
+		return
+	}
+	limit := defaultDLQLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDLQLimit {
+			http.Error(w, "limit должен быть от 1 до "+strconv.Itoa(maxDLQLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rows, err := db.Query(`
+		SELECT id, event_id, event_type, order_uid, status, attempts, next_attempt_at,
+			COALESCE(last_status, 0), COALESCE(last_error, ''), created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC LIMIT $3`, id, status, limit)
+	if err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := []webhookDelivery{}
+	for rows.Next() {
+		var d webhookDelivery
+		err := rows.Scan(&d.ID, &d.EventID, &d.EventType, &d.OrderUID, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatus, &d.LastError, &d.CreatedAt, &d.DeliveredAt)
+		if err != nil {
+			http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list = append(list, d)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Ошибка БД: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
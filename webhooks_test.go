@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"order-service-demo/client"
+)
+
+// === Webhooks: подпись, повторы, выключение и фильтры ===
+// Доставщик здесь не запущен: тесты сами вызывают fanOutWebhooks и
+// deliverWebhooks, а получатель — httptest-сервер, который проверяет подпись
+// так же, как партнёр, через client.VerifyWebhook.
+
+// receiver — получатель webhooks; status — код ответа на подписанный
+// запрос, неверная подпись даёт 401.
+type receiver struct {
+	srv      *httptest.Server
+	secret   atomic.Value // string
+	status   atomic.Int64
+	requests atomic.Int64
+	verified chan string // X-Webhook-Event проверенных запросов
+}
+
+func newReceiver(t *testing.T, secret string) *receiver {
+	rc := &receiver{verified: make(chan string, 100)}
+	rc.secret.Store(secret)
+	rc.status.Store(http.StatusOK)
+	rc.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc.requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if err := client.VerifyWebhook(rc.secret.Load().(string), r, body, time.Minute); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		rc.verified <- r.Header.Get("X-Webhook-Event")
+		w.WriteHeader(int(rc.status.Load()))
+	}))
+	t.Cleanup(rc.srv.Close)
+	return rc
+}
+
+func TestWebhookSignature(t *testing.T) {
+	rc := newReceiver(t, "s3cret")
+	body := []byte(`{"id": 1, "type": "order.saved", "order_uid": "b563feb7b2b84b6test"}`)
+
+	status, err := sendWebhook(webhookHTTP, rc.srv.URL, "s3cret", eventOrderSaved, 1, body)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("подписанный запрос: %d, %v", status, err)
+	}
+	if ev := <-rc.verified; ev != eventOrderSaved {
+		t.Errorf("X-Webhook-Event %q", ev)
+	}
+
+	status, err = sendWebhook(webhookHTTP, rc.srv.URL, "other", eventOrderSaved, 2, body)
+	if err == nil || status != http.StatusUnauthorized {
+		t.Errorf("чужой секрет: %d, %v", status, err)
+	}
+
+	// Подпись покрывает и время, и тело
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	ts := time.Now().Unix()
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts+1, 10))
+	req.Header.Set("X-Webhook-Signature", webhookSignature("s3cret", ts, body))
+	if err := client.VerifyWebhook("s3cret", req, body, time.Minute); !errors.Is(err, client.ErrBadSignature) {
+		t.Errorf("подмена времени: %v", err)
+	}
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ts, 10))
+	if err := client.VerifyWebhook("s3cret", req, append(body, ' '), time.Minute); !errors.Is(err, client.ErrBadSignature) {
+		t.Errorf("подмена тела: %v", err)
+	}
+	if err := client.VerifyWebhook("s3cret", req, body, time.Minute); err != nil {
+		t.Errorf("исходный запрос: %v", err)
+	}
+
+	old := ts - 3600
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(old, 10))
+	req.Header.Set("X-Webhook-Signature", webhookSignature("s3cret", old, body))
+	if err := client.VerifyWebhook("s3cret", req, body, time.Minute); !errors.Is(err, client.ErrBadSignature) {
+		t.Errorf("запрос часовой давности: %v", err)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second}
+	for i, d := range want {
+		if got := webhookBackoff(i + 1); got != d {
+			t.Errorf("после %d неудач: %s, ожидалось %s", i+1, got, d)
+		}
+	}
+	for _, attempts := range []int{10, webhookMaxAttempts * 10, 100} {
+		if got := webhookBackoff(attempts); got != webhookMaxBackoff {
+			t.Errorf("после %d неудач: %s, ожидалось %s", attempts, got, webhookMaxBackoff)
+		}
+	}
+}
+
+// webhookClient — клиент админа к тестовому серверу.
+func webhookClient(t *testing.T) *client.Client {
+	c, err := client.New(newTestServer(t).URL, client.WithToken(testAdminToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// queueEvents записывает события в outbox и раскладывает их по подпискам.
+func queueEvents(t *testing.T, typ string, refs ...orderRef) {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, ref := range refs {
+		if err := writeOutboxTx(tx, typ, ref, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fanOutWebhooks(router.shards[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deliverDue делает все ожидающие доставки срочными и отправляет их.
+func deliverDue(t *testing.T) int {
+	t.Helper()
+	if _, err := db.Exec("UPDATE webhook_deliveries SET next_attempt_at = now() WHERE status = 'pending'"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := deliverWebhooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func getWebhook(t *testing.T, c *client.Client, id int64) client.Webhook {
+	t.Helper()
+	hooks, err := c.Webhooks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hooks {
+		if h.ID == id {
+			return h
+		}
+	}
+	t.Fatalf("webhook %d не найден", id)
+	return client.Webhook{}
+}
+
+func TestWebhookFilters(t *testing.T) {
+	needDB(t)
+	ctx := context.Background()
+	c := webhookClient(t)
+	rc := newReceiver(t, "")
+
+	hooks := map[string]client.WebhookRequest{
+		"все":              {URL: rc.srv.URL},
+		"удаления":         {URL: rc.srv.URL, Events: []string{eventOrderDeleted}},
+		"WBIL":             {URL: rc.srv.URL, Entries: []string{"WBIL"}},
+		"meest и cdek":     {URL: rc.srv.URL, DeliveryServices: []string{"meest", "cdek"}},
+		"сохранения meest": {URL: rc.srv.URL, Events: []string{eventOrderSaved}, DeliveryServices: []string{"meest"}},
+	}
+	ids := map[string]int64{}
+	for name, req := range hooks {
+		h, err := c.CreateWebhook(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Secret == "" || !h.Enabled {
+			t.Fatalf("%s: подписка %+v", name, h)
+		}
+		ids[name] = h.ID
+	}
+
+	queueEvents(t, eventOrderSaved,
+		orderRef{"a", "WBIL", "meest"},
+		orderRef{"b", "WBIL", "boxberry"},
+		orderRef{"c", "OZON", "cdek"})
+	queueEvents(t, eventOrderDeleted, orderRef{"d", "OZON", "meest"})
+
+	want := map[string][]string{
+		"все":              {"d", "c", "b", "a"},
+		"удаления":         {"d"},
+		"WBIL":             {"b", "a"},
+		"meest и cdek":     {"d", "c", "a"},
+		"сохранения meest": {"a"},
+	}
+	for name, uids := range want {
+		list, err := c.WebhookDeliveries(ctx, ids[name], "pending", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range list {
+			got = append(got, d.OrderUID)
+		}
+		if !slices.Equal(got, uids) {
+			t.Errorf("%s: доставки %v, ожидались %v", name, got, uids)
+		}
+	}
+
+	// Повторная раскладка событий не дублирует
+	if n, err := fanOutWebhooks(router.shards[0]); err != nil || n != 0 {
+		t.Errorf("повторная раскладка: %d событий, %v", n, err)
+	}
+}
+
+func TestWebhookRetriesAndDisable(t *testing.T) {
+	needDB(t)
+	ctx := context.Background()
+	c := webhookClient(t)
+	rc := newReceiver(t, "")
+
+	h, err := c.CreateWebhook(ctx, client.WebhookRequest{URL: rc.srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.secret.Store(h.Secret)
+	rc.status.Store(http.StatusInternalServerError)
+
+	// Одна доставка: задержка растёт, после webhookMaxAttempts — failed
+	queueEvents(t, eventOrderSaved, orderRef{"a", "WBIL", "meest"})
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if n := deliverDue(t); n != 1 {
+			t.Fatalf("попытка %d: взято доставок %d", attempt, n)
+		}
+		list, err := c.WebhookDeliveries(ctx, h.ID, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := list[0]
+		if d.Attempts != attempt || d.LastStatus != http.StatusInternalServerError || d.LastError == "" {
+			t.Fatalf("попытка %d: доставка %+v", attempt, d)
+		}
+		if attempt < webhookMaxAttempts {
+			wait := time.Until(*d.NextAttemptAt)
+			if d.Status != "pending" || wait < webhookBackoff(attempt)-time.Minute || wait > webhookBackoff(attempt) {
+				t.Errorf("попытка %d: %s, следующая через %s", attempt, d.Status, wait)
+			}
+		} else if d.Status != "failed" || d.NextAttemptAt != nil {
+			t.Errorf("после %d попыток: %+v", attempt, d)
+		}
+	}
+	if n := deliverDue(t); n != 0 {
+		t.Errorf("неудачная доставка отправлена снова: %d", n)
+	}
+	if hook := getWebhook(t, c, h.ID); !hook.Enabled || hook.ConsecutiveFailures != webhookMaxAttempts {
+		t.Fatalf("после %d неудач: %+v", webhookMaxAttempts, hook)
+	}
+
+	// Ещё две доставки: подписка выключается ровно на webhookDisableAfter-й неудаче
+	queueEvents(t, eventOrderSaved, orderRef{"b", "WBIL", "meest"}, orderRef{"c", "WBIL", "meest"})
+	for failures := webhookMaxAttempts; failures < webhookDisableAfter; failures += 2 {
+		if hook := getWebhook(t, c, h.ID); !hook.Enabled {
+			t.Fatalf("выключен после %d неудач", hook.ConsecutiveFailures)
+		}
+		if n := deliverDue(t); n != 2 {
+			t.Fatalf("после %d неудач взято доставок %d", failures, n)
+		}
+	}
+	hook := getWebhook(t, c, h.ID)
+	if hook.Enabled || hook.DisabledAt == nil || hook.ConsecutiveFailures != webhookDisableAfter {
+		t.Fatalf("после %d неудач: %+v", webhookDisableAfter, hook)
+	}
+	if rc.requests.Load() != webhookDisableAfter {
+		t.Errorf("получатель принял %d запросов", rc.requests.Load())
+	}
+
+	// Выключенной подписке ничего не отправляется и новые события не копятся
+	if n := deliverDue(t); n != 0 {
+		t.Errorf("выключенной подписке отправлено %d доставок", n)
+	}
+	queueEvents(t, eventOrderDeleted, orderRef{"d", "WBIL", "meest"})
+	if list, _ := c.WebhookDeliveries(ctx, h.ID, "pending", 0); len(list) != 2 {
+		t.Errorf("ожидающих доставок %d, ожидалось 2", len(list))
+	}
+
+	// После включения отложенные доставки уходят и счётчик сбрасывается
+	rc.status.Store(http.StatusNoContent)
+	if err := c.EnableWebhook(ctx, h.ID); err != nil {
+		t.Fatal(err)
+	}
+	if hook := getWebhook(t, c, h.ID); !hook.Enabled || hook.DisabledAt != nil || hook.ConsecutiveFailures != 0 {
+		t.Fatalf("после включения: %+v", hook)
+	}
+	if n, err := deliverWebhooks(); err != nil || n != 2 {
+		t.Fatalf("после включения взято доставок %d, %v", n, err)
+	}
+	delivered, err := c.WebhookDeliveries(ctx, h.ID, "delivered", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delivered) != 2 || delivered[0].DeliveredAt == nil || delivered[0].LastStatus != http.StatusNoContent {
+		t.Errorf("доставлено %+v", delivered)
+	}
+	if hook := getWebhook(t, c, h.ID); hook.ConsecutiveFailures != 0 {
+		t.Errorf("счётчик неудач %d после доставки", hook.ConsecutiveFailures)
+	}
+
+	var missing *client.APIError
+	if err := c.EnableWebhook(ctx, h.ID+1000); !errors.As(err, &missing) || !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("неизвестный webhook: %v", err)
+	}
+}
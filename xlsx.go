@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// === Потоковая запись XLSX ===
+// Книга с одним листом пишется прямо в ответ: zip.Writer не держит архив
+// в памяти, строки листа уходят по мере поступления. Строки ячеек — inline
+// (без таблицы sharedStrings), даты — числа Excel со стилем даты.
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+	// Стиль 1 — жирный заголовок, стиль 2 — дата и время.
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>
+</styleSheet>`
+	xlsxSheetHead = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews><sheetData>`
+	xlsxSheetTail = `</sheetData></worksheet>`
+)
+
+// excelEpoch — нулевой день дат Excel (с учётом ошибки 1900 года).
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+func newXLSXWriter(w io.Writer, sheetName string) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	var name bytes.Buffer
+	xml.EscapeText(&name, []byte(sheetName))
+	workbook := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="` +
+		name.String() + `" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// Лист создаётся последним: дальше в архив пишутся только его строки
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &xlsxWriter{zw: zw, sheet: bufio.NewWriterSize(f, 64<<10)}
+	_, err = x.sheet.WriteString(xlsxSheetHead)
+	return x, err
+}
+
+// writeHeader пишет строку заголовков жирным.
+func (x *xlsxWriter) writeHeader(names []string) error {
+	cells := make([]any, len(names))
+	for i, n := range names {
+		cells[i] = n
+	}
+	return x.writeRowStyle(cells, 1)
+}
+
+func (x *xlsxWriter) writeRow(cells []any) error {
+	return x.writeRowStyle(cells, 0)
+}
+
+func (x *xlsxWriter) writeRowStyle(cells []any, style int) error {
+	x.rows++
+	s := x.sheet
+	fmt.Fprintf(s, `<row r="%d">`, x.rows)
+	for _, v := range cells {
+		attr := ""
+		if style != 0 {
+			attr = ` s="` + strconv.Itoa(style) + `"`
+		}
+		switch v := v.(type) {
+		case nil:
+			s.WriteString(`<c/>`)
+		case int:
+			fmt.Fprintf(s, `<c%s><v>%d</v></c>`, attr, v)
+		case int64:
+			fmt.Fprintf(s, `<c%s><v>%d</v></c>`, attr, v)
+		case exportAmount:
+			fmt.Fprintf(s, `<c%s><v>%s</v></c>`, attr, v)
+		case float64:
+			fmt.Fprintf(s, `<c%s><v>%s</v></c>`, attr, strconv.FormatFloat(v, 'f', -1, 64))
+		case time.Time:
+			if v.IsZero() {
+				s.WriteString(`<c/>`)
+				continue
+			}
+			days := v.UTC().Sub(excelEpoch).Hours() / 24
+			fmt.Fprintf(s, `<c s="2"><v>%s</v></c>`, strconv.FormatFloat(days, 'f', 6, 64))
+		default:
+			fmt.Fprintf(s, `<c%s t="inlineStr"><is><t xml:space="preserve">`, attr)
+			xml.EscapeText(s, []byte(fmt.Sprint(v)))
+			s.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := s.WriteString(`</row>`)
+	return err
+}
+
+func (x *xlsxWriter) close() error {
+	if _, err := x.sheet.WriteString(xlsxSheetTail); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}